@@ -19,35 +19,76 @@ var (
 
 // Map of default values
 var defaults = map[string]string{
-	"DB_DRIVER":       "sqlite",
-	"DB_HOST":         "localhost",
-	"DB_USERNAME":     "root",
-	"DB_PASSWORD":     "",
-	"DB_PORT":         "5432",
-	"DB_DATABASE":     "config/articpad.db",
-	"REDIS_HOST":      "localhost",
-	"REDIS_PORT":      "6379",
-	"REDIS_USERNAME":  "",
-	"REDIS_PASSWORD":  "",
-	"REDIS_DB":        "0",
-	"MAIL_HOST":       "localhost",
-	"MAIL_PORT":       "25",
-	"MAIL_USER":       "",
-	"MAIL_PASS":       "",
-	"MAIL_FROM":       "ArticPad",
-	"MAIL_FORCE_TLS":  "false",
-	"ENABLE_MAIL":     "false",
-	"DEBUG":           "false",
-	"LOG_LEVEL":       "debug",
-	"LOG_DIR":         "./logs",
-	"APP_ADDR":        ":8080",
-	"STATIC_DIR":      "static",
-	"APP_URL":         "http://localhost:8080",
-	"SECRET":          "MyRandomSecureSecret",
-	"TRUSTED_PROXIES": "",
-	"TEMPLATES_DIR":   "templates",
-	"LOCALES_DIR":     "locales",
-	"RATE_LIMIT_AUTH": "true",
+	"DB_DRIVER":                     "sqlite",
+	"DB_HOST":                       "localhost",
+	"DB_USERNAME":                   "root",
+	"DB_PASSWORD":                   "",
+	"DB_PORT":                       "5432",
+	"DB_DATABASE":                   "config/articpad.db",
+	"REDIS_HOST":                    "localhost",
+	"REDIS_PORT":                    "6379",
+	"REDIS_USERNAME":                "",
+	"REDIS_PASSWORD":                "",
+	"REDIS_DB":                      "0",
+	"MAIL_HOST":                     "localhost",
+	"MAIL_PORT":                     "25",
+	"MAIL_USER":                     "",
+	"MAIL_PASS":                     "",
+	"MAIL_FROM":                     "ArticPad",
+	"MAIL_FORCE_TLS":                "false",
+	"ENABLE_MAIL":                   "false",
+	"DEBUG":                         "false",
+	"LOG_LEVEL":                     "debug",
+	"LOG_DIR":                       "./logs",
+	"APP_ADDR":                      ":8080",
+	"STATIC_DIR":                    "static",
+	"APP_URL":                       "http://localhost:8080",
+	"SECRET":                        "MyRandomSecureSecret",
+	"TRUSTED_PROXIES":               "",
+	"TEMPLATES_DIR":                 "templates",
+	"LOCALES_DIR":                   "locales",
+	"RATE_LIMIT_AUTH":               "true",
+	"ACCESS_TOKEN_TTL":              "15m",
+	"REFRESH_TOKEN_TTL":             "720h",
+	"OIDC_ENABLED":                  "false",
+	"OIDC_PROVIDER_NAME":            "SSO",
+	"OIDC_ISSUER":                   "",
+	"OIDC_CLIENT_ID":                "",
+	"OIDC_CLIENT_SECRET":            "",
+	"OIDC_REDIRECT_URL":             "",
+	"OIDC_SCOPES":                   "openid profile email",
+	"OIDC_AUTO_REGISTER":            "true",
+	"REGISTRATION_MODE":             "open",
+	"ALLOWED_EMAIL_DOMAINS":         "",
+	"MAGIC_LINK_TTL":                "15m",
+	"EMAIL_VERIFICATION_TTL":        "48h",
+	"WEBAUTHN_RP_ID":                "",
+	"WEBAUTHN_RP_NAME":              "ArticPad",
+	"LOGIN_MAX_ATTEMPTS":            "5",
+	"LOGIN_LOCKOUT_DURATION":        "15m",
+	"LOGIN_BACKOFF_DELAY":           "1s",
+	"LOGIN_BACKOFF_MAX_DELAY":       "30s",
+	"ARGON2_MEMORY":                 "32768",
+	"ARGON2_ITERATIONS":             "2",
+	"ARGON2_PARALLELISM":            "2",
+	"USERNAME_MIN_LENGTH":           "3",
+	"USERNAME_MAX_LENGTH":           "32",
+	"USERNAME_ALLOWED_CHARS":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.-_",
+	"RESERVED_USERNAMES_FILE":       "config/reserved_usernames.txt",
+	"RESERVED_USERNAMES":            "",
+	"PASSWORD_MIN_LENGTH":           "8",
+	"PASSWORD_MAX_LENGTH":           "64",
+	"PASSWORD_REQUIRE_LOWERCASE":    "true",
+	"PASSWORD_REQUIRE_UPPERCASE":    "true",
+	"PASSWORD_REQUIRE_NUMBER":       "true",
+	"PASSWORD_REQUIRE_SPECIAL":      "true",
+	"PASSWORD_MAX_SIMILARITY":       "0.7",
+	"PASSWORD_BREACHED_RANGES_DIR":  "",
+	"ACCOUNT_DELETION_GRACE_PERIOD": "720h",
+	"ACCOUNT_PURGE_INTERVAL":        "1h",
+	"NOTE_REVISIONS_MAX_COUNT":      "100",
+	"NOTE_REVISIONS_MAX_AGE":        "0",
+	"NOTE_REVISIONS_PRUNE_INTERVAL": "1h",
 }
 
 // LoadEnv loads the .env file, this should be called before using GetString or GetInt functions
@@ -86,6 +127,38 @@ func GetInt(key string, defaultValue ...int) int {
 	return 0
 }
 
+// GetDuration func to get time.Duration value from environment variable (e.g. "15m", "720h")
+func GetDuration(key string, defaultValue ...time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if value != "" {
+			if durationValue, err := time.ParseDuration(value); err == nil {
+				return durationValue
+			}
+		}
+	}
+
+	if len(defaultValue) > 0 {
+		return defaultValue[0]
+	}
+	return 0
+}
+
+// GetFloat func to get float64 value from environment variable
+func GetFloat(key string, defaultValue ...float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if value != "" {
+			if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+				return floatValue
+			}
+		}
+	}
+
+	if len(defaultValue) > 0 {
+		return defaultValue[0]
+	}
+	return 0
+}
+
 func loadDefaults() {
 	for key, value := range defaults {
 		if _, ok := os.LookupEnv(key); !ok {
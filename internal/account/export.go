@@ -0,0 +1,136 @@
+package account
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/user"
+)
+
+// Profile of a user as included in their data export.
+type exportProfile struct {
+	User        *user.User         `json:"user"`
+	Verified    bool               `json:"verified"`
+	Identities  *[]user.Identity   `json:"identities"`
+	Credentials *[]user.Credential `json:"credentials"`
+	APITokens   *[]user.APIToken   `json:"api_tokens"`
+}
+
+// Shares of a user as included in their data export.
+type exportShares struct {
+	Given    *[]note.Share `json:"given"`
+	Received *[]note.Share `json:"received"`
+}
+
+// A file of the data export, with the function loading its content.
+type exportFile struct {
+	name string
+	load func(ctx context.Context) (any, error)
+}
+
+// Sends the current user a ZIP archive with their profile and all their content as JSON files.
+func (h *AccountHandler) exportData(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID := h.getCurrentUserID(c)
+
+	currentUser, err := h.userService.GetUser(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	files := []exportFile{
+		{"profile.json", func(ctx context.Context) (any, error) {
+			identities, err := h.userService.GetIdentities(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			credentials, err := h.userService.GetCredentials(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			apiTokens, err := h.userService.GetAPITokens(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			return &exportProfile{User: currentUser, Verified: currentUser.VerifiedAt.Valid, Identities: identities, Credentials: credentials, APITokens: apiTokens}, nil
+		}},
+		{"notes.json", func(ctx context.Context) (any, error) {
+			return h.noteService.GetAllNotes(ctx, userID)
+		}},
+		{"revisions.json", func(ctx context.Context) (any, error) {
+			return h.noteService.GetAllRevisions(ctx, userID)
+		}},
+		{"tags.json", func(ctx context.Context) (any, error) {
+			return h.noteService.GetTags(ctx, userID)
+		}},
+		{"notebooks.json", func(ctx context.Context) (any, error) {
+			return h.noteService.GetNotebooks(ctx, userID)
+		}},
+		{"shares.json", func(ctx context.Context) (any, error) {
+			given, err := h.noteService.GetGivenShares(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			received, err := h.noteService.GetReceivedShares(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			return &exportShares{Given: given, Received: received}, nil
+		}},
+		{"public_links.json", func(ctx context.Context) (any, error) {
+			return h.noteService.GetAllPublicLinks(ctx, userID)
+		}},
+		{"sessions.json", func(ctx context.Context) (any, error) {
+			return h.sessionService.GetActiveSessions(ctx, userID)
+		}},
+	}
+
+	exportedAt := time.Now()
+	c.Attachment("articpad-export-" + currentUser.Username + "-" + exportedAt.Format("2006-01-02") + ".zip")
+
+	// The archive is streamed to the client as it is built, once the handler has returned, so only the
+	// content of one file is held in memory at a time. As the response has already started, an error
+	// cannot be reported, the archive is left incomplete instead so it fails to open.
+	c.Status(fiber.StatusOK)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamContext, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		archive := zip.NewWriter(w)
+		for _, file := range files {
+			data, err := file.load(streamContext)
+			if err != nil {
+				return
+			}
+			if err := writeExportFile(archive, file.name, data, exportedAt); err != nil {
+				return
+			}
+		}
+		_ = archive.Close()
+	})
+
+	return nil
+}
+
+// Adds a file to the archive with the given data encoded as indented JSON.
+func writeExportFile(archive *zip.Writer, name string, data any, modified time.Time) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,317 @@
+package account
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/session"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/templates"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	mailClient "github.com/jramsgz/articpad/pkg/mail"
+	"gorm.io/gorm"
+)
+
+type AccountHandler struct {
+	userService    user.UserService
+	noteService    note.NoteService
+	sessionService session.SessionService
+	denylist       auth.TokenDenylist
+	mailer         *mailClient.Mailer
+	i18n           *i18n.I18n
+}
+
+// Creates a new handler for users to manage their own account.
+func NewAccountHandler(userRoute fiber.Router, us user.UserService, ns note.NoteService, ss session.SessionService, denylist auth.TokenDenylist, mail *mailClient.Mailer, i18n *i18n.I18n) {
+	handler := &AccountHandler{
+		userService:    us,
+		noteService:    ns,
+		sessionService: ss,
+		denylist:       denylist,
+		mailer:         mail,
+		i18n:           i18n,
+	}
+
+	// Registered before the JWT middleware below as the link may be opened without being logged in.
+	userRoute.Post("/email/confirm", handler.confirmEmailChange)
+
+	// Also registered before it, as API tokens cannot be used to manage API tokens.
+	userRoute.Get("/me/tokens", auth.JWTMiddleware(denylist, nil), auth.GetDataFromJWT, handler.getAPITokens)
+	userRoute.Post("/me/tokens", auth.JWTMiddleware(denylist, nil), auth.GetDataFromJWT, handler.createAPIToken)
+	userRoute.Delete("/me/tokens/:tokenID", auth.JWTMiddleware(denylist, nil), auth.GetDataFromJWT, handler.deleteAPIToken)
+
+	userRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	userRoute.Get("/me", handler.getMe)
+	userRoute.Patch("/me", handler.updateProfile)
+	userRoute.Delete("/me", handler.deleteAccount)
+	userRoute.Get("/me/export", handler.exportData)
+	userRoute.Put("/me/password", handler.changePassword)
+	userRoute.Post("/me/email", handler.requestEmailChange)
+}
+
+// Gets the current user.
+func (h *AccountHandler) getMe(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	user, err := h.userService.GetUser(customContext, h.getCurrentUserID(c))
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"user":    user,
+	})
+}
+
+// Updates the username and language of the current user.
+func (h *AccountHandler) updateProfile(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Username string `json:"username"`
+		Lang     string `json:"lang"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	if h.i18n.Name(request.Lang) == "" {
+		return apierror.NewApiError(fiber.StatusUnprocessableEntity, consts.ErrCodeInvalidLanguage, h.i18n.T(langCode, "errors.invalid_language"))
+	}
+
+	user, err := h.userService.UpdateProfile(customContext, h.getCurrentUserID(c), request.Username, request.Lang)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(request.Lang, "messages.profile_updated"),
+		"user":    user,
+	})
+}
+
+// Changes the password of the current user and signs out their other sessions.
+func (h *AccountHandler) changePassword(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	userID := h.getCurrentUserID(c)
+
+	locked, err := h.userService.ChangePassword(customContext, userID, request.CurrentPassword, request.NewPassword)
+	if locked {
+		h.sendAccountLockedEmail(customContext, c, userID)
+	}
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	sessionIDs, err := h.sessionService.RevokeOtherSessions(customContext, userID, uuid.MustParse(claims["sid"].(string)))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	if err := h.denySessions(customContext, sessionIDs); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.password_changed"),
+	})
+}
+
+// Requests a change of the email of the current user. A confirmation link is sent to the new
+// address, if mail is not enabled the email is changed right away.
+func (h *AccountHandler) requestEmailChange(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	user, token, locked, err := h.userService.RequestEmailChange(customContext, h.getCurrentUserID(c), request.Password, request.Email)
+	if locked {
+		h.sendAccountLockedEmail(customContext, c, h.getCurrentUserID(c))
+	}
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	if config.GetString("ENABLE_MAIL") == "false" {
+		user, err = h.userService.ConfirmEmailChange(customContext, token)
+		if err != nil {
+			return h.mapUserError(c, err)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+			"success": true,
+			"message": h.i18n.T(langCode, "messages.email_changed"),
+			"user":    user,
+		})
+	}
+
+	err = h.mailer.SendMail(templates.GetEmailChangeEmail(h.i18n, user, token))
+	if err != nil {
+		return apierror.NewApiError(
+			fiber.StatusInternalServerError, consts.ErrCodeCannotSendEmailChangeEmail,
+			h.i18n.Ts(langCode, "errors.cannot_send_email_change_email", "error", err.Error()),
+		).ShowError()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.email_change_requested"),
+		"user":    user,
+	})
+}
+
+// Confirms an email change with the token sent to the new address.
+func (h *AccountHandler) confirmEmailChange(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Token string `json:"token"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	_, err := h.userService.ConfirmEmailChange(customContext, request.Token)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeInvalidEmailChangeToken, h.i18n.T(langCode, "errors.invalid_email_change_token"))
+		}
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.email_changed"),
+	})
+}
+
+// Deletes the account of the current user and signs out all their sessions. The account is disabled
+// right away and permanently deleted along with all its data after a grace period.
+func (h *AccountHandler) deleteAccount(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Password string `json:"password"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	userID := h.getCurrentUserID(c)
+
+	locked, err := h.userService.DeleteAccount(customContext, userID, request.Password)
+	if locked {
+		h.sendAccountLockedEmail(customContext, c, userID)
+	}
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	sessionIDs, err := h.sessionService.RevokeAllSessions(customContext, userID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	if err := h.denySessions(customContext, sessionIDs); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	days := int(config.GetDuration("ACCOUNT_DELETION_GRACE_PERIOD").Hours() / 24)
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.Tsc(h.getLangCode(c), "messages.account_deleted", days, "days", strconv.Itoa(days)),
+	})
+}
+
+// Revokes the access tokens of the given sessions.
+func (h *AccountHandler) denySessions(ctx context.Context, sessionIDs []uuid.UUID) error {
+	for _, sessionID := range sessionIDs {
+		if err := auth.DenySession(ctx, h.denylist, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapUserError maps the errors returned by the user service to API errors.
+func (h *AccountHandler) mapUserError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeAccountNotFound, h.i18n.T(h.getLangCode(c), "errors.account_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
+
+// Notifies a user that their account has been locked after too many failed attempts. The request
+// fails anyway, so an error sending the notification is not reported.
+func (h *AccountHandler) sendAccountLockedEmail(ctx context.Context, c *fiber.Ctx, userID uuid.UUID) {
+	if config.GetString("ENABLE_MAIL") != "true" {
+		return
+	}
+	user, err := h.userService.GetUser(ctx, userID)
+	if err != nil {
+		return
+	}
+	_ = h.mailer.SendMail(templates.GetAccountLockedEmail(
+		h.i18n, user, config.GetInt("LOGIN_MAX_ATTEMPTS"), config.GetDuration("LOGIN_LOCKOUT_DURATION"), c.IP(),
+	))
+}
+
+// Gets the ID of the user making the request.
+func (h *AccountHandler) getCurrentUserID(c *fiber.Ctx) uuid.UUID {
+	return uuid.MustParse(c.Locals("currentUser").(string))
+}
+
+func (h *AccountHandler) getLangCode(c *fiber.Ctx) string {
+	return h.i18n.ParseLanguage(c.Get("Accept-Language"))
+}
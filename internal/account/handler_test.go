@@ -0,0 +1,228 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/session"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"github.com/jramsgz/articpad/pkg/hasher"
+	"github.com/jramsgz/articpad/pkg/i18n"
+)
+
+type testAccountApp struct {
+	app            *fiber.App
+	userRepository user.UserRepository
+	userService    user.UserService
+	sessionService session.SessionService
+	passwordHasher *hasher.Chain
+}
+
+func newTestAccountApp(t *testing.T) *testAccountApp {
+	t.Setenv("SECRET", "test-secret")
+	t.Setenv("ACCESS_TOKEN_TTL", "15m")
+	t.Setenv("ENABLE_MAIL", "false")
+
+	db := testdb.New(t, &user.User{}, &user.Identity{}, &user.RecoveryCode{}, &user.Credential{}, &user.APIToken{},
+		&user.Invite{}, &session.Session{}, &session.RefreshToken{}, &auth.RevokedToken{},
+		&note.Note{}, &note.Revision{}, &note.Notebook{}, &note.Tag{}, &note.Share{}, &note.PublicLink{})
+	passwordHasher := hasher.New(&hasher.Argon2id{Params: &argon2id.Params{
+		Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}})
+	userRepository := user.NewUserRepository(db)
+	userService := user.NewUserService(userRepository, user.LockoutPolicy{}, user.RegistrationPolicy{Mode: user.RegistrationOpen}, passwordHasher)
+	sessionService := session.NewSessionService(session.NewSessionRepository(db), time.Hour)
+	noteService := note.NewNoteService(note.NewNoteRepository(db))
+
+	translations := i18n.New()
+	if err := translations.Load([]byte(`{"_.code": "en", "_.name": "English (en)"}`), true); err != nil {
+		t.Fatalf("failed to load the translations: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			if apiError, ok := err.(*apierror.Error); ok {
+				return c.Status(apiError.Status).JSON(fiber.Map{"success": false, "error_code": apiError.Code})
+			}
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	})
+	NewAccountHandler(app.Group("/users"), userService, noteService, sessionService, auth.NewTokenDenylist(db, nil), nil, translations)
+
+	return &testAccountApp{app: app, userRepository: userRepository, userService: userService, sessionService: sessionService, passwordHasher: passwordHasher}
+}
+
+// createUser creates a user with the given password.
+func (a *testAccountApp) createUser(t *testing.T, username string, password string) *user.User {
+	hashedPassword, err := a.passwordHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("failed to hash the password: %v", err)
+	}
+	u := &user.User{Username: username, Email: username + "@example.com", Password: hashedPassword, Lang: "en"}
+	if err := a.userRepository.CreateUser(context.Background(), u); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return u
+}
+
+// signIn creates a session of a user, returning an access token of the session.
+func (a *testAccountApp) signIn(t *testing.T, u *user.User) string {
+	s, _, err := a.sessionService.CreateSession(context.Background(), u.ID, "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":   u.ID.String(),
+		"user":  u.Username,
+		"admin": false,
+		"sid":   s.ID.String(),
+		"jti":   uuid.New().String(),
+		"aud":   []string{"articpad-users"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(config.GetString("SECRET")))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// request sends a request with the given access token and JSON body, returning the status and the error
+// code of the response.
+func (a *testAccountApp) request(t *testing.T, method string, path string, token string, body string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+
+	var response struct {
+		ErrorCode string `json:"error_code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response.ErrorCode
+}
+
+func TestChangePasswordSignsOutOtherSessions(t *testing.T) {
+	a := newTestAccountApp(t)
+	u := a.createUser(t, "member", "Sup3r$ecretPass")
+	token, otherToken := a.signIn(t, u), a.signIn(t, u)
+
+	status, code := a.request(t, fiber.MethodPut, "/users/me/password", token, `{"current_password": "wrong", "new_password": "An0ther$ecretPass"}`)
+	if status != fiber.StatusUnprocessableEntity || code != consts.ErrCodeIncorrectPassword {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnprocessableEntity, consts.ErrCodeIncorrectPassword, status, code)
+	}
+
+	status, _ = a.request(t, fiber.MethodPut, "/users/me/password", token, `{"current_password": "Sup3r$ecretPass", "new_password": "An0ther$ecretPass"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+
+	if status, _ := a.request(t, fiber.MethodGet, "/users/me", token, ""); status != fiber.StatusOK {
+		t.Errorf("expected the current session to be kept, got %d", status)
+	}
+	if status, code := a.request(t, fiber.MethodGet, "/users/me", otherToken, ""); status != fiber.StatusUnauthorized || code != consts.ErrCodeRevokedJWT {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnauthorized, consts.ErrCodeRevokedJWT, status, code)
+	}
+}
+
+func TestChangeEmailWithoutMail(t *testing.T) {
+	a := newTestAccountApp(t)
+	u := a.createUser(t, "member", "Sup3r$ecretPass")
+	token := a.signIn(t, u)
+
+	// Without mail, the new address cannot be confirmed by a link so it is changed right away.
+	status, _ := a.request(t, fiber.MethodPost, "/users/me/email", token, `{"email": "new@example.com", "password": "Sup3r$ecretPass"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+
+	updated, err := a.userService.GetUser(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Email != "new@example.com" {
+		t.Errorf("expected the email to be changed, got %s", updated.Email)
+	}
+}
+
+func TestExportData(t *testing.T) {
+	a := newTestAccountApp(t)
+	u := a.createUser(t, "member", "Sup3r$ecretPass")
+	token := a.signIn(t, u)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/users/me/export", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the export: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("expected a complete archive, got %v", err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	expected := "profile.json notes.json revisions.json tags.json notebooks.json shares.json public_links.json sessions.json"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("expected the files %s, got %v", expected, names)
+	}
+
+	profile, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := io.ReadAll(profile)
+	if !strings.Contains(string(content), `"username": "member"`) || strings.Contains(string(content), "argon2id") {
+		t.Errorf("expected the profile without the password hash, got %s", content)
+	}
+}
+
+func TestDeleteAccountSignsOutEverySession(t *testing.T) {
+	a := newTestAccountApp(t)
+	u := a.createUser(t, "member", "Sup3r$ecretPass")
+	token, otherToken := a.signIn(t, u), a.signIn(t, u)
+
+	if status, code := a.request(t, fiber.MethodDelete, "/users/me", token, `{"password": "wrong"}`); status != fiber.StatusUnprocessableEntity || code != consts.ErrCodeIncorrectPassword {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnprocessableEntity, consts.ErrCodeIncorrectPassword, status, code)
+	}
+
+	if status, _ := a.request(t, fiber.MethodDelete, "/users/me", token, `{"password": "Sup3r$ecretPass"}`); status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+
+	for _, token := range []string{token, otherToken} {
+		if status, code := a.request(t, fiber.MethodGet, "/users/me", token, ""); status != fiber.StatusUnauthorized || code != consts.ErrCodeRevokedJWT {
+			t.Errorf("expected %d %s, got %d %s", fiber.StatusUnauthorized, consts.ErrCodeRevokedJWT, status, code)
+		}
+	}
+	// The account is kept during the grace period, but cannot be used anymore.
+	if _, err := a.userService.GetUser(context.Background(), u.ID); err == nil {
+		t.Error("expected the account to be disabled")
+	}
+}
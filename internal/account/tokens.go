@@ -0,0 +1,83 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Gets the personal API tokens of the current user, without the tokens themselves.
+func (h *AccountHandler) getAPITokens(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tokens, err := h.userService.GetAPITokens(customContext, h.getCurrentUserID(c))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"tokens":  tokens,
+	})
+}
+
+// Creates a personal API token for the current user. The token is only included in this response.
+func (h *AccountHandler) createAPIToken(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	apiToken, token, err := h.userService.CreateAPIToken(customContext, h.getCurrentUserID(c), request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success":   true,
+		"message":   h.i18n.T(h.getLangCode(c), "messages.api_token_created"),
+		"token":     token,
+		"api_token": apiToken,
+	})
+}
+
+// Deletes a personal API token of the current user, it stops working right away.
+func (h *AccountHandler) deleteAPIToken(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	tokenID, err := uuid.Parse(c.Params("tokenID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.userService.DeleteAPIToken(customContext, h.getCurrentUserID(c), tokenID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeAPITokenNotFound, h.i18n.T(langCode, "errors.api_token_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.api_token_deleted"),
+	})
+}
@@ -0,0 +1,310 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/session"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	"gorm.io/gorm"
+)
+
+// Maximum number of users that can be requested in a single page.
+const maxPerPage = 100
+
+type AdminHandler struct {
+	userService    user.UserService
+	sessionService session.SessionService
+	denylist       auth.TokenDenylist
+	i18n           *i18n.I18n
+}
+
+// Representation of a user for administrators, including the state of their account.
+type userView struct {
+	*user.User
+	Verified            bool       `json:"verified"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at"`
+	LockedUntil         *time.Time `json:"locked_until"`
+}
+
+// Creates a new administration handler.
+func NewAdminHandler(adminRoute fiber.Router, us user.UserService, ss session.SessionService, denylist auth.TokenDenylist, i18n *i18n.I18n) {
+	handler := &AdminHandler{
+		userService:    us,
+		sessionService: ss,
+		denylist:       denylist,
+		i18n:           i18n,
+	}
+
+	adminRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT, auth.AdminMiddleware)
+
+	adminRoute.Get("/users", handler.getUsers)
+	adminRoute.Get("/users/:userID", handler.getUser)
+	adminRoute.Put("/users/:userID/admin", handler.setAdmin)
+	adminRoute.Post("/users/:userID/verify", handler.verifyUser)
+	adminRoute.Post("/users/:userID/disable", handler.disableUser)
+	adminRoute.Post("/users/:userID/restore", handler.restoreUser)
+	adminRoute.Delete("/users/:userID", handler.deleteUser)
+	adminRoute.Get("/invites", handler.getInvites)
+	adminRoute.Post("/invites", handler.createInvite)
+	adminRoute.Delete("/invites/:inviteID", handler.deleteInvite)
+}
+
+// Gets a page of users, optionally filtered by a search term and the state of their account.
+func (h *AdminHandler) getUsers(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := &user.ListOptions{
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", 20),
+		Search:  c.Query("search"),
+		Status:  c.Query("status", "active"),
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+		opts.PerPage = maxPerPage
+	}
+	if opts.Status != "active" && opts.Status != "disabled" && opts.Status != "all" {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "status must be either 'active', 'disabled' or 'all'")
+	}
+
+	users, total, err := h.userService.GetUsersPage(customContext, opts)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	views := make([]userView, len(*users))
+	for i := range *users {
+		views[i] = newUserView(&(*users)[i])
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"users":    views,
+		"page":     opts.Page,
+		"per_page": opts.PerPage,
+		"total":    total,
+	})
+}
+
+// Gets a single user, even if it has been disabled.
+func (h *AdminHandler) getUser(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	user, err := h.userService.GetUserUnscoped(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"user":    newUserView(user),
+	})
+}
+
+// Promotes a user to administrator or demotes them.
+func (h *AdminHandler) setAdmin(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		IsAdmin bool `json:"is_admin"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getTargetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.userService.SetAdmin(customContext, userID, request.IsAdmin)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	// The role is stored in the JWTs, so demoted users are signed out to lose it right away.
+	if !request.IsAdmin {
+		if err := h.signOutUser(customContext, userID); err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.user_updated"),
+	})
+}
+
+// Verifies the email of a user.
+func (h *AdminHandler) verifyUser(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.userService.ForceVerifyUser(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.user_updated"),
+	})
+}
+
+// Disables a user and signs them out. Their data is kept so they can be restored.
+func (h *AdminHandler) disableUser(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getTargetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.userService.DisableUser(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	if err := h.signOutUser(customContext, userID); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.user_disabled"),
+	})
+}
+
+// Restores a disabled user.
+func (h *AdminHandler) restoreUser(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.userService.RestoreUser(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.user_restored"),
+	})
+}
+
+// Permanently deletes a user along with all their data.
+func (h *AdminHandler) deleteUser(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getTargetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.signOutUser(customContext, userID); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	err = h.userService.HardDeleteUser(customContext, userID)
+	if err != nil {
+		return h.mapUserError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.user_deleted"),
+	})
+}
+
+// Revokes every session of a user along with their access tokens.
+func (h *AdminHandler) signOutUser(ctx context.Context, userID uuid.UUID) error {
+	sessionIDs, err := h.sessionService.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := auth.DenySession(ctx, h.denylist, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Gets the ID of the user targeted by the request. Administrators cannot target themselves
+// so they do not lock themselves out.
+func (h *AdminHandler) getTargetUserID(c *fiber.Ctx) (uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return uuid.Nil, apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	if userID.String() == c.Locals("currentUser").(string) {
+		return uuid.Nil, consts.MapApiError(errors.New(consts.ErrCannotModifyOwnAccount), h.i18n, h.getLangCode(c))
+	}
+
+	return userID, nil
+}
+
+// mapUserError maps the errors returned by the user service to API errors.
+func (h *AdminHandler) mapUserError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeUserNotFound, h.i18n.T(h.getLangCode(c), "errors.user_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
+
+func (h *AdminHandler) getLangCode(c *fiber.Ctx) string {
+	return h.i18n.ParseLanguage(c.Get("Accept-Language"))
+}
+
+// Builds the representation of a user for administrators.
+func newUserView(u *user.User) userView {
+	view := userView{
+		User:     u,
+		Verified: u.VerifiedAt.Valid,
+	}
+	if u.DeletedAt.Valid {
+		view.DisabledAt = &u.DeletedAt.Time
+	}
+	if u.DeletionRequestedAt.Valid {
+		view.DeletionRequestedAt = &u.DeletionRequestedAt.Time
+	}
+	if u.LockedUntil.Valid && u.LockedUntil.Time.After(time.Now()) {
+		view.LockedUntil = &u.LockedUntil.Time
+	}
+	return view
+}
@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/session"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+)
+
+type testAdminApp struct {
+	app            *fiber.App
+	userRepository user.UserRepository
+	userService    user.UserService
+	sessionService session.SessionService
+}
+
+func newTestAdminApp(t *testing.T) *testAdminApp {
+	t.Setenv("SECRET", "test-secret")
+	t.Setenv("ACCESS_TOKEN_TTL", "15m")
+
+	db := testdb.New(t, &user.User{}, &user.Identity{}, &user.RecoveryCode{}, &user.Credential{}, &user.APIToken{},
+		&user.Invite{}, &session.Session{}, &session.RefreshToken{}, &auth.RevokedToken{})
+	userRepository := user.NewUserRepository(db)
+	userService := user.NewUserService(userRepository, user.LockoutPolicy{}, user.RegistrationPolicy{Mode: user.RegistrationOpen}, nil)
+	sessionService := session.NewSessionService(session.NewSessionRepository(db), time.Hour)
+
+	translations := i18n.New()
+	if err := translations.Load([]byte(`{"_.code": "en", "_.name": "English (en)"}`), true); err != nil {
+		t.Fatalf("failed to load the translations: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			if apiError, ok := err.(*apierror.Error); ok {
+				return c.Status(apiError.Status).JSON(fiber.Map{"success": false, "error_code": apiError.Code})
+			}
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	})
+	NewAdminHandler(app.Group("/admin"), userService, sessionService, auth.NewTokenDenylist(db, nil), translations)
+
+	return &testAdminApp{app: app, userRepository: userRepository, userService: userService, sessionService: sessionService}
+}
+
+// createUser creates a user signed in on a session, returning it along with an access token of the session.
+func (a *testAdminApp) createUser(t *testing.T, username string, isAdmin bool) (*user.User, string) {
+	ctx := context.Background()
+	u := &user.User{Username: username, Email: username + "@example.com", Password: "hash", Lang: "en", IsAdmin: isAdmin}
+	if err := a.userRepository.CreateUser(ctx, u); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	s, _, err := a.sessionService.CreateSession(ctx, u.ID, "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":   u.ID.String(),
+		"user":  u.Username,
+		"admin": isAdmin,
+		"sid":   s.ID.String(),
+		"jti":   uuid.New().String(),
+		"aud":   []string{"articpad-users"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(config.GetString("SECRET")))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return u, token
+}
+
+// request sends a request with the given access token and JSON body, returning the status and the error
+// code of the response.
+func (a *testAdminApp) request(t *testing.T, method string, path string, token string, body string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+
+	var response struct {
+		ErrorCode string `json:"error_code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response.ErrorCode
+}
+
+func TestAdminRequiresAdministrator(t *testing.T) {
+	a := newTestAdminApp(t)
+	_, token := a.createUser(t, "member", false)
+
+	if status, code := a.request(t, fiber.MethodGet, "/admin/users", token, ""); status != fiber.StatusForbidden || code != consts.ErrCodeForbidden {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusForbidden, consts.ErrCodeForbidden, status, code)
+	}
+}
+
+func TestAdminCannotModifyOwnAccount(t *testing.T) {
+	a := newTestAdminApp(t)
+	admin, token := a.createUser(t, "admin", true)
+
+	status, code := a.request(t, fiber.MethodPost, "/admin/users/"+admin.ID.String()+"/disable", token, "")
+	if status != fiber.StatusUnprocessableEntity || code != consts.ErrCodeCannotModifyOwnAccount {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnprocessableEntity, consts.ErrCodeCannotModifyOwnAccount, status, code)
+	}
+}
+
+func TestAdminDisableAndRestoreUser(t *testing.T) {
+	a := newTestAdminApp(t)
+	_, adminToken := a.createUser(t, "admin", true)
+	target, targetToken := a.createUser(t, "target", true)
+
+	if status, _ := a.request(t, fiber.MethodGet, "/admin/users", targetToken, ""); status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+	if status, _ := a.request(t, fiber.MethodPost, "/admin/users/"+target.ID.String()+"/disable", adminToken, ""); status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+
+	// Disabled users are signed out right away.
+	if status, code := a.request(t, fiber.MethodGet, "/admin/users", targetToken, ""); status != fiber.StatusUnauthorized || code != consts.ErrCodeRevokedJWT {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnauthorized, consts.ErrCodeRevokedJWT, status, code)
+	}
+
+	if status, _ := a.request(t, fiber.MethodPost, "/admin/users/"+target.ID.String()+"/restore", adminToken, ""); status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+	if status, code := a.request(t, fiber.MethodPost, "/admin/users/"+target.ID.String()+"/restore", adminToken, ""); status != fiber.StatusConflict || code != consts.ErrCodeUserNotDisabled {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusConflict, consts.ErrCodeUserNotDisabled, status, code)
+	}
+	if _, err := a.userService.GetUser(context.Background(), target.ID); err != nil {
+		t.Errorf("expected the user to be restored, got %v", err)
+	}
+}
+
+func TestAdminDemotionSignsOutUser(t *testing.T) {
+	a := newTestAdminApp(t)
+	_, adminToken := a.createUser(t, "admin", true)
+	target, targetToken := a.createUser(t, "target", true)
+
+	if status, _ := a.request(t, fiber.MethodPut, "/admin/users/"+target.ID.String()+"/admin", adminToken, `{"is_admin": false}`); status != fiber.StatusOK {
+		t.Fatalf("expected %d, got %d", fiber.StatusOK, status)
+	}
+
+	// The role is stored in the access tokens, so they stop working.
+	if status, code := a.request(t, fiber.MethodGet, "/admin/users", targetToken, ""); status != fiber.StatusUnauthorized || code != consts.ErrCodeRevokedJWT {
+		t.Errorf("expected %d %s, got %d %s", fiber.StatusUnauthorized, consts.ErrCodeRevokedJWT, status, code)
+	}
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Gets all the invites, both used and unused, without their codes.
+func (h *AdminHandler) getInvites(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	invites, err := h.userService.GetInvites(customContext)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"invites": invites,
+	})
+}
+
+// Creates a single-use invite to register when registration is invite-only, optionally for a
+// single email address. The code is only included in this response.
+func (h *AdminHandler) createInvite(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Email     string     `json:"email"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	currentUserID, err := uuid.Parse(c.Locals("currentUser").(string))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	invite, code, err := h.userService.CreateInvite(customContext, currentUserID, request.Email, request.ExpiresAt)
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.invite_created"),
+		"code":    code,
+		"invite":  invite,
+	})
+}
+
+// Deletes an invite, used invites are only removed from the list.
+func (h *AdminHandler) deleteInvite(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	inviteID, err := uuid.Parse(c.Params("inviteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.userService.DeleteInvite(customContext, inviteID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeInviteNotFound, h.i18n.T(langCode, "errors.invite_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.invite_deleted"),
+	})
+}
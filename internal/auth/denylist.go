@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Prefix of the keys used to store revoked tokens in a fiber.Storage.
+const denylistKeyPrefix = "jwt_denylist:"
+
+// Represents a JWT that has been revoked before its expiration.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// TokenDenylist keeps track of revoked JWTs until they expire. Tokens are identified by their 'jti'
+// claim, or by their 'sid' claim to revoke every token issued for a session.
+type TokenDenylist interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// Creates a new denylist. The given storage (e.g. Redis) is used if not nil, otherwise
+// revoked tokens are stored in the database so they are shared between processes.
+func NewTokenDenylist(dbConnection *gorm.DB, storage fiber.Storage) TokenDenylist {
+	if storage != nil {
+		return &storageDenylist{storage: storage}
+	}
+	return &dbDenylist{db: dbConnection}
+}
+
+// Revokes every JWT issued for a session. They are valid for at most ACCESS_TOKEN_TTL,
+// so the session only needs to stay in the denylist for that long.
+func DenySession(ctx context.Context, denylist TokenDenylist, sessionID uuid.UUID) error {
+	return denylist.Revoke(ctx, sessionID.String(), time.Now().Add(config.GetDuration("ACCESS_TOKEN_TTL")))
+}
+
+// Denylist backed by a fiber.Storage, entries are expired by the storage itself.
+type storageDenylist struct {
+	storage fiber.Storage
+}
+
+// Revokes a token until it expires.
+func (d *storageDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.storage.Set(denylistKeyPrefix+jti, []byte{1}, ttl)
+}
+
+// Checks whether a token has been revoked.
+func (d *storageDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	value, err := d.storage.Get(denylistKeyPrefix + jti)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Denylist backed by the database, expired entries are purged when new ones are added.
+type dbDenylist struct {
+	db *gorm.DB
+}
+
+// Revokes a token until it expires.
+func (d *dbDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if !expiresAt.After(time.Now()) {
+		return nil
+	}
+
+	result := d.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&RevokedToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	})
+	return result.Error
+}
+
+// Checks whether a token has been revoked.
+func (d *dbDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+
+	result := d.db.WithContext(ctx).Model(&RevokedToken{}).Where("jti = ? AND expires_at > ?", jti, time.Now()).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return count > 0, nil
+}
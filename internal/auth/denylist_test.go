@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+)
+
+// fakeStorage keeps values in memory, along with their expiration.
+type fakeStorage struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{values: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+func (s *fakeStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expires, ok := s.expires[key]; ok && !expires.After(time.Now()) {
+		return nil, nil
+	}
+	return s.values[key], nil
+}
+
+func (s *fakeStorage) Set(key string, val []byte, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = val
+	if exp > 0 {
+		s.expires[key] = time.Now().Add(exp)
+	}
+	return nil
+}
+
+func (s *fakeStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	delete(s.expires, key)
+	return nil
+}
+
+func (s *fakeStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values, s.expires = map[string][]byte{}, map[string]time.Time{}
+	return nil
+}
+
+func (s *fakeStorage) Close() error {
+	return nil
+}
+
+func TestTokenDenylist(t *testing.T) {
+	storage := newFakeStorage()
+	denylists := map[string]TokenDenylist{
+		"database": NewTokenDenylist(testdb.New(t, &RevokedToken{}), nil),
+		"storage":  NewTokenDenylist(nil, storage),
+	}
+
+	for name, denylist := range denylists {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			revoked, expired := uuid.NewString(), uuid.NewString()
+
+			if err := denylist.Revoke(ctx, revoked, time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Tokens that have already expired do not need to be revoked.
+			if err := denylist.Revoke(ctx, expired, time.Now().Add(-time.Second)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for jti, expected := range map[string]bool{revoked: true, expired: false, uuid.NewString(): false} {
+				isRevoked, err := denylist.IsRevoked(ctx, jti)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if isRevoked != expected {
+					t.Errorf("expected %s to be revoked: %t, got %t", jti, expected, isRevoked)
+				}
+			}
+		})
+	}
+
+	// Revoked tokens are only kept in the given storage, if any.
+	if len(storage.values) != 1 {
+		t.Errorf("expected 1 revoked token in the storage, got %d", len(storage.values))
+	}
+}
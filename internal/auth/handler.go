@@ -3,53 +3,97 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/session"
 	"github.com/jramsgz/articpad/internal/user"
 	"github.com/jramsgz/articpad/internal/utils/consts"
 	"github.com/jramsgz/articpad/internal/utils/templates"
 	"github.com/jramsgz/articpad/pkg/apierror"
-	"github.com/jramsgz/articpad/pkg/argon2id"
 	"github.com/jramsgz/articpad/pkg/i18n"
 	mailClient "github.com/jramsgz/articpad/pkg/mail"
+	"github.com/jramsgz/articpad/pkg/oidc"
+	"github.com/jramsgz/articpad/pkg/validator"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	userService user.UserService
-	mailer      *mailClient.Mailer
-	i18n        *i18n.I18n
+	userService    user.UserService
+	sessionService session.SessionService
+	denylist       TokenDenylist
+	oidcProvider   *oidc.Provider
+	webauthn       *webauthn.WebAuthn
+	mailer         *mailClient.Mailer
+	i18n           *i18n.I18n
 }
 
+const (
+	// Audience of the JWTs that give access to the API.
+	accessTokenAudience = "articpad-users"
+	// Audience of the JWTs given to users that still have to provide a two-factor authentication code.
+	challengeTokenAudience = "articpad-2fa"
+	// Time users have to provide a two-factor authentication code after entering their password.
+	challengeTokenTTL = 5 * time.Minute
+)
+
 type jwtClaims struct {
-	UserID string `json:"uid"`
-	User   string `json:"user"`
-	UserIP string `json:"user_ip"`
+	UserID    string `json:"uid"`
+	User      string `json:"user"`
+	IsAdmin   bool   `json:"admin"`
+	UserIP    string `json:"user_ip"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 // Creates a new authentication handler.
-func NewAuthHandler(authRoute fiber.Router, us user.UserService, mail *mailClient.Mailer, i18n *i18n.I18n) {
+func NewAuthHandler(authRoute fiber.Router, us user.UserService, ss session.SessionService, denylist TokenDenylist, oidcProvider *oidc.Provider, webAuthn *webauthn.WebAuthn, mail *mailClient.Mailer, i18n *i18n.I18n) {
 	handler := &AuthHandler{
-		userService: us,
-		mailer:      mail,
-		i18n:        i18n,
+		userService:    us,
+		sessionService: ss,
+		denylist:       denylist,
+		oidcProvider:   oidcProvider,
+		webauthn:       webAuthn,
+		mailer:         mail,
+		i18n:           i18n,
 	}
 
 	authRoute.Post("/login", handler.signInUser)
 	authRoute.Post("/register", handler.signUpUser)
-	authRoute.Post("/logout", JWTMiddleware(), handler.logOutUser) // TODO
+	authRoute.Get("/policy", handler.getPolicy)
+	authRoute.Post("/logout", JWTMiddleware(denylist, nil), handler.logOutUser)
 	authRoute.Post("/resend", handler.resendVerificationEmail)
 	authRoute.Get("/verify/:token", handler.verifyUser)
 	authRoute.Post("/forgot", handler.forgotPassword)
 	authRoute.Post("/reset", handler.resetPassword)
-	authRoute.Get("/refresh", JWTMiddleware(), handler.refreshToken) // TODO
-	authRoute.Get("/me", JWTMiddleware(), handler.getMe)             // TODO
-	authRoute.Get("/test", handler.test)                             // TODO
+	authRoute.Post("/magic", handler.sendMagicLink)
+	authRoute.Get("/magic/:token", handler.signInWithMagicLink)
+	authRoute.Post("/refresh", handler.refreshToken)
+	authRoute.Get("/sessions", JWTMiddleware(denylist, nil), handler.getSessions)
+	authRoute.Delete("/sessions", JWTMiddleware(denylist, nil), handler.revokeOtherSessions)
+	authRoute.Delete("/sessions/:sessionID", JWTMiddleware(denylist, nil), handler.revokeSession)
+	authRoute.Post("/2fa/verify", handler.verifyTwoFactor)
+	authRoute.Post("/2fa/setup", JWTMiddleware(denylist, nil), handler.setupTwoFactor)
+	authRoute.Post("/2fa/enable", JWTMiddleware(denylist, nil), handler.enableTwoFactor)
+	authRoute.Post("/2fa/disable", JWTMiddleware(denylist, nil), handler.disableTwoFactor)
+	authRoute.Post("/2fa/recovery-codes", JWTMiddleware(denylist, nil), handler.regenerateRecoveryCodes)
+	authRoute.Post("/webauthn/register/begin", JWTMiddleware(denylist, nil), handler.beginWebAuthnRegistration)
+	authRoute.Post("/webauthn/register/finish", JWTMiddleware(denylist, nil), handler.finishWebAuthnRegistration)
+	authRoute.Get("/webauthn/credentials", JWTMiddleware(denylist, nil), handler.getWebAuthnCredentials)
+	authRoute.Delete("/webauthn/credentials/:credentialID", JWTMiddleware(denylist, nil), handler.deleteWebAuthnCredential)
+	authRoute.Post("/webauthn/login/begin", handler.beginWebAuthnLogin)
+	authRoute.Post("/webauthn/login/finish", handler.finishWebAuthnLogin)
+	authRoute.Get("/oidc", handler.getOIDCStatus)
+	authRoute.Get("/oidc/login", handler.startOIDCLogin)
+	authRoute.Get("/oidc/callback", handler.finishOIDCLogin)
+	authRoute.Get("/me", JWTMiddleware(denylist, nil), handler.getMe) // TODO
+	authRoute.Get("/test", handler.test)                              // TODO
 }
 
 func (h *AuthHandler) test(c *fiber.Ctx) error {
@@ -81,10 +125,12 @@ func (h *AuthHandler) signInUser(c *fiber.Ctx) error {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
 
-	if ok, err := argon2id.ComparePasswordAndHash(request.Password, user.Password); err != nil {
-		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
-	} else if !ok {
-		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidCredentials, h.i18n.T(langCode, "errors.invalid_credentials"))
+	locked, err := h.userService.CheckPassword(customContext, user, request.Password)
+	if locked {
+		h.sendAccountLockedEmail(c, user)
+	}
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, langCode)
 	}
 
 	if config.GetString("ENABLE_MAIL") == "true" {
@@ -93,24 +139,64 @@ func (h *AuthHandler) signInUser(c *fiber.Ctx) error {
 		}
 	}
 
-	signedToken, err := newJWTToken(user.ID.String(), user.Username, c.IP())
+	twoFactorMethods, err := h.getTwoFactorMethods(customContext, user)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if len(twoFactorMethods) > 0 {
+		return h.requestTwoFactor(c, user, twoFactorMethods)
+	}
+
+	return h.startSession(customContext, c, user)
+}
+
+// Creates a new session for a user that has been authenticated and responds with its tokens.
+func (h *AuthHandler) startSession(ctx context.Context, c *fiber.Ctx, user *user.User) error {
+	signedToken, refreshToken, err := h.createSession(ctx, c, user)
 	if err != nil {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
 
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
-		"success": true,
-		"token":   signedToken,
-		"user":    user,
+		"success":       true,
+		"token":         signedToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.GetDuration("ACCESS_TOKEN_TTL").Seconds()),
+		"user":          user,
+	})
+}
+
+// Creates a new session for a user and returns its JWT and refresh token.
+func (h *AuthHandler) createSession(ctx context.Context, c *fiber.Ctx, user *user.User) (string, string, error) {
+	userSession, refreshToken, err := h.sessionService.CreateSession(ctx, user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return "", "", err
+	}
+
+	signedToken, err := newJWTToken(user.ID.String(), user.Username, user.IsAdmin, c.IP(), userSession.ID.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	return signedToken, refreshToken, nil
+}
+
+// Gets the rules usernames and passwords must follow and who can create an account.
+func (h *AuthHandler) getPolicy(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":      true,
+		"policy":       validator.DefaultPolicy,
+		"registration": h.userService.GetRegistrationPolicy(),
 	})
 }
 
 // Signs up a user and gives them a JWT.
 func (h *AuthHandler) signUpUser(c *fiber.Ctx) error {
 	type registerRequest struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	customContext, cancel := context.WithCancel(context.Background())
@@ -123,26 +209,21 @@ func (h *AuthHandler) signUpUser(c *fiber.Ctx) error {
 
 	langCode := h.getLangCode(c)
 	user := &user.User{
-		Username:          request.Username,
-		Email:             request.Email,
-		Password:          request.Password,
-		VerifiedAt:        sql.NullTime{Valid: false, Time: time.Time{}},
-		VerificationToken: uuid.New().String(),
-		Lang:              langCode,
+		Username:   request.Username,
+		Email:      request.Email,
+		Password:   request.Password,
+		VerifiedAt: sql.NullTime{Valid: false, Time: time.Time{}},
+		Lang:       langCode,
 	}
 
-	err := h.userService.CreateUser(customContext, user)
+	err := h.userService.RegisterUser(customContext, user, request.InviteCode)
 	if err != nil {
 		return consts.MapApiError(err, h.i18n, langCode)
 	}
 
 	if config.GetString("ENABLE_MAIL") == "true" {
-		err := h.mailer.SendMail(templates.GetEmailVerificationEmail(h.i18n, user))
-		if err != nil {
-			return apierror.NewApiError(
-				fiber.StatusInternalServerError, consts.ErrCodeCannotSendVerificationEmail,
-				h.i18n.Ts(langCode, "errors.cannot_send_verification_email", "error", err.Error()),
-			).ShowError()
+		if err := h.sendVerificationEmail(customContext, langCode, user); err != nil {
+			return err
 		}
 	}
 
@@ -154,28 +235,155 @@ func (h *AuthHandler) signUpUser(c *fiber.Ctx) error {
 
 // Logs out a user.
 func (h *AuthHandler) logOutUser(c *fiber.Ctx) error {
-	// TODO: Invalidate JWT.
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := h.revokeJWT(customContext, c); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	sessionID := h.getSessionID(c)
+	if err := h.sessionService.RevokeSession(customContext, sessionID); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if err := h.denySession(customContext, sessionID); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
 		"success": true,
 		"message": "You have been logged out successfully",
 	})
 }
 
-// Refreshes a JWT.
+// Exchanges a refresh token for a new JWT and refresh token.
 func (h *AuthHandler) refreshToken(c *fiber.Ctx) error {
-	jwtData := c.Locals("user").(*jwt.Token)
-	claims := jwtData.Claims.(jwt.MapClaims)
+	type RequestPayload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	userSession, refreshToken, err := h.sessionService.RotateRefreshToken(customContext, request.RefreshToken, c.IP())
+	if err != nil {
+		if userSession != nil {
+			// The session was revoked because the refresh token was reused.
+			if err := h.denySession(customContext, userSession.ID); err != nil {
+				return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+			}
+		}
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	user, err := h.userService.GetUser(customContext, userSession.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeAccountNotFound, h.i18n.T(langCode, "errors.account_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	signedToken, err := newJWTToken(user.ID.String(), user.Username, user.IsAdmin, c.IP(), userSession.ID.String())
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":       true,
+		"token":         signedToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.GetDuration("ACCESS_TOKEN_TTL").Seconds()),
+	})
+}
+
+// Gets the active sessions of the current user.
+func (h *AuthHandler) getSessions(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	sessions, err := h.sessionService.GetActiveSessions(customContext, uuid.MustParse(userID))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	currentSessionID := h.getSessionID(c)
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].ID == currentSessionID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"sessions": sessions,
+	})
+}
+
+// Signs out a single session of the current user.
+func (h *AuthHandler) revokeSession(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	sessionID, err := uuid.Parse(c.Params("sessionID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.sessionService.RevokeUserSession(customContext, uuid.MustParse(userID), sessionID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeSessionNotFound, h.i18n.T(langCode, "errors.session_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	if err := h.denySession(customContext, sessionID); err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.session_revoked"),
+	})
+}
+
+// Signs out every session of the current user except the one making the request.
+func (h *AuthHandler) revokeOtherSessions(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	signedToken, err := newJWTToken(claims["uid"].(string), claims["user"].(string), claims["user_ip"].(string))
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	sessionIDs, err := h.sessionService.RevokeOtherSessions(customContext, uuid.MustParse(userID), h.getSessionID(c))
 	if err != nil {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
 
-	// TODO: Invalidate old JWT.
+	for _, sessionID := range sessionIDs {
+		if err := h.denySession(customContext, sessionID); err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+	}
 
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
 		"success": true,
-		"token":   signedToken,
+		"message": h.i18n.Tsc(h.getLangCode(c), "messages.sessions_revoked", len(sessionIDs), "count", strconv.Itoa(len(sessionIDs))),
 	})
 }
 
@@ -233,7 +441,30 @@ func (h *AuthHandler) resendVerificationEmail(c *fiber.Ctx) error {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
 
-	err = h.mailer.SendMail(templates.GetEmailVerificationEmail(h.i18n, user))
+	if user.VerifiedAt.Valid {
+		return consts.MapApiError(errors.New(consts.ErrEmailAlreadyVerified), h.i18n, langCode)
+	}
+
+	// A new token is sent each time, so links in previous emails stop working.
+	if err := h.sendVerificationEmail(customContext, langCode, user); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.verification_email_sent"),
+	})
+}
+
+// Creates a new verification token for a user, invalidating the previous one, and sends it to them by email.
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, langCode string, user *user.User) error {
+	expiresAt := time.Now().Add(config.GetDuration("EMAIL_VERIFICATION_TTL"))
+	token, err := h.userService.CreateVerificationToken(ctx, user.ID, expiresAt)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	err = h.mailer.SendMail(templates.GetEmailVerificationEmail(h.i18n, user, token))
 	if err != nil {
 		return apierror.NewApiError(
 			fiber.StatusInternalServerError, consts.ErrCodeCannotSendVerificationEmail,
@@ -241,10 +472,7 @@ func (h *AuthHandler) resendVerificationEmail(c *fiber.Ctx) error {
 		).ShowError()
 	}
 
-	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
-		"success": true,
-		"message": h.i18n.T(langCode, "messages.verification_email_sent"),
-	})
+	return nil
 }
 
 // Verifies a user's email and activates their account.
@@ -297,9 +525,8 @@ func (h *AuthHandler) forgotPassword(c *fiber.Ctx) error {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
 
-	token := uuid.New().String()
 	expiresAt := time.Now().Add(time.Hour * 4)
-	err = h.userService.SetPasswordResetToken(customContext, user.ID, token, expiresAt)
+	token, err := h.userService.CreatePasswordResetToken(customContext, user.ID, expiresAt)
 	if err != nil {
 		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
 	}
@@ -373,18 +600,64 @@ func (h *AuthHandler) getUser(c *fiber.Ctx) error {
 	})
 }
 
+// Revokes the JWT used to authenticate the current request until it expires.
+func (h *AuthHandler) revokeJWT(ctx context.Context, c *fiber.Ctx) error {
+	jwtData := c.Locals("user").(*jwt.Token)
+	claims := jwtData.Claims.(jwt.MapClaims)
+
+	expiresAt, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New(consts.ErrInvalidTokenExpiration)
+	}
+
+	return h.denylist.Revoke(ctx, claims["jti"].(string), time.Unix(int64(expiresAt), 0))
+}
+
+// Revokes every JWT issued for a session.
+func (h *AuthHandler) denySession(ctx context.Context, sessionID uuid.UUID) error {
+	return DenySession(ctx, h.denylist, sessionID)
+}
+
+// Gets the ID of the session the JWT used by the current request was issued for.
+func (h *AuthHandler) getSessionID(c *fiber.Ctx) uuid.UUID {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	return uuid.MustParse(claims["sid"].(string))
+}
+
+// Notifies a user that their account has been locked after too many failed attempts. The request
+// fails anyway, so an error sending the notification is not reported.
+func (h *AuthHandler) sendAccountLockedEmail(c *fiber.Ctx, user *user.User) {
+	if config.GetString("ENABLE_MAIL") != "true" {
+		return
+	}
+	_ = h.mailer.SendMail(templates.GetAccountLockedEmail(
+		h.i18n, user, config.GetInt("LOGIN_MAX_ATTEMPTS"), config.GetDuration("LOGIN_LOCKOUT_DURATION"), c.IP(),
+	))
+}
+
+// Same as 'sendAccountLockedEmail', for the requests that only know the ID of the user.
+func (h *AuthHandler) sendAccountLockedEmailTo(ctx context.Context, c *fiber.Ctx, userID uuid.UUID) {
+	user, err := h.userService.GetUser(ctx, userID)
+	if err == nil {
+		h.sendAccountLockedEmail(c, user)
+	}
+}
+
 func (h *AuthHandler) getLangCode(c *fiber.Ctx) string {
 	return h.i18n.ParseLanguage(c.Get("Accept-Language"))
 }
 
-func newJWTToken(userId string, username string, userIP string) (string, error) {
+func newJWTToken(userId string, username string, isAdmin bool, userIP string, sessionID string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwtClaims{
 		userId,
 		username,
+		isAdmin,
 		userIP,
+		sessionID,
 		jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{"articpad-users"},
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ID:        uuid.New().String(),
+			Audience:  jwt.ClaimStrings{accessTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.GetDuration("ACCESS_TOKEN_TTL"))),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now().Add(time.Minute * -2)),
 			Issuer:    "articpad-api",
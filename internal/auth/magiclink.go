@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/templates"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Sends the user an email with a single-use link to sign in without their password.
+func (h *AuthHandler) sendMagicLink(c *fiber.Ctx) error {
+	langCode := h.getLangCode(c)
+
+	if config.GetString("ENABLE_MAIL") == "false" {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeMailNotEnabled, h.i18n.T(langCode, "errors.mail_not_enabled"))
+	}
+
+	type RequestPayload struct {
+		Login string `json:"login"`
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	user, err := h.userService.GetUserByEmailOrUsername(customContext, request.Login)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound || err.Error() == consts.ErrDeletedRecord {
+			return apierror.NewApiError(fiber.StatusUnprocessableEntity, consts.ErrCodeAccountNotFound, h.i18n.T(langCode, "errors.account_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	ttl := config.GetDuration("MAGIC_LINK_TTL")
+	token, err := h.userService.CreateMagicLink(customContext, user.ID, time.Now().Add(ttl))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	err = h.mailer.SendMail(templates.GetMagicLinkEmail(h.i18n, user, token, ttl))
+	if err != nil {
+		return apierror.NewApiError(
+			fiber.StatusInternalServerError, consts.ErrCodeCannotSendMagicLinkEmail,
+			h.i18n.Ts(langCode, "errors.cannot_send_magic_link_email", "error", err.Error()),
+		).ShowError()
+	}
+
+	minutes := int(ttl.Minutes())
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.Tsc(langCode, "messages.magic_link_sent", minutes, "minutes", strconv.Itoa(minutes)),
+	})
+}
+
+// Exchanges the token of a magic link for a new session, as the login endpoint does after
+// checking a password.
+func (h *AuthHandler) signInWithMagicLink(c *fiber.Ctx) error {
+	langCode := h.getLangCode(c)
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	user, err := h.userService.UseMagicLink(customContext, c.Params("token"))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidMagicLink, h.i18n.T(langCode, "errors.invalid_magic_link"))
+		}
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	twoFactorMethods, err := h.getTwoFactorMethods(customContext, user)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if len(twoFactorMethods) > 0 {
+		return h.requestTwoFactor(c, user, twoFactorMethods)
+	}
+
+	return h.startSession(customContext, c, user)
+}
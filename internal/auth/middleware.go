@@ -1,23 +1,188 @@
 package auth
 
 import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/user"
 	"github.com/jramsgz/articpad/internal/utils/consts"
 	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
 
 	"github.com/gofiber/fiber/v2"
 	jwtware "github.com/gofiber/jwt/v3"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// Guards a specific endpoint in the API.
-func JWTMiddleware() fiber.Handler {
+// Authenticates the personal API tokens of users, implemented by user.UserService.
+type APITokenAuthenticator interface {
+	AuthenticateAPIToken(ctx context.Context, token string, ipAddress string) (*user.User, *user.APIToken, error)
+}
+
+// Records the use of sessions, implemented by session.SessionService.
+type SessionUsageRecorder interface {
+	UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error
+}
+
+// How often the last use of a session is recorded, so every request does not cause a write.
+const sessionUsageInterval = time.Minute
+
+// Records the last use of the sessions whose access tokens authenticate requests. Registered before
+// the endpoints, it reads the claims stored by 'JWTMiddleware()' once the request has been handled.
+// Requests authenticated with personal API tokens are skipped, their use is recorded with the token.
+func SessionUsageMiddleware(sessions SessionUsageRecorder) fiber.Handler {
+	type sessionUse struct {
+		at        time.Time
+		ipAddress string
+	}
+
+	var mu sync.Mutex
+	lastUses := map[string]sessionUse{}
+	lastSweep := time.Now()
+
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		jwtData, ok := c.Locals("user").(*jwt.Token)
+		if !ok {
+			return err
+		}
+		claims, ok := jwtData.Claims.(jwt.MapClaims)
+		if !ok || !claims.VerifyAudience(accessTokenAudience, true) {
+			return err
+		}
+		sid, _ := claims["sid"].(string)
+		sessionID, parseErr := uuid.Parse(sid)
+		if parseErr != nil {
+			return err
+		}
+
+		now := time.Now()
+		ipAddress := c.IP()
+
+		mu.Lock()
+		if lastUse, found := lastUses[sid]; found && lastUse.ipAddress == ipAddress && now.Sub(lastUse.at) < sessionUsageInterval {
+			mu.Unlock()
+			return err
+		}
+		lastUses[sid] = sessionUse{at: now, ipAddress: ipAddress}
+		// Forget the sessions not used lately, they are recorded again on their next use.
+		if now.Sub(lastSweep) > sessionUsageInterval {
+			for id, lastUse := range lastUses {
+				if now.Sub(lastUse.at) > sessionUsageInterval {
+					delete(lastUses, id)
+				}
+			}
+			lastSweep = now
+		}
+		mu.Unlock()
+
+		// The request has already been handled, a failure is retried on the next use after the interval.
+		_ = sessions.UpdateSessionUsage(context.Background(), sessionID, ipAddress)
+		return err
+	}
+}
+
+// Guards a specific endpoint in the API. Personal API tokens are accepted as well as JWTs if
+// apiTokens is not nil, otherwise the endpoint is only available to sessions.
+func JWTMiddleware(denylist TokenDenylist, apiTokens APITokenAuthenticator) fiber.Handler {
+	jwtMiddleware := jwtware.New(jwtware.Config{
+		SigningKey:     []byte(config.GetString("SECRET")),
+		SuccessHandler: checkRevoked(denylist),
+		ErrorHandler:   jwtError,
+	})
+	if apiTokens == nil {
+		return jwtMiddleware
+	}
+
+	return func(c *fiber.Ctx) error {
+		token, found := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !found || !strings.HasPrefix(token, user.APITokenPrefix) {
+			return jwtMiddleware(c)
+		}
+		return checkAPIToken(c, apiTokens, token)
+	}
+}
+
+// Authenticates a request with a personal API token whose scopes allow it. The claims of the owner
+// of the token are stored as if they had sent a JWT, using the ID of the token as session ID.
+func checkAPIToken(c *fiber.Ctx, apiTokens APITokenAuthenticator, token string) error {
+	owner, apiToken, err := apiTokens.AuthenticateAPIToken(context.Background(), token, c.IP())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound || err.Error() == consts.ErrAPITokenExpired {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidAPIToken, "Invalid or expired API token")
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	scope := user.APITokenScopeWrite
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		scope = user.APITokenScopeRead
+	}
+	if !apiToken.HasScope(scope) {
+		return apierror.NewApiError(fiber.StatusForbidden, consts.ErrCodeInsufficientScope, "The API token does not have the '"+scope+"' scope")
+	}
+
+	c.Locals("user", &jwt.Token{
+		Valid: true,
+		Claims: jwt.MapClaims{
+			"uid":   owner.ID.String(),
+			"user":  owner.Username,
+			"admin": owner.IsAdmin && apiToken.HasScope(user.APITokenScopeAdmin),
+			"sid":   apiToken.ID.String(),
+			"jti":   apiToken.ID.String(),
+		},
+	})
+	return c.Next()
+}
+
+// Guards a WebSocket endpoint in the API. Browsers cannot set headers on the upgrade request,
+// so the JWT may also be passed in the 'token' query parameter.
+func WebSocketJWTMiddleware(denylist TokenDenylist) fiber.Handler {
 	return jwtware.New(jwtware.Config{
-		SigningKey:   []byte(config.GetString("SECRET")),
-		ErrorHandler: jwtError,
+		SigningKey:     []byte(config.GetString("SECRET")),
+		TokenLookup:    "header:Authorization,query:token",
+		AuthScheme:     "Bearer",
+		SuccessHandler: checkRevoked(denylist),
+		ErrorHandler:   jwtError,
 	})
 }
 
+// Rejects tokens not meant to access the API, without 'jti' and 'sid' claims or that have been
+// revoked, either by themselves or because their session has been revoked.
+func checkRevoked(denylist TokenDenylist) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		jwtData := c.Locals("user").(*jwt.Token)
+		claims := jwtData.Claims.(jwt.MapClaims)
+
+		if !claims.VerifyAudience(accessTokenAudience, true) {
+			return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeInvalidJWT, "Invalid or expired JWT")
+		}
+
+		jti, _ := claims["jti"].(string)
+		sid, _ := claims["sid"].(string)
+		if jti == "" || sid == "" {
+			return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeInvalidJWT, "Invalid or expired JWT")
+		}
+
+		for _, id := range []string{jti, sid} {
+			revoked, err := denylist.IsRevoked(context.Background(), id)
+			if err != nil {
+				return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+			}
+			if revoked {
+				return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeRevokedJWT, "JWT has been revoked")
+			}
+		}
+
+		return c.Next()
+	}
+}
+
 // JWT error message.
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
@@ -26,6 +191,19 @@ func jwtError(c *fiber.Ctx, err error) error {
 	return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeInvalidJWT, "Invalid or expired JWT")
 }
 
+// Only lets administrators through. Should be executed after calling 'JWTMiddleware()'.
+// The role is read from the JWT, so demoted users must have their sessions revoked.
+func AdminMiddleware(c *fiber.Ctx) error {
+	jwtData := c.Locals("user").(*jwt.Token)
+	claims := jwtData.Claims.(jwt.MapClaims)
+
+	if isAdmin, _ := claims["admin"].(bool); !isAdmin {
+		return apierror.NewApiError(fiber.StatusForbidden, consts.ErrCodeForbidden, "You do not have permission to access this resource")
+	}
+
+	return c.Next()
+}
+
 // Gets user data (their ID) from the JWT middleware. Should be executed after calling 'JWTMiddleware()'.
 func GetDataFromJWT(c *fiber.Ctx) error {
 	jwtData := c.Locals("user").(*jwt.Token)
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// fakeSessionUsageRecorder counts the recorded uses of each session.
+type fakeSessionUsageRecorder struct {
+	uses map[uuid.UUID]int
+}
+
+func (r *fakeSessionUsageRecorder) UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error {
+	r.uses[sessionID]++
+	return nil
+}
+
+// newSessionUsageTestApp stores the given claims as 'JWTMiddleware()' does for every request.
+func newSessionUsageTestApp(recorder *fakeSessionUsageRecorder, claims jwt.MapClaims) *fiber.App {
+	app := fiber.New()
+	app.Use(SessionUsageMiddleware(recorder))
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals("user", &jwt.Token{Valid: true, Claims: claims})
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func TestSessionUsageMiddleware(t *testing.T) {
+	recorder := &fakeSessionUsageRecorder{uses: map[uuid.UUID]int{}}
+	sessionID := uuid.New()
+	app := newSessionUsageTestApp(recorder, jwt.MapClaims{
+		"aud": []string{accessTokenAudience},
+		"sid": sessionID.String(),
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Only the first use is recorded within the interval.
+	if recorder.uses[sessionID] != 1 {
+		t.Errorf("expected 1 recorded use, got %d", recorder.uses[sessionID])
+	}
+}
+
+func TestSessionUsageMiddlewareSkipsAPITokens(t *testing.T) {
+	recorder := &fakeSessionUsageRecorder{uses: map[uuid.UUID]int{}}
+	// API tokens are stored without an audience, using the ID of the token as session ID.
+	app := newSessionUsageTestApp(recorder, jwt.MapClaims{
+		"sid": uuid.New().String(),
+	})
+
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recorder.uses) != 0 {
+		t.Errorf("expected no recorded uses, got %v", recorder.uses)
+	}
+}
+
+// fakeAPITokenAuthenticator accepts a single token, owned by an administrator.
+type fakeAPITokenAuthenticator struct {
+	token    string
+	apiToken *user.APIToken
+}
+
+func (a *fakeAPITokenAuthenticator) AuthenticateAPIToken(ctx context.Context, token string, ipAddress string) (*user.User, *user.APIToken, error) {
+	if token != a.token {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+	return &user.User{ID: uuid.New(), Username: "owner", IsAdmin: true}, a.apiToken, nil
+}
+
+// newAPITokenTestApp answers every request with the 'admin' claim of the authenticated user.
+func newAPITokenTestApp(t *testing.T, authenticator *fakeAPITokenAuthenticator) *fiber.App {
+	t.Setenv("SECRET", "test secret")
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			if apiError, ok := err.(*apierror.Error); ok {
+				return c.Status(apiError.Status).SendString(apiError.Code)
+			}
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	})
+	app.Use(JWTMiddleware(nil, authenticator))
+	app.All("/", func(c *fiber.Ctx) error {
+		claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+		if isAdmin, _ := claims["admin"].(bool); isAdmin {
+			return c.SendString("admin")
+		}
+		return c.SendString("user")
+	})
+	return app
+}
+
+func sendAPITokenRequest(t *testing.T, app *fiber.App, method string, token string) (int, string) {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	token := user.APITokenPrefix + "secret"
+	tests := []struct {
+		scopes []string
+		method string
+		status int
+		body   string
+	}{
+		{[]string{user.APITokenScopeRead}, fiber.MethodGet, fiber.StatusOK, "user"},
+		{[]string{user.APITokenScopeRead}, fiber.MethodHead, fiber.StatusOK, ""},
+		{[]string{user.APITokenScopeRead}, fiber.MethodPost, fiber.StatusForbidden, consts.ErrCodeInsufficientScope},
+		{[]string{user.APITokenScopeWrite}, fiber.MethodGet, fiber.StatusForbidden, consts.ErrCodeInsufficientScope},
+		{[]string{user.APITokenScopeWrite}, fiber.MethodDelete, fiber.StatusOK, "user"},
+		{[]string{user.APITokenScopeRead, user.APITokenScopeAdmin}, fiber.MethodGet, fiber.StatusOK, "admin"},
+	}
+
+	for _, tt := range tests {
+		app := newAPITokenTestApp(t, &fakeAPITokenAuthenticator{
+			token:    token,
+			apiToken: &user.APIToken{ID: uuid.New(), Scopes: tt.scopes},
+		})
+		status, body := sendAPITokenRequest(t, app, tt.method, token)
+		if status != tt.status || body != tt.body {
+			t.Errorf("%s with scopes %v: expected %d %q, got %d %q", tt.method, tt.scopes, tt.status, tt.body, status, body)
+		}
+	}
+}
+
+func TestAPITokenInvalid(t *testing.T) {
+	app := newAPITokenTestApp(t, &fakeAPITokenAuthenticator{
+		token:    user.APITokenPrefix + "secret",
+		apiToken: &user.APIToken{ID: uuid.New(), Scopes: []string{user.APITokenScopeRead}},
+	})
+
+	status, body := sendAPITokenRequest(t, app, fiber.MethodGet, user.APITokenPrefix+"other")
+	if status != fiber.StatusUnauthorized || body != consts.ErrCodeInvalidAPIToken {
+		t.Errorf("expected %d %q, got %d %q", fiber.StatusUnauthorized, consts.ErrCodeInvalidAPIToken, status, body)
+	}
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/oidc"
+	"github.com/jramsgz/articpad/pkg/securetoken"
+)
+
+const (
+	// Audience of the JWTs holding the state of an OpenID Connect login.
+	oidcStateAudience = "articpad-oidc"
+	// Name of the cookie holding the state of an OpenID Connect login.
+	oidcStateCookie = "articpad_oidc"
+	// Time users have to log in to the identity provider.
+	oidcStateTTL = 10 * time.Minute
+	// Maximum time allowed to exchange the authorization code with the identity provider.
+	oidcExchangeTimeout = 15 * time.Second
+)
+
+// Claims of the JWT stored in a cookie between the redirection to the identity provider and the callback.
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// Creates the OpenID Connect client from the configuration, returns nil if it is not enabled.
+func NewOIDCProvider() *oidc.Provider {
+	if config.GetString("OIDC_ENABLED") != "true" {
+		return nil
+	}
+
+	redirectURL := config.GetString("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(config.GetString("APP_URL"), "/") + "/api/v1/auth/oidc/callback"
+	}
+
+	return oidc.New(oidc.Config{
+		Issuer:       config.GetString("OIDC_ISSUER"),
+		ClientID:     config.GetString("OIDC_CLIENT_ID"),
+		ClientSecret: config.GetString("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(config.GetString("OIDC_SCOPES")),
+	})
+}
+
+// Tells the web application whether single sign-on is available.
+func (h *AuthHandler) getOIDCStatus(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"enabled": h.oidcProvider != nil,
+		"name":    config.GetString("OIDC_PROVIDER_NAME"),
+	})
+}
+
+// Redirects the user to the identity provider to log in.
+func (h *AuthHandler) startOIDCLogin(c *fiber.Ctx) error {
+	langCode := h.getLangCode(c)
+
+	if h.oidcProvider == nil {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeOIDCNotEnabled, h.i18n.T(langCode, "errors.oidc_not_enabled"))
+	}
+
+	customContext, cancel := context.WithTimeout(context.Background(), oidcExchangeTimeout)
+	defer cancel()
+
+	state, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	nonce, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	verifier := oidc.GenerateVerifier()
+
+	authURL, err := h.oidcProvider.AuthCodeURL(customContext, state, nonce, verifier)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadGateway, consts.ErrCodeOIDCLoginFailed, h.i18n.T(langCode, "errors.oidc_login_failed"))
+	}
+
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &oidcStateClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "articpad-api",
+		},
+	}).SignedString([]byte(config.GetString("SECRET")))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/api/v1/auth/oidc",
+		Expires:  time.Now().Add(oidcStateTTL),
+		Secure:   strings.HasPrefix(config.GetString("APP_URL"), "https://"),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Handles the redirection back from the identity provider. The user is sent to the web application
+// with the result of the login in the URL fragment, so tokens never reach the server logs.
+func (h *AuthHandler) finishOIDCLogin(c *fiber.Ctx) error {
+	langCode := h.getLangCode(c)
+
+	if h.oidcProvider == nil {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeOIDCNotEnabled, h.i18n.T(langCode, "errors.oidc_not_enabled"))
+	}
+
+	// The state can only be used once.
+	stateCookie := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/v1/auth/oidc",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if c.Query("error") != "" {
+		return h.redirectOIDCResult(c, url.Values{"error": {consts.ErrCodeOIDCLoginFailed}})
+	}
+
+	claims, err := parseOIDCState(stateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(claims.State), []byte(c.Query("state"))) != 1 {
+		return h.redirectOIDCResult(c, url.Values{"error": {consts.ErrCodeOIDCLoginFailed}})
+	}
+
+	customContext, cancel := context.WithTimeout(context.Background(), oidcExchangeTimeout)
+	defer cancel()
+
+	identity, err := h.oidcProvider.Exchange(customContext, c.Query("code"), claims.Nonce, claims.Verifier)
+	if err != nil {
+		return h.redirectOIDCResult(c, url.Values{"error": {consts.ErrCodeOIDCLoginFailed}})
+	}
+	if !identity.EmailVerified {
+		return h.redirectOIDCResult(c, url.Values{"error": {consts.ErrCodeExternalEmailNotVerified}})
+	}
+
+	username := identity.PreferredUsername
+	if username == "" {
+		username = identity.Name
+	}
+
+	user, err := h.userService.GetOrCreateExternalUser(customContext, &user.Identity{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	}, identity.Email, username, langCode, config.GetString("OIDC_AUTO_REGISTER") == "true")
+	if err != nil {
+		apiError := consts.MapApiError(err, h.i18n, langCode)
+		if apiError.Code == consts.ErrCodeUnknown {
+			return apiError
+		}
+		return h.redirectOIDCResult(c, url.Values{"error": {apiError.Code}})
+	}
+
+	twoFactorMethods, err := h.getTwoFactorMethods(customContext, user)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if len(twoFactorMethods) > 0 {
+		challengeToken, err := newChallengeToken(user.ID.String())
+		if err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+		return h.redirectOIDCResult(c, url.Values{
+			"challenge_token":    {challengeToken},
+			"two_factor_methods": {strings.Join(twoFactorMethods, ",")},
+		})
+	}
+
+	signedToken, refreshToken, err := h.createSession(customContext, c, user)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return h.redirectOIDCResult(c, url.Values{
+		"token":         {signedToken},
+		"refresh_token": {refreshToken},
+		"expires_in":    {strconv.Itoa(int(config.GetDuration("ACCESS_TOKEN_TTL").Seconds()))},
+	})
+}
+
+// Sends the user back to the login page of the web application with the given values in the URL fragment.
+func (h *AuthHandler) redirectOIDCResult(c *fiber.Ctx, values url.Values) error {
+	return c.Redirect(strings.TrimSuffix(config.GetString("APP_URL"), "/")+"/login#"+values.Encode(), fiber.StatusFound)
+}
+
+// Parses and validates the JWT holding the state of an OpenID Connect login.
+func parseOIDCState(stateToken string) (*oidcStateClaims, error) {
+	claims := &oidcStateClaims{}
+	_, err := jwt.ParseWithClaims(stateToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.GetString("SECRET")), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience(oidcStateAudience, true) || claims.State == "" {
+		return nil, errors.New("invalid state")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Second factors users can complete their login with.
+const (
+	twoFactorMethodTOTP     = "totp"
+	twoFactorMethodWebAuthn = "webauthn"
+)
+
+// Gets the second factors a user has set up, if any, they must use one of them after their first
+// factor to sign in.
+func (h *AuthHandler) getTwoFactorMethods(ctx context.Context, user *user.User) ([]string, error) {
+	methods := []string{}
+	if user.TwoFactorEnabled {
+		methods = append(methods, twoFactorMethodTOTP)
+	}
+
+	credentials, err := h.userService.GetCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(*credentials) > 0 {
+		methods = append(methods, twoFactorMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// Responds with a challenge token the user has to exchange along with one of their second factors
+// for a new session.
+func (h *AuthHandler) requestTwoFactor(c *fiber.Ctx, user *user.User, methods []string) error {
+	challengeToken, err := newChallengeToken(user.ID.String())
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":             true,
+		"two_factor_required": true,
+		"two_factor_methods":  methods,
+		"challenge_token":     challengeToken,
+	})
+}
+
+// Exchanges a challenge token given by the login endpoint and a TOTP or recovery code for a new session.
+func (h *AuthHandler) verifyTwoFactor(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+	invalidChallengeError := apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidChallengeToken, h.i18n.T(langCode, "errors.invalid_challenge_token"))
+
+	claims, err := parseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		return invalidChallengeError
+	}
+
+	revoked, err := h.denylist.IsRevoked(customContext, claims.ID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if revoked {
+		return invalidChallengeError
+	}
+
+	user, err := h.userService.GetUser(customContext, uuid.MustParse(claims.Subject))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeAccountNotFound, h.i18n.T(langCode, "errors.account_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	locked, err := h.userService.CheckTwoFactorCode(customContext, user.ID, request.Code)
+	if locked {
+		h.sendAccountLockedEmail(c, user)
+	}
+	if err != nil {
+		// Once the account is locked the login has to start over, with the password, after the lockout.
+		if err.Error() == consts.ErrAccountLocked {
+			_ = h.denylist.Revoke(customContext, claims.ID, claims.ExpiresAt.Time)
+		}
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	// Challenge tokens can only be exchanged once.
+	err = h.denylist.Revoke(customContext, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return h.startSession(customContext, c, user)
+}
+
+// Generates a new TOTP secret for the current user. Two-factor authentication is not enabled
+// until the user confirms it with a valid code.
+func (h *AuthHandler) setupTwoFactor(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	secret, uri, err := h.userService.SetupTwoFactor(customContext, uuid.MustParse(userID))
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"secret":  secret,
+		"uri":     uri,
+	})
+}
+
+// Enables two-factor authentication for the current user and gives them their recovery codes.
+func (h *AuthHandler) enableTwoFactor(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Code string `json:"code"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	recoveryCodes, err := h.userService.EnableTwoFactor(customContext, uuid.MustParse(userID), request.Code)
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":        true,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// Disables two-factor authentication for the current user.
+func (h *AuthHandler) disableTwoFactor(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Code string `json:"code"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	locked, err := h.userService.DisableTwoFactor(customContext, uuid.MustParse(userID), request.Code)
+	if locked {
+		h.sendAccountLockedEmailTo(customContext, c, uuid.MustParse(userID))
+	}
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.two_factor_disabled"),
+	})
+}
+
+// Replaces the recovery codes of the current user.
+func (h *AuthHandler) regenerateRecoveryCodes(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Code string `json:"code"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	recoveryCodes, locked, err := h.userService.RegenerateRecoveryCodes(customContext, uuid.MustParse(userID), request.Code)
+	if locked {
+		h.sendAccountLockedEmailTo(customContext, c, uuid.MustParse(userID))
+	}
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":        true,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// Creates a short-lived JWT proving that a user entered their password. It cannot be used to access
+// the API as it has a different audience than access tokens.
+func newChallengeToken(userID string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{challengeTokenAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "articpad-api",
+	})
+	return token.SignedString([]byte(config.GetString("SECRET")))
+}
+
+// Parses and validates a challenge token.
+func parseChallengeToken(challengeToken string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New(consts.ErrInvalidChallengeToken)
+		}
+		return []byte(config.GetString("SECRET")), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience(challengeTokenAudience, true) || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New(consts.ErrInvalidChallengeToken)
+	}
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, errors.New(consts.ErrInvalidChallengeToken)
+	}
+
+	return claims, nil
+}
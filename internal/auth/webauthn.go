@@ -0,0 +1,560 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+const (
+	// Audience of the JWTs holding the state of a WebAuthn registration or login.
+	webauthnSessionAudience = "articpad-webauthn"
+	// Time users have to complete a WebAuthn registration or login with their authenticator.
+	webauthnSessionTTL = 5 * time.Minute
+	// Purposes of the WebAuthn ceremonies, so the state of one cannot be used to finish the other.
+	webauthnRegistration = "registration"
+	webauthnLogin        = "login"
+)
+
+// Claims of the JWT holding the state of a WebAuthn ceremony between its begin and finish requests.
+// The subject is the user registering or logging in, it is empty for logins with a discoverable
+// credential as the user is not known until the credential is used.
+type webauthnSessionClaims struct {
+	Purpose string               `json:"purpose"`
+	Session webauthn.SessionData `json:"session"`
+	// ID of the challenge token given after the first factor, when the credential is used as a second factor.
+	ChallengeID string `json:"cid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Adapts a user and their credentials to the user expected by the WebAuthn library.
+type webauthnUser struct {
+	user        *user.User
+	credentials []user.Credential
+}
+
+// The ID of the user is used as their user handle, so it can be found with a discoverable credential.
+func (u *webauthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, credential := range u.credentials {
+		transports := []protocol.AuthenticatorTransport{}
+		for _, transport := range strings.Split(credential.Transports, ",") {
+			if transport != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: credential.SignCount,
+			},
+		}
+	}
+
+	return credentials
+}
+
+// Gets the stored credential with the given credential ID.
+func (u *webauthnUser) credential(credentialID []byte) *user.Credential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].CredentialID, credentialID) {
+			return &u.credentials[i]
+		}
+	}
+
+	return nil
+}
+
+// Creates the WebAuthn relying party from the configuration. Credentials are bound to the host of
+// the web application unless another domain is configured.
+func NewWebAuthn() (*webauthn.WebAuthn, error) {
+	appURL, err := url.Parse(config.GetString("APP_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	rpID := config.GetString("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = appURL.Hostname()
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: config.GetString("WEBAUTHN_RP_NAME"),
+		RPOrigins:     []string{appURL.Scheme + "://" + appURL.Host},
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+}
+
+// Starts the registration of a new WebAuthn credential for the current user. The options must be
+// passed to the authenticator of the user and its response sent to the finish endpoint along with
+// the session token.
+func (h *AuthHandler) beginWebAuthnRegistration(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	u, err := h.getWebAuthnUser(customContext, uuid.MustParse(userID))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	// Credentials already registered are excluded so the same authenticator is not added twice.
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range u.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := h.webauthn.BeginRegistration(u, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	sessionToken, err := newWebAuthnSessionToken(webauthnRegistration, userID, "", session)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":       true,
+		"options":       options,
+		"session_token": sessionToken,
+	})
+}
+
+// Validates the response of the authenticator of the current user and stores the new credential.
+// The current password is required, as the credential can be used to sign in.
+func (h *AuthHandler) finishWebAuthnRegistration(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		SessionToken string          `json:"session_token"`
+		Name         string          `json:"name"`
+		Password     string          `json:"password"`
+		Credential   json.RawMessage `json:"credential"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	sessionClaims, err := h.parseWebAuthnSessionToken(customContext, request.SessionToken, webauthnRegistration)
+	if err != nil || sessionClaims.Subject != userID {
+		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidWebAuthnSession, h.i18n.T(langCode, "errors.invalid_webauthn_session"))
+	}
+
+	u, err := h.getWebAuthnUser(customContext, uuid.MustParse(userID))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	registrationFailedError := apierror.NewApiError(fiber.StatusUnprocessableEntity, consts.ErrCodeWebAuthnRegistrationFailed, h.i18n.T(langCode, "errors.webauthn_registration_failed"))
+
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		return registrationFailedError
+	}
+
+	credential, err := h.webauthn.CreateCredential(u, sessionClaims.Session, response)
+	if err != nil {
+		return registrationFailedError
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	newCredential := &user.Credential{
+		Name:            request.Name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	locked, err := h.userService.AddCredential(customContext, u.user.ID, request.Password, newCredential)
+	if locked {
+		h.sendAccountLockedEmail(c, u.user)
+	}
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	// Registration session tokens can only be used once.
+	err = h.denylist.Revoke(customContext, sessionClaims.ID, sessionClaims.ExpiresAt.Time)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":    true,
+		"credential": newCredential,
+	})
+}
+
+// Gets the WebAuthn credentials of the current user.
+func (h *AuthHandler) getWebAuthnCredentials(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	credentials, err := h.userService.GetCredentials(customContext, uuid.MustParse(userID))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":     true,
+		"credentials": credentials,
+	})
+}
+
+// Deletes a WebAuthn credential of the current user, confirming it with their password.
+func (h *AuthHandler) deleteWebAuthnCredential(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Password string `json:"password"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	userID := claims["uid"].(string)
+
+	credentialID, err := uuid.Parse(c.Params("credentialID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	locked, err := h.userService.DeleteCredential(customContext, uuid.MustParse(userID), request.Password, credentialID)
+	if locked {
+		h.sendAccountLockedEmailTo(customContext, c, uuid.MustParse(userID))
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeCredentialNotFound, h.i18n.T(langCode, "errors.credential_not_found"))
+		}
+		return consts.MapApiError(err, h.i18n, langCode)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(langCode, "messages.credential_deleted"),
+	})
+}
+
+// Starts a login with a WebAuthn credential. Given the challenge token of the login endpoint, the
+// credential is used as a second factor of that user. Otherwise any discoverable credential (passkey)
+// can be used to sign in without a password, in which case the user must be verified by the
+// authenticator (e.g. with a PIN or biometrics).
+func (h *AuthHandler) beginWebAuthnLogin(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+
+	request := new(RequestPayload)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+		}
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	if request.ChallengeToken == "" {
+		options, session, err := h.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+
+		return h.respondWebAuthnLogin(c, options, "", "", session)
+	}
+
+	challengeClaims, err := h.checkChallengeToken(customContext, request.ChallengeToken)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidChallengeToken, h.i18n.T(langCode, "errors.invalid_challenge_token"))
+	}
+
+	u, err := h.getWebAuthnUser(customContext, uuid.MustParse(challengeClaims.Subject))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeAccountNotFound, h.i18n.T(langCode, "errors.account_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if len(u.credentials) == 0 {
+		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeWebAuthnLoginFailed, h.i18n.T(langCode, "errors.webauthn_login_failed"))
+	}
+
+	options, session, err := h.webauthn.BeginLogin(u, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return h.respondWebAuthnLogin(c, options, challengeClaims.Subject, challengeClaims.ID, session)
+}
+
+// Validates the response of the authenticator of the user and gives them a new session.
+func (h *AuthHandler) finishWebAuthnLogin(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		SessionToken string          `json:"session_token"`
+		Credential   json.RawMessage `json:"credential"`
+	}
+
+	request := new(RequestPayload)
+	err := c.BodyParser(request)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	sessionClaims, err := h.parseWebAuthnSessionToken(customContext, request.SessionToken, webauthnLogin)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidWebAuthnSession, h.i18n.T(langCode, "errors.invalid_webauthn_session"))
+	}
+
+	loginFailedError := apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeWebAuthnLoginFailed, h.i18n.T(langCode, "errors.webauthn_login_failed"))
+
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		return loginFailedError
+	}
+
+	var u *webauthnUser
+	var credential *webauthn.Credential
+	if sessionClaims.Subject != "" {
+		// Second factor, the challenge token must not have been exchanged in the meantime.
+		revoked, err := h.denylist.IsRevoked(customContext, sessionClaims.ChallengeID)
+		if err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+		if revoked {
+			return apierror.NewApiError(fiber.StatusUnauthorized, consts.ErrCodeInvalidChallengeToken, h.i18n.T(langCode, "errors.invalid_challenge_token"))
+		}
+
+		u, err = h.getWebAuthnUser(customContext, uuid.MustParse(sessionClaims.Subject))
+		if err != nil {
+			return loginFailedError
+		}
+
+		credential, err = h.webauthn.ValidateLogin(u, sessionClaims.Session, response)
+		if err != nil {
+			return loginFailedError
+		}
+	} else {
+		credential, err = h.webauthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			userID, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			u, err = h.getWebAuthnUser(customContext, userID)
+			return u, err
+		}, sessionClaims.Session, response)
+		if err != nil {
+			return loginFailedError
+		}
+	}
+
+	// A signature counter that did not increase means the credential may have been cloned.
+	storedCredential := u.credential(credential.ID)
+	if storedCredential == nil || credential.Authenticator.CloneWarning {
+		return loginFailedError
+	}
+
+	err = h.userService.UpdateCredentialUsage(customContext, storedCredential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	err = h.userService.ResetFailedLogins(customContext, u.user.ID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	// Both the session token and the challenge token, if any, can only be used once.
+	err = h.denylist.Revoke(customContext, sessionClaims.ID, sessionClaims.ExpiresAt.Time)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+	if sessionClaims.ChallengeID != "" {
+		err = h.denylist.Revoke(customContext, sessionClaims.ChallengeID, time.Now().Add(challengeTokenTTL))
+		if err != nil {
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+	}
+
+	return h.startSession(customContext, c, u.user)
+}
+
+// Responds with the options of a WebAuthn login and the token holding its state.
+func (h *AuthHandler) respondWebAuthnLogin(c *fiber.Ctx, options *protocol.CredentialAssertion, userID string, challengeID string, session *webauthn.SessionData) error {
+	sessionToken, err := newWebAuthnSessionToken(webauthnLogin, userID, challengeID, session)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":       true,
+		"options":       options,
+		"session_token": sessionToken,
+	})
+}
+
+// Gets a user along with their WebAuthn credentials.
+func (h *AuthHandler) getWebAuthnUser(ctx context.Context, userID uuid.UUID) (*webauthnUser, error) {
+	u, err := h.userService.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := h.userService.GetCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: u, credentials: *credentials}, nil
+}
+
+// Parses a challenge token and checks it has not been exchanged yet.
+func (h *AuthHandler) checkChallengeToken(ctx context.Context, challengeToken string) (*jwt.RegisteredClaims, error) {
+	claims, err := parseChallengeToken(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := h.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New(consts.ErrInvalidChallengeToken)
+	}
+
+	return claims, nil
+}
+
+// Creates a short-lived JWT holding the state of a WebAuthn ceremony, so it does not have to be
+// stored by the server.
+func newWebAuthnSessionToken(purpose string, userID string, challengeID string, session *webauthn.SessionData) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &webauthnSessionClaims{
+		Purpose:     purpose,
+		Session:     *session,
+		ChallengeID: challengeID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{webauthnSessionAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(webauthnSessionTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "articpad-api",
+		},
+	})
+	return token.SignedString([]byte(config.GetString("SECRET")))
+}
+
+// Parses and validates a WebAuthn session token of the given purpose that has not been used yet.
+func (h *AuthHandler) parseWebAuthnSessionToken(ctx context.Context, sessionToken string, purpose string) (*webauthnSessionClaims, error) {
+	claims := &webauthnSessionClaims{}
+	_, err := jwt.ParseWithClaims(sessionToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.GetString("SECRET")), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience(webauthnSessionAudience, true) || claims.Purpose != purpose || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid WebAuthn session token")
+	}
+	if claims.Subject != "" {
+		if _, err := uuid.Parse(claims.Subject); err != nil {
+			return nil, errors.New("invalid WebAuthn session token")
+		}
+	}
+
+	revoked, err := h.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("WebAuthn session token has already been used")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+)
+
+func TestWebAuthnSessionToken(t *testing.T) {
+	t.Setenv("SECRET", "test secret")
+	handler := &AuthHandler{denylist: NewTokenDenylist(testdb.New(t, &RevokedToken{}), nil)}
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	token, err := newWebAuthnSessionToken(webauthnRegistration, userID, "", &webauthn.SessionData{Challenge: "challenge"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, err := handler.parseWebAuthnSessionToken(ctx, token, webauthnRegistration)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != userID || claims.Session.Challenge != "challenge" {
+		t.Errorf("expected the session of %s, got %s with challenge %q", userID, claims.Subject, claims.Session.Challenge)
+	}
+
+	// A registration cannot be finished as a login.
+	if _, err := handler.parseWebAuthnSessionToken(ctx, token, webauthnLogin); err == nil {
+		t.Error("expected a token of another purpose to be rejected")
+	}
+
+	// Tokens are revoked once the ceremony is finished, so it cannot be replayed.
+	if err := handler.denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := handler.parseWebAuthnSessionToken(ctx, token, webauthnRegistration); err == nil {
+		t.Error("expected a used token to be rejected")
+	}
+
+	t.Setenv("SECRET", "other secret")
+	token, err = newWebAuthnSessionToken(webauthnLogin, "", "", &webauthn.SessionData{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv("SECRET", "test secret")
+	if _, err := handler.parseWebAuthnSessionToken(ctx, token, webauthnLogin); err == nil {
+		t.Error("expected a token with an invalid signature to be rejected")
+	}
+}
+
+func TestWebAuthnUserCredentials(t *testing.T) {
+	lastUsedAt := time.Now()
+	u := &webauthnUser{
+		user: &user.User{ID: uuid.New(), Username: "owner"},
+		credentials: []user.Credential{
+			{CredentialID: []byte{1}, Transports: "usb,nfc", SignCount: 3, BackupEligible: true},
+			{CredentialID: []byte{2}, Transports: "", LastUsedAt: &lastUsedAt},
+		},
+	}
+
+	credentials := u.WebAuthnCredentials()
+	if len(credentials) != 2 {
+		t.Fatalf("expected 2 credentials, got %d", len(credentials))
+	}
+	if len(credentials[0].Transport) != 2 || credentials[0].Transport[1] != "nfc" || credentials[0].Authenticator.SignCount != 3 || !credentials[0].Flags.BackupEligible {
+		t.Errorf("expected the stored credential, got %+v", credentials[0])
+	}
+	if len(credentials[1].Transport) != 0 {
+		t.Errorf("expected no transports, got %v", credentials[1].Transport)
+	}
+
+	// The ID of the user is their user handle, so discoverable credentials can find them.
+	if uuid.UUID(u.WebAuthnID()) != u.user.ID {
+		t.Errorf("expected the user handle to be %s", u.user.ID)
+	}
+
+	if credential := u.credential([]byte{2}); credential == nil || credential.LastUsedAt != &lastUsedAt {
+		t.Errorf("expected the second credential, got %v", credential)
+	}
+	if credential := u.credential([]byte{3}); credential != nil {
+		t.Errorf("expected no credential, got %v", credential)
+	}
+}
@@ -10,11 +10,19 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/account"
+	"github.com/jramsgz/articpad/internal/admin"
 	"github.com/jramsgz/articpad/internal/auth"
 	"github.com/jramsgz/articpad/internal/health"
 	"github.com/jramsgz/articpad/internal/logging"
 	"github.com/jramsgz/articpad/internal/misc"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/session"
 	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"github.com/jramsgz/articpad/pkg/hasher"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // startFiberServer starts the Fiber server.
@@ -26,8 +34,9 @@ func (a *App) startFiberServer() *fiber.App {
 	var enableProxy bool = len(trustedProxies) > 0
 	var isProduction bool = config.GetString("DEBUG") == "false"
 
+	// Prefork is not used, as collaborative editing sessions of notes live in the memory of the process
+	// and all the editors of a note must share them.
 	app := fiber.New(fiber.Config{
-		Prefork:                 isProduction,
 		ServerHeader:            "ArticPad Server " + config.Version,
 		AppName:                 "ArticPad",
 		DisableStartupMessage:   isProduction,
@@ -42,10 +51,17 @@ func (a *App) startFiberServer() *fiber.App {
 		MaxAge:       1800,
 		AllowOrigins: config.GetString("APP_URL"),
 	}))
+	// The data export is streamed and already compressed, computing its ETag would read it all into memory.
+	isDataExport := func(c *fiber.Ctx) bool {
+		return c.Path() == "/api/v1/users/me/export"
+	}
 	app.Use(compress.New(compress.Config{
+		Next:  isDataExport,
 		Level: compress.LevelBestSpeed, // 1
 	}))
-	app.Use(etag.New())
+	app.Use(etag.New(etag.Config{
+		Next: isDataExport,
+	}))
 	if config.GetString("RATE_LIMIT_AUTH") == "true" {
 		app.Use(limiter.New(limiter.Config{
 			Max:        40,
@@ -60,22 +76,47 @@ func (a *App) startFiberServer() *fiber.App {
 				return limiter.ConfigDefault.Storage
 			}(),
 			Next: func(c *fiber.Ctx) bool {
-				return !strings.HasPrefix(c.Path(), "/api/v1/auth")
+				// Passwords of public links are also rate limited.
+				isPublicLinkPassword := c.Method() == fiber.MethodPost && strings.HasPrefix(c.Path(), "/s/")
+				return !strings.HasPrefix(c.Path(), "/api/v1/auth") && !isPublicLinkPassword
 			},
 		}))
 	}
 
-	userRepository := user.NewUserRepository(a.db)
+	userRepository := newUserRepository(a.db)
+	noteRepository := note.NewNoteRepository(a.db)
+	sessionRepository := session.NewSessionRepository(a.db)
+
+	userService := newUserService(userRepository)
+	noteService := note.NewNoteService(noteRepository)
+	sessionService := session.NewSessionService(sessionRepository, config.GetDuration("REFRESH_TOKEN_TTL"))
 
-	userService := user.NewUserService(userRepository)
+	tokenDenylist := auth.NewTokenDenylist(a.db, func() fiber.Storage {
+		if a.redis != nil {
+			return a.redis
+		}
+		return nil
+	}())
 
 	api := app.Group("/api")
 	apiv1 := api.Group("/v1")
+	apiv1.Use(auth.SessionUsageMiddleware(sessionService))
 
 	misc.NewMiscHandler(apiv1)
 	health.NewHealthHandler(app.Group("/health"))
-	auth.NewAuthHandler(apiv1.Group("/auth"), userService, a.mail, a.i18n)
-	//user.NewUserHandler(apiv1.Group("/users"), userService)
+	webAuthn, err := auth.NewWebAuthn()
+	if err != nil {
+		a.logger.Fatal().Msgf("invalid WebAuthn configuration: %s", err.Error())
+	}
+
+	auth.NewAuthHandler(apiv1.Group("/auth"), userService, sessionService, tokenDenylist, auth.NewOIDCProvider(), webAuthn, a.mail, a.i18n)
+	account.NewAccountHandler(apiv1.Group("/users"), userService, noteService, sessionService, tokenDenylist, a.mail, a.i18n)
+	admin.NewAdminHandler(apiv1.Group("/admin"), userService, sessionService, tokenDenylist, a.i18n)
+	note.NewNoteHandler(apiv1.Group("/notes"), noteService, userService, tokenDenylist, note.NewCollabHub(noteService, a.logger), a.mail, a.i18n)
+	note.NewNotebookHandler(apiv1.Group("/notebooks"), noteService, userService, tokenDenylist, a.mail, a.i18n)
+	note.NewTagHandler(apiv1.Group("/tags"), noteService, userService, tokenDenylist, a.i18n)
+	note.NewSearchHandler(apiv1.Group("/search"), noteService, userService, tokenDenylist, a.i18n)
+	note.NewShareHandler(apiv1.Group("/shares"), noteService, userService, tokenDenylist, a.i18n)
 
 	api.All("*", func(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{
@@ -84,6 +125,9 @@ func (a *App) startFiberServer() *fiber.App {
 		})
 	})
 
+	// Public links of notes, served along with the web app as they are opened in a browser.
+	note.NewPublicNoteHandler(app.Group("/s"), noteService, a.i18n)
+
 	app.Static("/", config.GetString("STATIC_DIR"), fiber.Static{
 		Compress: true,
 		MaxAge:   3600,
@@ -100,3 +144,40 @@ func (a *App) startFiberServer() *fiber.App {
 
 	return app
 }
+
+// newUserRepository creates the user repository. Every domain holding data of users must be given to it,
+// so their data is deleted along with the users that are permanently deleted.
+func newUserRepository(db *gorm.DB) user.UserRepository {
+	return user.NewUserRepository(db, note.NewNoteRepository(db), session.NewSessionRepository(db))
+}
+
+// newUserService creates the user service with the login, registration and password hashing settings from the configuration.
+func newUserService(userRepository user.UserRepository) user.UserService {
+	allowedEmailDomains := []string{}
+	for _, domain := range strings.Split(config.GetString("ALLOWED_EMAIL_DOMAINS"), ",") {
+		domain = strings.TrimPrefix(strings.TrimSpace(domain), "@")
+		if domain != "" {
+			allowedEmailDomains = append(allowedEmailDomains, strings.ToLower(domain))
+		}
+	}
+
+	return user.NewUserService(userRepository, user.LockoutPolicy{
+		MaxAttempts:     config.GetInt("LOGIN_MAX_ATTEMPTS"),
+		LockoutDuration: config.GetDuration("LOGIN_LOCKOUT_DURATION"),
+		BaseDelay:       config.GetDuration("LOGIN_BACKOFF_DELAY"),
+		MaxDelay:        config.GetDuration("LOGIN_BACKOFF_MAX_DELAY"),
+	}, user.RegistrationPolicy{
+		Mode:                strings.ToLower(strings.TrimSpace(config.GetString("REGISTRATION_MODE"))),
+		AllowedEmailDomains: allowedEmailDomains,
+	}, hasher.New(
+		&hasher.Argon2id{Params: &argon2id.Params{
+			Memory:      uint32(config.GetInt("ARGON2_MEMORY")),
+			Iterations:  uint32(config.GetInt("ARGON2_ITERATIONS")),
+			Parallelism: uint8(config.GetInt("ARGON2_PARALLELISM")),
+			SaltLength:  argon2id.DefaultParams.SaltLength,
+			KeyLength:   argon2id.DefaultParams.KeyLength,
+		}},
+		// Hashes imported from other systems are rehashed with Argon2id when their users log in.
+		&hasher.Bcrypt{Cost: bcrypt.DefaultCost},
+	))
+}
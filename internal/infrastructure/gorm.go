@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/glebarez/sqlite"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/user"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -38,3 +40,124 @@ func connectToDB(config *DatabaseConfig) (*gorm.DB, error) {
 	}
 	return db, err
 }
+
+// migrateLegacyTokens clears the verification and password reset tokens stored as plain UUIDs by
+// previous versions, as only their hashes are stored now. Users with a pending verification can ask
+// for a new email. The verification token column was not nullable then, which AutoMigrate does not change.
+func migrateLegacyTokens(db *gorm.DB) error {
+	columnTypes, err := db.Migrator().ColumnTypes(&user.User{})
+	if err != nil {
+		return err
+	}
+	for _, columnType := range columnTypes {
+		if nullable, ok := columnType.Nullable(); columnType.Name() == "verification_token" && ok && !nullable {
+			if err := db.Migrator().AlterColumn(&user.User{}, "VerificationToken"); err != nil {
+				return err
+			}
+			// SQLite recreates the table to alter a column, losing its indexes.
+			if err := db.AutoMigrate(&user.User{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = db.Unscoped().Model(&user.User{}).Where("verification_token LIKE ?", "%-%").Updates(map[string]interface{}{
+		"verification_token":      nil,
+		"verification_expires_at": nil,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Unscoped().Model(&user.User{}).Where("password_reset_token LIKE ?", "%-%").Updates(map[string]interface{}{
+		"password_reset_token":      nil,
+		"password_reset_expires_at": nil,
+	}).Error
+}
+
+// migrateNoteRevisions creates the first revision of the notes created before revisions were kept,
+// so that their current body can be restored after it is changed.
+func migrateNoteRevisions(db *gorm.DB) error {
+	var notes []note.Note
+	return db.Where("NOT EXISTS (SELECT 1 FROM revisions WHERE revisions.note_id = notes.id)").
+		FindInBatches(&notes, 100, func(tx *gorm.DB, batch int) error {
+			revisions := make([]*note.Revision, 0, len(notes))
+			for _, n := range notes {
+				revisions = append(revisions, note.NewRevision(n.ID, n.UserID, n.Body))
+			}
+			return db.Create(&revisions).Error
+		}).Error
+}
+
+// migrateSearchIndex creates the full-text search index of notes, an FTS5 table kept up to date by
+// triggers with SQLite and a generated tsvector column with a GIN index with PostgreSQL.
+func migrateSearchIndex(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return migrateSQLiteSearchIndex(db)
+	case "postgres":
+		return db.Transaction(func(tx *gorm.DB) error {
+			statements := []string{
+				`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+					setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+					setweight(to_tsvector('simple', coalesce(body, '')), 'B')
+				) STORED`,
+				"CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)",
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return nil
+	}
+}
+
+// migrateSQLiteSearchIndex creates the FTS5 table that indexes the title and body of notes by their rowid.
+// SQLite drops the triggers of a table when it is recreated to alter a column, so they are checked on
+// every start and created again when they are missing. Notes have no integer primary key, so their rowids
+// are not stable either: VACUUM or recreating the table may renumber them, which would make the index
+// point at other notes. The index is therefore rebuilt from the notes on every start.
+func migrateSQLiteSearchIndex(db *gorm.DB) error {
+	var triggers int64
+	err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND tbl_name = 'notes' AND name LIKE 'notes_fts_%'").
+		Scan(&triggers).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var statements []string
+		if triggers != 3 {
+			statements = []string{
+				`CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+					title, body, content='notes', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2'
+				)`,
+				"DROP TRIGGER IF EXISTS notes_fts_insert",
+				"DROP TRIGGER IF EXISTS notes_fts_delete",
+				"DROP TRIGGER IF EXISTS notes_fts_update",
+				`CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+					INSERT INTO notes_fts(rowid, title, body) VALUES (new.rowid, new.title, new.body);
+				END`,
+				`CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+					INSERT INTO notes_fts(notes_fts, rowid, title, body) VALUES ('delete', old.rowid, old.title, old.body);
+				END`,
+				`CREATE TRIGGER notes_fts_update AFTER UPDATE OF title, body ON notes BEGIN
+					INSERT INTO notes_fts(notes_fts, rowid, title, body) VALUES ('delete', old.rowid, old.title, old.body);
+					INSERT INTO notes_fts(rowid, title, body) VALUES (new.rowid, new.title, new.body);
+				END`,
+			}
+		}
+		statements = append(statements, "INSERT INTO notes_fts(notes_fts) VALUES ('rebuild')")
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
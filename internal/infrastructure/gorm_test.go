@@ -0,0 +1,79 @@
+package infrastructure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+)
+
+func TestSearchNotes(t *testing.T) {
+	db := testdb.New(t, &note.Note{}, &note.Revision{}, &note.Tag{}, &note.Notebook{}, &note.Share{})
+	ctx := context.Background()
+	service := note.NewNoteService(note.NewNoteRepository(db))
+	ownerID := uuid.New()
+
+	// Notes created before the index are indexed when it is built.
+	recipe := &note.Note{UserID: ownerID, Title: "Crème brûlée", Body: "Caramelize the sugar <on top>."}
+	if err := service.CreateNote(ctx, recipe); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if err := migrateSearchIndex(db); err != nil {
+		t.Fatalf("failed to create the search index: %v", err)
+	}
+	// Migrating again rebuilds the index without duplicating it.
+	if err := migrateSearchIndex(db); err != nil {
+		t.Fatalf("failed to rebuild the search index: %v", err)
+	}
+
+	shopping := &note.Note{UserID: ownerID, Title: "Shopping", Body: "Sugar, eggs and cream"}
+	other := &note.Note{UserID: uuid.New(), Title: "Sugar", Body: "Someone else's sugar"}
+	for _, n := range []*note.Note{shopping, other} {
+		if err := service.CreateNote(ctx, n); err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	opts := &note.ListOptions{Page: 1, PerPage: 10}
+	results, total, err := service.SearchNotes(ctx, ownerID, "sug", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 2 || len(*results) != 2 {
+		t.Fatalf("expected the 2 notes of the user to match, got %d", total)
+	}
+
+	// Diacritics are ignored and the matched terms are highlighted in the escaped text.
+	results, _, err = service.SearchNotes(ctx, ownerID, "creme caramel", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*results) != 1 || (*results)[0].ID != recipe.ID {
+		t.Fatalf("expected the recipe to match, got %v", *results)
+	}
+	if result := (*results)[0]; result.TitleHighlight != "<mark>Crème</mark> brûlée" || result.Snippet != "<mark>Caramelize</mark> the sugar &lt;on top&gt;." {
+		t.Errorf("expected the terms to be highlighted, got %q and %q", result.TitleHighlight, result.Snippet)
+	}
+
+	// Updated and deleted notes are kept up to date in the index.
+	if err := service.UpdateNote(ctx, ownerID, shopping.ID, &note.Note{Title: "Shopping", Body: "Eggs and cream"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.DeleteNote(ctx, ownerID, recipe.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, total, err = service.SearchNotes(ctx, ownerID, "sugar", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("expected no note to match, got %d", total)
+	}
+
+	// Query syntax is not passed to the database.
+	if _, _, err := service.SearchNotes(ctx, ownerID, `"eggs" OR NEAR(cream*`, opts); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package infrastructure
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -10,6 +11,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/storage/redis/v3"
 	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/note"
+	"github.com/jramsgz/articpad/internal/session"
 	"github.com/jramsgz/articpad/internal/user"
 	"github.com/jramsgz/articpad/pkg/i18n"
 	"github.com/jramsgz/articpad/pkg/mail"
@@ -42,6 +46,10 @@ func Run() {
 		logger.Fatal().Msgf("failed to start i18n service: %s", err.Error())
 	}
 
+	if err := setUpValidators(); err != nil {
+		logger.Fatal().Msgf("failed to set up validators: %s", err.Error())
+	}
+
 	db, err := connectToDB(&DatabaseConfig{
 		Driver:   config.GetString("DB_DRIVER"),
 		Host:     config.GetString("DB_HOST"),
@@ -54,13 +62,29 @@ func Run() {
 		logger.Fatal().Msgf("Database connection error: %s", err)
 	}
 
-	if !fiber.IsChild() {
-		logger.Info().Msg("Running migrations...")
-		err = db.AutoMigrate(&user.User{})
-		if err != nil {
-			logger.Fatal().Msgf("failed to automigrate models: %s", err.Error())
-			return
-		}
+	logger.Info().Msg("Running migrations...")
+	err = db.AutoMigrate(&user.User{}, &note.Note{}, &note.Revision{}, &note.Notebook{}, &note.Tag{}, &note.Share{}, &note.PublicLink{}, &auth.RevokedToken{}, &session.Session{}, &session.RefreshToken{}, &user.RecoveryCode{}, &user.Identity{}, &user.Credential{}, &user.APIToken{}, &user.Invite{})
+	if err != nil {
+		logger.Fatal().Msgf("failed to automigrate models: %s", err.Error())
+		return
+	}
+
+	err = migrateLegacyTokens(db)
+	if err != nil {
+		logger.Fatal().Msgf("failed to clear legacy tokens: %s", err.Error())
+		return
+	}
+
+	err = migrateNoteRevisions(db)
+	if err != nil {
+		logger.Fatal().Msgf("failed to create the first revision of notes: %s", err.Error())
+		return
+	}
+
+	err = migrateSearchIndex(db)
+	if err != nil {
+		logger.Fatal().Msgf("failed to create the search index: %s", err.Error())
+		return
 	}
 
 	mailClient, err := mail.NewMailer(&mail.MailConfig{
@@ -75,14 +99,15 @@ func Run() {
 		logger.Fatal().Msgf("Mail server connection error: %s", err)
 	}
 
-	var redisDB *redis.Storage
-	go func() {
+	// Redis is connected to before starting the server, as the token denylist and the rate limiter only
+	// use it if it is available when they are created.
+	redisDB := func() (storage *redis.Storage) {
 		defer func() {
 			if err := recover(); err != nil {
 				logger.Error().Msgf("Redis connection error: %s. Some features may not be available.", err)
 			}
 		}()
-		redisDB = redis.New(redis.Config{
+		return redis.New(redis.Config{
 			Host:     config.GetString("REDIS_HOST"),
 			Port:     config.GetInt("REDIS_PORT"),
 			Username: config.GetString("REDIS_USERNAME"),
@@ -100,6 +125,9 @@ func Run() {
 	}
 	app.fiber = app.startFiberServer()
 
+	jobsContext, stopJobs := context.WithCancel(context.Background())
+	app.startJobs(jobsContext)
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	var serverShutdown sync.WaitGroup
@@ -108,26 +136,25 @@ func Run() {
 		<-c
 		serverShutdown.Add(1)
 		defer serverShutdown.Done()
+		stopJobs()
 		_ = app.fiber.ShutdownWithTimeout(60 * time.Second)
 	}()
 
-	if !fiber.IsChild() {
-		logger.Info().Msgf("Starting ArticPad %s with isProduction: %t", config.Version, config.GetString("DEBUG") == "false")
-		logger.Info().Msgf("BuildTime: %s | Commit: %s", config.BuildTime, config.Commit)
-		logger.Info().Msgf("Listening on %s", config.GetString("APP_ADDR"))
-	}
+	logger.Info().Msgf("Starting ArticPad %s with isProduction: %t", config.Version, config.GetString("DEBUG") == "false")
+	logger.Info().Msgf("BuildTime: %s | Commit: %s", config.BuildTime, config.Commit)
+	logger.Info().Msgf("Listening on %s", config.GetString("APP_ADDR"))
 	if err := app.fiber.Listen(config.GetString("APP_ADDR")); err != nil {
 		logger.Fatal().Err(err).Msg("Error starting server")
 	}
 
-	if !fiber.IsChild() {
-		logger.Info().Msg("Shutting down server...")
-		serverShutdown.Wait()
-	}
+	logger.Info().Msg("Shutting down server...")
+	serverShutdown.Wait()
 
 	sqlDB, _ := db.DB()
 	_ = sqlDB.Close()
 	_ = logFile.Close()
 	_ = mailClient.Close()
-	_ = redisDB.Close()
+	if redisDB != nil {
+		_ = redisDB.Close()
+	}
 }
@@ -0,0 +1,63 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/note"
+)
+
+// startJobs starts the background jobs of the application. They run until the context is cancelled.
+func (a *App) startJobs(ctx context.Context) {
+	gracePeriod := config.GetDuration("ACCOUNT_DELETION_GRACE_PERIOD")
+	purgeInterval := config.GetDuration("ACCOUNT_PURGE_INTERVAL")
+	if gracePeriod > 0 && purgeInterval > 0 {
+		userService := newUserService(newUserRepository(a.db))
+
+		go runPeriodically(ctx, purgeInterval, func() {
+			count, err := userService.PurgeDeletedUsers(ctx, time.Now().Add(-gracePeriod))
+			if err != nil {
+				a.logger.Error().Err(err).Msg("Failed to purge deleted users")
+			} else if count > 0 {
+				a.logger.Info().Msgf("Permanently deleted %d users past their deletion grace period", count)
+			}
+		})
+	}
+
+	maxRevisions := config.GetInt("NOTE_REVISIONS_MAX_COUNT")
+	maxRevisionAge := config.GetDuration("NOTE_REVISIONS_MAX_AGE")
+	pruneInterval := config.GetDuration("NOTE_REVISIONS_PRUNE_INTERVAL")
+	if (maxRevisions > 0 || maxRevisionAge > 0) && pruneInterval > 0 {
+		noteService := note.NewNoteService(note.NewNoteRepository(a.db))
+
+		go runPeriodically(ctx, pruneInterval, func() {
+			var createdBefore time.Time
+			if maxRevisionAge > 0 {
+				createdBefore = time.Now().Add(-maxRevisionAge)
+			}
+			count, err := noteService.PruneRevisions(ctx, maxRevisions, createdBefore)
+			if err != nil {
+				a.logger.Error().Err(err).Msg("Failed to prune note revisions")
+			} else if count > 0 {
+				a.logger.Info().Msgf("Pruned %d note revisions", count)
+			}
+		})
+	}
+}
+
+// runPeriodically runs the job right away and then every interval until the context is cancelled.
+func runPeriodically(ctx context.Context, interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
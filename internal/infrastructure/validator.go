@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/pkg/validator"
+)
+
+// setUpValidators configures the validators of usernames and passwords from the configuration.
+func setUpValidators() error {
+	if dir := config.GetString("PASSWORD_BREACHED_RANGES_DIR"); dir != "" {
+		validator.BreachedRanges = validator.RangeDir(dir)
+	}
+
+	// The bundled list of reserved usernames is replaced by the configured file if it exists.
+	f, err := os.Open(config.GetString("RESERVED_USERNAMES_FILE"))
+	if err == nil {
+		defer f.Close()
+		if validator.ReservedUsernames, err = validator.ReadWordList(f); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	validator.SetDefaultPolicy(newValidationPolicy())
+	return nil
+}
+
+// newValidationPolicy creates the policy usernames and passwords must follow from the configuration.
+func newValidationPolicy() *validator.Policy {
+	reservedUsernames := []string{}
+	for _, username := range strings.Split(config.GetString("RESERVED_USERNAMES"), ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			reservedUsernames = append(reservedUsernames, username)
+		}
+	}
+
+	return &validator.Policy{
+		UsernameMinLength:        config.GetInt("USERNAME_MIN_LENGTH"),
+		UsernameMaxLength:        config.GetInt("USERNAME_MAX_LENGTH"),
+		UsernameAllowedChars:     config.GetString("USERNAME_ALLOWED_CHARS"),
+		ReservedUsernames:        reservedUsernames,
+		PasswordMinLength:        config.GetInt("PASSWORD_MIN_LENGTH"),
+		PasswordMaxLength:        config.GetInt("PASSWORD_MAX_LENGTH"),
+		PasswordRequireLowercase: config.GetString("PASSWORD_REQUIRE_LOWERCASE") == "true",
+		PasswordRequireUppercase: config.GetString("PASSWORD_REQUIRE_UPPERCASE") == "true",
+		PasswordRequireNumber:    config.GetString("PASSWORD_REQUIRE_NUMBER") == "true",
+		PasswordRequireSpecial:   config.GetString("PASSWORD_REQUIRE_SPECIAL") == "true",
+		PasswordMaxSimilarity:    config.GetFloat("PASSWORD_MAX_SIMILARITY"),
+	}
+}
@@ -0,0 +1,521 @@
+package note
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/ot"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const (
+	// Delay between the last applied operation and the note being saved to the database.
+	collabSaveDelay = 2 * time.Second
+	// Delay before saving a note again when saving it failed.
+	collabSaveRetryDelay = 10 * time.Second
+	// Maximum number of operations kept to transform operations based on old revisions.
+	collabMaxHistory = 1000
+	// Maximum size in bytes of a message sent by a client.
+	collabMaxMessageSize = 1 << 20
+	// Maximum time allowed to write a message to a client.
+	collabWriteTimeout = 10 * time.Second
+	// Maximum number of messages waiting to be written to a client. Clients falling further behind are
+	// disconnected, so they do not hold up the session.
+	collabSendQueueSize = 256
+	// Interval between checks that the clients of a session can still edit the note.
+	collabAuthorizeInterval = 30 * time.Second
+)
+
+// collabMessage represents a message sent by a client of a collaborative editing session.
+//
+// Clients send {"type": "operation", "revision": n, "operation": [...]} where revision is the
+// last revision they know about and operation uses the ot.js format. The server answers with
+// {"type": "ack", "revision": n} and broadcasts {"type": "operation", ...} to the other clients.
+type collabMessage struct {
+	Type      string        `json:"type"`
+	Revision  int           `json:"revision"`
+	Operation *ot.Operation `json:"operation"`
+}
+
+// CollabHub keeps track of the notes being edited and the clients connected to each of them.
+// Sessions live in memory, which is why the server runs as a single process, without prefork.
+type CollabHub struct {
+	noteService NoteService
+	logger      zerolog.Logger
+	mu          sync.Mutex
+	sessions    map[uuid.UUID]*collabSession
+}
+
+// collabSession holds the live state of a note being edited. A session stays open until every
+// client has left and its changes are saved.
+type collabSession struct {
+	mu     sync.Mutex
+	noteID uuid.UUID
+	// The body is loaded by the first client joining. Until then, the session only serves to update
+	// the note from outside of it, see 'UpdateBody'.
+	loaded bool
+	// Set once the session is removed from the hub, a new one must be opened for the note.
+	closed       bool
+	ownerID      uuid.UUID
+	body         string
+	baseRevision int
+	history      []*ot.Operation
+	clients      map[*websocket.Conn]*collabClient
+	saveTimer    *time.Timer
+	// User who applied the last operation, the author of the revision created when saving.
+	lastEditorID uuid.UUID
+}
+
+// collabClient identifies the user connected to a session. Messages are written to its connection by its
+// own goroutine, see 'writeMessages', so a slow connection does not block the session while it is locked.
+type collabClient struct {
+	userID   uuid.UUID
+	username string
+	// Checks that the client can still edit the note, see 'CollabAuthorizer'.
+	authorize CollabAuthorizer
+	// Messages waiting to be written, closed once the client is closed.
+	send chan []byte
+	// Closed when the writer of the client returns.
+	done chan struct{}
+	// Set once the client is closed, along with the code of the close message sent after the queued
+	// messages. Both are guarded by the session lock.
+	closed    bool
+	closeCode int
+}
+
+// CollabAuthorizer reports whether a client can still edit the note of its session, as their token may
+// have expired or been revoked, or their access to the note removed, since they connected.
+type CollabAuthorizer func(ctx context.Context) (bool, error)
+
+// Creates a new hub for collaborative editing sessions. Errors saving notes are reported to the logger.
+func NewCollabHub(ns NoteService, logger zerolog.Logger) *CollabHub {
+	return &CollabHub{
+		noteService: ns,
+		logger:      logger,
+		sessions:    map[uuid.UUID]*collabSession{},
+	}
+}
+
+// Handles a WebSocket connection. The 'noteID', 'userID', 'username' and 'authorize' locals must be set
+// before upgrading.
+func (h *CollabHub) Handle(conn *websocket.Conn) {
+	noteID := conn.Locals("noteID").(uuid.UUID)
+	client := &collabClient{
+		userID:    conn.Locals("userID").(uuid.UUID),
+		username:  conn.Locals("username").(string),
+		authorize: conn.Locals("authorize").(CollabAuthorizer),
+		send:      make(chan []byte, collabSendQueueSize),
+		done:      make(chan struct{}),
+	}
+
+	conn.SetReadLimit(collabMaxMessageSize)
+
+	session, err := h.join(noteID, conn, client)
+	if err != nil {
+		_ = conn.WriteJSON(map[string]any{
+			"type":  "error",
+			"error": err.Error(),
+		})
+		return
+	}
+	go client.writeMessages(conn)
+	defer func() {
+		h.leave(session, conn)
+		// The connection must not be written to once the handler returns.
+		<-client.done
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msg := &collabMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			session.sendError(conn, err)
+			continue
+		}
+
+		switch msg.Type {
+		case "operation":
+			if msg.Operation == nil {
+				session.sendError(conn, errors.New(consts.ErrCollabInvalidOperation))
+				continue
+			}
+			if err := session.receive(h, conn, msg); err != nil {
+				session.sendError(conn, err)
+			}
+		default:
+			session.sendError(conn, errors.New(consts.ErrCollabUnknownMessageType))
+		}
+	}
+}
+
+// UpdateBody runs a change to the body of a note made outside of its collaborative editing session, such
+// as an update through the API or the restore of a revision. Pending changes of the session are saved
+// first and no operation is applied while the change runs, so they cannot be saved over it. The new body,
+// returned by the change, is then sent to the editors as an operation made by the given user.
+func (h *CollabHub) UpdateBody(noteID uuid.UUID, username string, update func() (string, error)) error {
+	session := h.acquire(noteID)
+	defer h.release(session)
+
+	h.flush(session)
+
+	body, err := update()
+	if err != nil || !session.loaded {
+		return err
+	}
+
+	op := replaceOperation(session.body, body)
+	if op.IsNoop() {
+		return nil
+	}
+	session.apply(op)
+	session.broadcast(nil, map[string]any{
+		"type":      "operation",
+		"revision":  session.revision(),
+		"operation": op,
+		"user":      username,
+	})
+
+	return nil
+}
+
+// join adds a client to the session of the given note, loading the note if the session was not open.
+func (h *CollabHub) join(noteID uuid.UUID, conn *websocket.Conn, client *collabClient) (*collabSession, error) {
+	session := h.acquire(noteID)
+	defer h.release(session)
+
+	if !session.loaded {
+		note, err := h.noteService.AuthorizeNote(context.Background(), client.userID, noteID, RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		session.ownerID = note.UserID
+		session.body = note.Body
+		session.loaded = true
+
+		go h.authorizeClients(session)
+	}
+
+	session.clients[conn] = client
+	session.write(conn, map[string]any{
+		"type":     "init",
+		"revision": session.revision(),
+		"body":     session.body,
+	})
+	session.broadcast(conn, map[string]any{
+		"type": "join",
+		"user": client.username,
+	})
+
+	return session, nil
+}
+
+// leave removes a client from its session. The last client to leave saves the note right away.
+func (h *CollabHub) leave(session *collabSession, conn *websocket.Conn) {
+	session.mu.Lock()
+	client := session.clients[conn]
+	delete(session.clients, conn)
+	client.close(websocket.CloseNormalClosure)
+	if len(session.clients) > 0 {
+		session.broadcast(nil, map[string]any{
+			"type": "leave",
+			"user": client.username,
+		})
+	} else {
+		h.flush(session)
+	}
+	session.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeIfIdle(session)
+}
+
+// acquire returns the session of a note, opening it if needed, with its lock held. Sessions are only
+// closed with their lock held, so it stays open until it is released.
+func (h *CollabHub) acquire(noteID uuid.UUID) *collabSession {
+	for {
+		h.mu.Lock()
+		session, ok := h.sessions[noteID]
+		if !ok {
+			session = &collabSession{
+				noteID:  noteID,
+				clients: map[*websocket.Conn]*collabClient{},
+			}
+			h.sessions[noteID] = session
+		}
+		h.mu.Unlock()
+
+		// The hub is not locked while waiting for the session, which may be saving the note.
+		session.mu.Lock()
+		if !session.closed {
+			return session
+		}
+		session.mu.Unlock()
+	}
+}
+
+// release unlocks a session returned by 'acquire', closing it if it is not used anymore.
+func (h *CollabHub) release(session *collabSession) {
+	session.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeIfIdle(session)
+}
+
+// closeIfIdle closes a session without clients nor pending changes. The hub lock must be held.
+func (h *CollabHub) closeIfIdle(session *collabSession) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if len(session.clients) == 0 && session.saveTimer == nil && !session.closed {
+		delete(h.sessions, session.noteID)
+		session.closed = true
+	}
+}
+
+// save persists the pending changes of a session when its save timer fires.
+func (h *CollabHub) save(session *collabSession) {
+	session.mu.Lock()
+	h.flush(session)
+	session.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeIfIdle(session)
+}
+
+// flush persists the current body of a session if it has pending changes. The session lock must be held,
+// so no operation is applied until the note is saved. If saving fails, the changes stay pending and are
+// saved again later, keeping the session open, unless the note does not exist anymore.
+func (h *CollabHub) flush(session *collabSession) {
+	if session.saveTimer == nil {
+		return
+	}
+	session.saveTimer.Stop()
+	session.saveTimer = nil
+
+	err := h.noteService.UpdateNoteBody(context.Background(), session.ownerID, session.noteID, session.lastEditorID, session.body)
+	if err == gorm.ErrRecordNotFound {
+		h.logger.Warn().Str("note_id", session.noteID.String()).Msg("Discarded the changes of a deleted note being edited")
+	} else if err != nil {
+		h.logger.Error().Err(err).Str("note_id", session.noteID.String()).Msg("Failed to save a note being edited, retrying")
+		session.saveTimer = time.AfterFunc(collabSaveRetryDelay, func() {
+			h.save(session)
+		})
+	}
+}
+
+// authorizeClients periodically disconnects the clients of a session that cannot edit the note anymore,
+// until the session is closed. Clients are kept if checking their access fails.
+func (h *CollabHub) authorizeClients(session *collabSession) {
+	ticker := time.NewTicker(collabAuthorizeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		session.mu.Lock()
+		if session.closed {
+			session.mu.Unlock()
+			return
+		}
+		clients := make(map[*websocket.Conn]*collabClient, len(session.clients))
+		for conn, client := range session.clients {
+			clients[conn] = client
+		}
+		session.mu.Unlock()
+
+		// The session is not locked while checking, so editing is not blocked by the database.
+		for conn, client := range clients {
+			authorized, err := client.authorize(context.Background())
+			if err != nil {
+				h.logger.Error().Err(err).Str("note_id", session.noteID.String()).Msg("Failed to check the access of a note editor")
+				continue
+			}
+			if !authorized {
+				h.disconnect(session, conn)
+			}
+		}
+	}
+}
+
+// disconnect closes the connection of a client that cannot edit the note anymore, telling them why.
+func (h *CollabHub) disconnect(session *collabSession, conn *websocket.Conn) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	// The client may have left while its access was checked.
+	client, ok := session.clients[conn]
+	if !ok {
+		return
+	}
+	session.write(conn, map[string]any{
+		"type":  "error",
+		"error": consts.ErrCollabAccessRevoked,
+	})
+	client.close(websocket.ClosePolicyViolation)
+}
+
+// receive transforms an operation against the ones applied since its revision, applies it
+// and sends it to the rest of the clients.
+func (s *collabSession) receive(h *CollabHub, conn *websocket.Conn, msg *collabMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.Revision < s.baseRevision || msg.Revision > s.revision() {
+		return errors.New(consts.ErrCollabInvalidRevision)
+	}
+
+	op := msg.Operation
+	for _, concurrent := range s.history[msg.Revision-s.baseRevision:] {
+		var err error
+		op, _, err = ot.Transform(op, concurrent)
+		if err != nil {
+			return errors.New(consts.ErrCollabInvalidOperation)
+		}
+	}
+
+	if _, err := op.Apply(s.body); err != nil {
+		return errors.New(consts.ErrCollabInvalidOperation)
+	}
+
+	s.apply(op)
+	s.lastEditorID = s.clients[conn].userID
+
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(collabSaveDelay, func() {
+			h.save(s)
+		})
+	}
+
+	s.write(conn, map[string]any{
+		"type":     "ack",
+		"revision": s.revision(),
+	})
+	s.broadcast(conn, map[string]any{
+		"type":      "operation",
+		"revision":  s.revision(),
+		"operation": op,
+		"user":      s.clients[conn].username,
+	})
+
+	return nil
+}
+
+// apply applies an operation that is known to be valid to the body and adds it to the history. The
+// session lock must be held.
+func (s *collabSession) apply(op *ot.Operation) {
+	s.body, _ = op.Apply(s.body)
+	s.history = append(s.history, op)
+	if len(s.history) > collabMaxHistory {
+		s.history = s.history[1:]
+		s.baseRevision++
+	}
+}
+
+// revision returns the number of operations applied since the session was opened.
+func (s *collabSession) revision() int {
+	return s.baseRevision + len(s.history)
+}
+
+// sendError sends an error message to a client.
+func (s *collabSession) sendError(conn *websocket.Conn, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.write(conn, map[string]any{
+		"type":  "error",
+		"error": err.Error(),
+	})
+}
+
+// broadcast sends a message to every client except the given one. The session lock must be held.
+func (s *collabSession) broadcast(except *websocket.Conn, msg any) {
+	for client := range s.clients {
+		if client != except {
+			s.write(client, msg)
+		}
+	}
+}
+
+// write queues a message to be sent to a client, closing the client if its queue is full. The session
+// lock must be held.
+func (s *collabSession) write(conn *websocket.Conn, msg any) {
+	client, ok := s.clients[conn]
+	if !ok || client.closed {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		// The client will have to reload the note, as it has missed messages.
+		client.close(websocket.CloseTryAgainLater)
+	}
+}
+
+// close stops the client once its queued messages are written, closing the connection with the given
+// code. The client stays in the session until 'Handle' returns. The session lock must be held.
+func (c *collabClient) close(code int) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeCode = code
+	close(c.send)
+}
+
+// writeMessages writes the queued messages of a client until it is closed or writing fails, as
+// connections do not support concurrent writers. The read of 'Handle' is then interrupted, so the
+// client leaves the session.
+func (c *collabClient) writeMessages(conn *websocket.Conn) {
+	defer close(c.done)
+
+	for data := range c.send {
+		_ = conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			_ = conn.SetReadDeadline(time.Now())
+			return
+		}
+	}
+
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, ""), time.Now().Add(collabWriteTimeout))
+	// Closing the connection only takes effect once 'Handle' returns, so its read is interrupted instead.
+	_ = conn.SetReadDeadline(time.Now())
+}
+
+// replaceOperation returns an operation turning a body into another, keeping their common prefix and suffix
+// so the cursors of the editors outside of the change stay in place.
+func replaceOperation(from string, to string) *ot.Operation {
+	a, b := []rune(from), []rune(to)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return ot.New().
+		Retain(prefix).
+		Delete(len(a) - prefix - suffix).
+		Insert(string(b[prefix : len(b)-suffix])).
+		Retain(suffix)
+}
@@ -0,0 +1,166 @@
+package note
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/pkg/ot"
+	"github.com/rs/zerolog"
+)
+
+// fakeCollabNoteService serves a single note and keeps the bodies saved by the collaborative editing sessions.
+// Methods not needed by the sessions are left to the embedded interface, calling them panics.
+type fakeCollabNoteService struct {
+	NoteService
+	note  Note
+	mu    sync.Mutex
+	saved []string
+}
+
+func (s *fakeCollabNoteService) AuthorizeNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, role Role) (*Note, error) {
+	note := s.note
+	return &note, nil
+}
+
+func (s *fakeCollabNoteService) UpdateNoteBody(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, authorID uuid.UUID, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, body)
+	return nil
+}
+
+// newCollabTestServer serves the sessions of a hub, returning the URL of the session of its note.
+func newCollabTestServer(t *testing.T, hub *CollabHub, noteID uuid.UUID) string {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		c.Locals("noteID", noteID)
+		c.Locals("userID", uuid.New())
+		c.Locals("username", c.Query("user"))
+		c.Locals("authorize", CollabAuthorizer(func(ctx context.Context) (bool, error) {
+			return true, nil
+		}))
+		return c.Next()
+	}, websocket.New(hub.Handle))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		_ = app.Listener(listener)
+	}()
+	t.Cleanup(func() {
+		_ = app.Shutdown()
+	})
+
+	return "ws://" + listener.Addr().String() + "/ws"
+}
+
+func dialCollab(t *testing.T, url string, username string) *fastws.Conn {
+	conn, _, err := fastws.DefaultDialer.Dial(url+"?user="+username, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func readCollab(t *testing.T, conn *fastws.Conn) map[string]any {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := map[string]any{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read a message: %v", err)
+	}
+	return msg
+}
+
+func TestCollabSession(t *testing.T) {
+	service := &fakeCollabNoteService{note: Note{ID: uuid.New(), UserID: uuid.New(), Body: "hello"}}
+	hub := NewCollabHub(service, zerolog.Nop())
+	url := newCollabTestServer(t, hub, service.note.ID)
+
+	alice := dialCollab(t, url, "alice")
+	if msg := readCollab(t, alice); msg["type"] != "init" || msg["body"] != "hello" {
+		t.Fatalf("expected the body of the note, got %v", msg)
+	}
+	bob := dialCollab(t, url, "bob")
+	readCollab(t, bob)
+	if msg := readCollab(t, alice); msg["type"] != "join" || msg["user"] != "bob" {
+		t.Fatalf("expected bob to join, got %v", msg)
+	}
+
+	err := alice.WriteJSON(collabMessage{Type: "operation", Revision: 0, Operation: ot.New().Retain(5).Insert(" world")})
+	if err != nil {
+		t.Fatalf("failed to send an operation: %v", err)
+	}
+	if msg := readCollab(t, alice); msg["type"] != "ack" || msg["revision"] != float64(1) {
+		t.Errorf("expected the operation to be acknowledged, got %v", msg)
+	}
+	if msg := readCollab(t, bob); msg["type"] != "operation" || msg["user"] != "alice" {
+		t.Errorf("expected the operation of alice, got %v", msg)
+	}
+
+	// The last client to leave saves the note.
+	_ = alice.Close()
+	if msg := readCollab(t, bob); msg["type"] != "leave" || msg["user"] != "alice" {
+		t.Errorf("expected alice to leave, got %v", msg)
+	}
+	_ = bob.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		service.mu.Lock()
+		saved := service.saved
+		service.mu.Unlock()
+		if len(saved) == 1 && saved[0] == "hello world" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the note to be saved, got %v", saved)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCollabSlowClientIsClosed(t *testing.T) {
+	// The connections are only used to identify the clients, as their writers are not running.
+	slowConn, conn := &websocket.Conn{}, &websocket.Conn{}
+	slow := &collabClient{username: "slow", send: make(chan []byte, 1)}
+	client := &collabClient{username: "client", send: make(chan []byte, 2)}
+	session := &collabSession{clients: map[*websocket.Conn]*collabClient{slowConn: slow, conn: client}}
+
+	session.broadcast(nil, map[string]any{"type": "join"})
+	// Writing to a client with a full queue does not block.
+	session.broadcast(nil, map[string]any{"type": "leave"})
+
+	if !slow.closed || slow.closeCode != websocket.CloseTryAgainLater {
+		t.Errorf("expected the slow client to be closed, got %t, %d", slow.closed, slow.closeCode)
+	}
+	if client.closed || len(client.send) != 2 {
+		t.Errorf("expected the other client to receive both messages, got %d", len(client.send))
+	}
+
+	// Closed clients do not receive messages anymore.
+	session.write(slowConn, map[string]any{"type": "ack"})
+	var messages []string
+	for data := range slow.send {
+		msg := map[string]any{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		messages = append(messages, msg["type"].(string))
+	}
+	if len(messages) != 1 || messages[0] != "join" {
+		t.Errorf("expected only the first message to be queued, got %v", messages)
+	}
+}
@@ -0,0 +1,330 @@
+package note
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Represents the 'Note' object.
+type Note struct {
+	ID     uuid.UUID `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;index;not null"`
+	Title  string    `json:"title" gorm:"not null"`
+	Body   string    `json:"body" gorm:"not null"`
+	// NotebookID is nil for notes outside of any notebook.
+	NotebookID *uuid.UUID     `json:"notebook_id" gorm:"type:uuid;index"`
+	Tags       []Tag          `json:"tags" gorm:"many2many:note_tags"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" gorm:"index"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	// Role of the current user on the note, set when it is authorized.
+	Role Role `json:"role,omitempty" gorm:"-"`
+}
+
+// BeforeCreate will set default values for the note.
+func (note *Note) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	note.ID = uuid.New()
+	// Set the created and updated times.
+	now := time.Now()
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	return
+}
+
+// BeforeUpdate will set default values for the note.
+func (note *Note) BeforeUpdate(tx *gorm.DB) (err error) {
+	note.UpdatedAt = time.Now()
+	return
+}
+
+// Represents a folder of notes, which can be nested in other notebooks.
+type Notebook struct {
+	ID     uuid.UUID `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;index;not null"`
+	// ParentID is nil for top level notebooks.
+	ParentID  *uuid.UUID     `json:"parent_id" gorm:"type:uuid;index"`
+	Name      string         `json:"name" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// Role of the current user on the notebook, set when it is authorized.
+	Role Role `json:"role,omitempty" gorm:"-"`
+}
+
+// BeforeCreate will set default values for the notebook.
+func (notebook *Notebook) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	notebook.ID = uuid.New()
+	now := time.Now()
+	notebook.CreatedAt = now
+	notebook.UpdatedAt = now
+	return
+}
+
+// Represents a label given to notes. Tag names are unique for each user.
+type Tag struct {
+	ID        uuid.UUID `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID    uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_tags_user_name"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex:idx_tags_user_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate will set default values for the tag.
+func (tag *Tag) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	tag.ID = uuid.New()
+	tag.CreatedAt = time.Now()
+	return
+}
+
+// Represents a tag along with the number of notes that have it.
+type TagCount struct {
+	Tag
+	NoteCount int64 `json:"note_count"`
+}
+
+// Role is the access level of a user to a note or notebook, each role can do everything the
+// previous ones can. Viewers can read, commenters can also comment, editors can also change the
+// title, body and tags of notes and owners can also move, delete and share them.
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+	RoleEditor    Role = "editor"
+	RoleOwner     Role = "owner"
+)
+
+// Level of each role, used to compare them.
+var roleLevels = map[Role]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleOwner:     4,
+}
+
+// Valid returns whether the role is one of the defined roles.
+func (role Role) Valid() bool {
+	return roleLevels[role] > 0
+}
+
+// Includes returns whether the role allows everything the other role does.
+func (role Role) Includes(other Role) bool {
+	return other.Valid() && roleLevels[role] >= roleLevels[other]
+}
+
+// Represents the access of a user to a note, or to a notebook along with all the notebooks and
+// notes in it. Exactly one of NoteID and NotebookID is set.
+type Share struct {
+	ID         uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid"`
+	NoteID     *uuid.UUID `json:"note_id" gorm:"type:uuid;uniqueIndex:idx_shares_note_user"`
+	NotebookID *uuid.UUID `json:"notebook_id" gorm:"type:uuid;uniqueIndex:idx_shares_notebook_user"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_shares_note_user;uniqueIndex:idx_shares_notebook_user"`
+	Role       Role       `json:"role" gorm:"not null"`
+	CreatedBy  uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// Username of the user the share is for, set when listing the shares of a note or notebook.
+	Username string `json:"username,omitempty" gorm:"->;-:migration"`
+	// Title of the note or name of the notebook, set when listing the shares received or given by a user.
+	Name string `json:"name,omitempty" gorm:"->;-:migration"`
+	// Username of the user who created the share, set when listing the shares received by a user.
+	SharedBy string `json:"shared_by,omitempty" gorm:"->;-:migration"`
+}
+
+// BeforeCreate will set default values for the share.
+func (share *Share) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	share.ID = uuid.New()
+	now := time.Now()
+	share.CreatedAt = now
+	share.UpdatedAt = now
+	return
+}
+
+// Represents a link that gives anyone read-only access to a note without an account. The slug is the
+// random part of the link. If the link has a password, only its Argon2id hash is stored.
+type PublicLink struct {
+	ID           uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid"`
+	NoteID       uuid.UUID  `json:"note_id" gorm:"type:uuid;index;not null"`
+	Slug         string     `json:"slug" gorm:"uniqueIndex;not null"`
+	PasswordHash string     `json:"-"`
+	HasPassword  bool       `json:"has_password" gorm:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Views        int64      `json:"views" gorm:"not null;default:0"`
+	CreatedBy    uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Address where the link can be opened, set by the handlers.
+	URL string `json:"url,omitempty" gorm:"-"`
+}
+
+// BeforeCreate will set default values for the public link.
+func (link *PublicLink) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	link.ID = uuid.New()
+	link.CreatedAt = time.Now()
+	return
+}
+
+// AfterFind tells whether the link has a password, as its hash is never exposed.
+func (link *PublicLink) AfterFind(tx *gorm.DB) (err error) {
+	link.HasPassword = link.PasswordHash != ""
+	return
+}
+
+// Represents an immutable version of the body of a note. A revision is saved every time the body
+// of a note changes, attributed to the user who changed it.
+type Revision struct {
+	ID       uuid.UUID `json:"id" gorm:"primaryKey;type:uuid"`
+	NoteID   uuid.UUID `json:"note_id" gorm:"type:uuid;index;not null"`
+	AuthorID uuid.UUID `json:"author_id" gorm:"type:uuid;not null"`
+	// Body is omitted when listing revisions.
+	Body string `json:"body,omitempty" gorm:"not null"`
+	// Size of the body in bytes.
+	Size int `json:"size" gorm:"not null"`
+	// ContentHash is the hex encoded SHA-256 hash of the body.
+	ContentHash string    `json:"content_hash" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+// NewRevision returns a new revision of a note with the given body.
+func NewRevision(noteID uuid.UUID, authorID uuid.UUID, body string) *Revision {
+	hash := sha256.Sum256([]byte(body))
+	return &Revision{
+		NoteID:      noteID,
+		AuthorID:    authorID,
+		Body:        body,
+		Size:        len(body),
+		ContentHash: hex.EncodeToString(hash[:]),
+	}
+}
+
+// BeforeCreate will set default values for the revision.
+func (revision *Revision) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	revision.ID = uuid.New()
+	revision.CreatedAt = time.Now()
+	return
+}
+
+// Represents a note matching a search, without its body.
+type SearchResult struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+	// TitleHighlight and Snippet, a fragment of the body, are HTML escaped with the matched terms
+	// wrapped in <mark> elements.
+	TitleHighlight string `json:"title_highlight"`
+	Snippet        string `json:"snippet"`
+	// Rank is the relevance of the note, higher is better. It can only be compared with the ranks of
+	// the same search.
+	Rank      float64   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListOptions holds the pagination, sorting and filtering options used when listing notes and revisions.
+type ListOptions struct {
+	Page    int
+	PerPage int
+	// Order is the sort direction applied to 'updated_at' of notes or 'created_at' of revisions,
+	// either "asc" or "desc".
+	Order string
+	// NotebookID only lists the notes of a notebook if set, uuid.Nil lists the notes outside of any notebook.
+	NotebookID *uuid.UUID
+	// Tags only lists the notes that have all of the given tags if set.
+	Tags []string
+}
+
+// Our repository will implement these methods.
+type NoteRepository interface {
+	GetNotes(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*[]Note, int64, error)
+	GetAllNotes(ctx context.Context, userID uuid.UUID) (*[]Note, error)
+	GetNoteByID(ctx context.Context, noteID uuid.UUID) (*Note, error)
+	CreateNote(ctx context.Context, note *Note) error
+	UpdateNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, note *Note) error
+	UpdateNoteBody(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, body string) error
+	DeleteNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) error
+	GetRevisions(ctx context.Context, noteID uuid.UUID, opts *ListOptions) (*[]Revision, int64, error)
+	GetAllRevisions(ctx context.Context, userID uuid.UUID) (*[]Revision, error)
+	GetRevision(ctx context.Context, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error)
+	GetLatestRevision(ctx context.Context, noteID uuid.UUID) (*Revision, error)
+	CreateRevision(ctx context.Context, revision *Revision) error
+	PruneRevisions(ctx context.Context, maxPerNote int, createdBefore time.Time) (int64, error)
+	SearchNotes(ctx context.Context, userID uuid.UUID, terms []string, opts *ListOptions) (*[]SearchResult, int64, error)
+	SetNoteNotebook(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, notebookID *uuid.UUID) error
+	SetNoteTags(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, tags []string) error
+	GetNotebooks(ctx context.Context, userID uuid.UUID) (*[]Notebook, error)
+	GetNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*Notebook, error)
+	GetNotebookByID(ctx context.Context, notebookID uuid.UUID) (*Notebook, error)
+	GetChildNotebooks(ctx context.Context, notebookID uuid.UUID) (*[]Notebook, error)
+	CreateNotebook(ctx context.Context, notebook *Notebook) error
+	UpdateNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, name string, parentID *uuid.UUID) error
+	DeleteNotebooks(ctx context.Context, userID uuid.UUID, notebookIDs []uuid.UUID) error
+	GetTags(ctx context.Context, userID uuid.UUID) (*[]TagCount, error)
+	DeleteTag(ctx context.Context, userID uuid.UUID, tagID uuid.UUID) error
+	GetUserShares(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID, notebookIDs []uuid.UUID) (*[]Share, error)
+	GetNoteShares(ctx context.Context, noteID uuid.UUID) (*[]Share, error)
+	GetNotebookShares(ctx context.Context, notebookID uuid.UUID) (*[]Share, error)
+	GetReceivedShares(ctx context.Context, userID uuid.UUID) (*[]Share, error)
+	GetGivenShares(ctx context.Context, userID uuid.UUID) (*[]Share, error)
+	GetShare(ctx context.Context, shareID uuid.UUID) (*Share, error)
+	CreateShare(ctx context.Context, share *Share) error
+	UpdateShareRole(ctx context.Context, shareID uuid.UUID, role Role) error
+	DeleteShare(ctx context.Context, shareID uuid.UUID) error
+	GetPublicLinks(ctx context.Context, noteID uuid.UUID) (*[]PublicLink, error)
+	GetAllPublicLinks(ctx context.Context, userID uuid.UUID) (*[]PublicLink, error)
+	GetPublicLinkBySlug(ctx context.Context, slug string) (*PublicLink, error)
+	CreatePublicLink(ctx context.Context, link *PublicLink) error
+	DeletePublicLink(ctx context.Context, noteID uuid.UUID, linkID uuid.UUID) error
+	IncrementPublicLinkViews(ctx context.Context, linkID uuid.UUID) error
+	PurgeUser(ctx context.Context, tx *gorm.DB, userID uuid.UUID) error
+}
+
+// Our use-case or service will implement these methods.
+type NoteService interface {
+	GetNotes(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*[]Note, int64, error)
+	GetAllNotes(ctx context.Context, userID uuid.UUID) (*[]Note, error)
+	GetNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*Note, error)
+	CreateNote(ctx context.Context, note *Note) error
+	UpdateNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, note *Note) error
+	UpdateNoteBody(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, authorID uuid.UUID, body string) error
+	DeleteNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) error
+	GetRevisions(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, opts *ListOptions) (*[]Revision, int64, error)
+	GetAllRevisions(ctx context.Context, userID uuid.UUID) (*[]Revision, error)
+	GetRevision(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error)
+	DiffRevisions(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, fromID uuid.UUID, toID uuid.UUID) (string, error)
+	RestoreRevision(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error)
+	PruneRevisions(ctx context.Context, maxPerNote int, createdBefore time.Time) (int64, error)
+	SearchNotes(ctx context.Context, userID uuid.UUID, query string, opts *ListOptions) (*[]SearchResult, int64, error)
+	SetNoteNotebook(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, notebookID *uuid.UUID) error
+	SetNoteTags(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, tags []string) error
+	GetNotebooks(ctx context.Context, userID uuid.UUID) (*[]Notebook, error)
+	GetNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*Notebook, error)
+	CreateNotebook(ctx context.Context, notebook *Notebook) error
+	UpdateNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, name string, parentID *uuid.UUID) error
+	DeleteNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) error
+	GetChildNotebooks(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*[]Notebook, error)
+	GetTags(ctx context.Context, userID uuid.UUID) (*[]TagCount, error)
+	DeleteTag(ctx context.Context, userID uuid.UUID, tagID uuid.UUID) error
+	AuthorizeNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, role Role) (*Note, error)
+	AuthorizeNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, role Role) (*Notebook, error)
+	GetNoteShares(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*[]Share, error)
+	GetNotebookShares(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*[]Share, error)
+	GetReceivedShares(ctx context.Context, userID uuid.UUID) (*[]Share, error)
+	GetGivenShares(ctx context.Context, userID uuid.UUID) (*[]Share, error)
+	ShareNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, granteeID uuid.UUID, role Role) (*Share, error)
+	ShareNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, granteeID uuid.UUID, role Role) (*Share, error)
+	UpdateShare(ctx context.Context, userID uuid.UUID, shareID uuid.UUID, role Role) (*Share, error)
+	DeleteShare(ctx context.Context, userID uuid.UUID, shareID uuid.UUID) error
+	GetPublicLinks(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*[]PublicLink, error)
+	GetAllPublicLinks(ctx context.Context, userID uuid.UUID) (*[]PublicLink, error)
+	CreatePublicLink(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, password string, expiresAt *time.Time) (*PublicLink, error)
+	DeletePublicLink(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, linkID uuid.UUID) error
+	GetPublicNote(ctx context.Context, slug string, password string) (*Note, error)
+}
@@ -0,0 +1,434 @@
+package note
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	mailClient "github.com/jramsgz/articpad/pkg/mail"
+	"gorm.io/gorm"
+)
+
+// Maximum number of notes that can be requested in a single page.
+const maxPerPage = 100
+
+type NoteHandler struct {
+	noteService NoteService
+	userService user.UserService
+	denylist    auth.TokenDenylist
+	collabHub   *CollabHub
+	mailer      *mailClient.Mailer
+	i18n        *i18n.I18n
+}
+
+// Creates a new note handler.
+func NewNoteHandler(noteRoute fiber.Router, ns NoteService, us user.UserService, denylist auth.TokenDenylist, hub *CollabHub, mail *mailClient.Mailer, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		userService: us,
+		denylist:    denylist,
+		collabHub:   hub,
+		mailer:      mail,
+		i18n:        i18n,
+	}
+
+	// Registered before the JWT middleware below as it authenticates using the 'token' query parameter.
+	noteRoute.Get("/:noteID/ws", auth.WebSocketJWTMiddleware(denylist), auth.GetDataFromJWT, handler.upgradeCollab, websocket.New(handler.collabHub.Handle))
+
+	noteRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	noteRoute.Get("", handler.getNotes)
+	noteRoute.Post("", handler.createNote)
+	noteRoute.Get("/:noteID", handler.getNote)
+	noteRoute.Put("/:noteID", handler.updateNote)
+	noteRoute.Delete("/:noteID", handler.deleteNote)
+	noteRoute.Put("/:noteID/notebook", handler.setNoteNotebook)
+	noteRoute.Put("/:noteID/tags", handler.setNoteTags)
+	noteRoute.Get("/:noteID/revisions", handler.getRevisions)
+	noteRoute.Get("/:noteID/revisions/diff", handler.diffRevisions)
+	noteRoute.Get("/:noteID/revisions/:revisionID", handler.getRevision)
+	noteRoute.Post("/:noteID/revisions/:revisionID/restore", handler.restoreRevision)
+	noteRoute.Get("/:noteID/shares", handler.getNoteShares)
+	noteRoute.Post("/:noteID/shares", handler.shareNote)
+	noteRoute.Get("/:noteID/links", handler.getPublicLinks)
+	noteRoute.Post("/:noteID/links", handler.createPublicLink)
+	noteRoute.Delete("/:noteID/links/:linkID", handler.deletePublicLink)
+}
+
+// Gets a page of notes owned by the current user, or of the notes in a notebook shared with them.
+func (h *NoteHandler) getNotes(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	opts := &ListOptions{
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", 20),
+		Order:   c.Query("order", "desc"),
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+		opts.PerPage = maxPerPage
+	}
+	if opts.Order != "asc" && opts.Order != "desc" {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "order must be either 'asc' or 'desc'")
+	}
+	// 'none' lists the notes outside of any notebook.
+	if notebookID := c.Query("notebook_id"); notebookID == "none" {
+		opts.NotebookID = &uuid.Nil
+	} else if notebookID != "" {
+		id, err := uuid.Parse(notebookID)
+		if err != nil {
+			return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+		}
+		opts.NotebookID = &id
+	}
+	if tags := c.Query("tags"); tags != "" {
+		opts.Tags = strings.Split(tags, ",")
+	}
+
+	notes, total, err := h.noteService.GetNotes(customContext, userID, opts)
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"notes":    notes,
+		"page":     opts.Page,
+		"per_page": opts.PerPage,
+		"total":    total,
+	})
+}
+
+// Gets a single note the current user can view.
+func (h *NoteHandler) getNote(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// Creates a new note owned by the current user, optionally in a notebook and with tags.
+func (h *NoteHandler) createNote(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Title      string     `json:"title"`
+		Body       string     `json:"body"`
+		NotebookID *uuid.UUID `json:"notebook_id"`
+		Tags       []string   `json:"tags"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	note := &Note{
+		UserID:     userID,
+		Title:      request.Title,
+		Body:       request.Body,
+		NotebookID: request.NotebookID,
+	}
+	for _, tag := range request.Tags {
+		note.Tags = append(note.Tags, Tag{Name: tag})
+	}
+
+	err = h.noteService.CreateNote(customContext, note)
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	note, err = h.noteService.GetNote(customContext, userID, note.ID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// Updates a note the current user can edit.
+func (h *NoteHandler) updateNote(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	// Editors of the note with the body open get the new body as an operation.
+	err = h.collabHub.UpdateBody(noteID, h.getUsername(c), func() (string, error) {
+		return request.Body, h.noteService.UpdateNote(customContext, userID, noteID, &Note{
+			Title: request.Title,
+			Body:  request.Body,
+		})
+	})
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// Moves a note to one of the notebooks of its owner, or out of any notebook if 'notebook_id' is null.
+// Only owners of the note can move it.
+func (h *NoteHandler) setNoteNotebook(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		NotebookID *uuid.UUID `json:"notebook_id"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.SetNoteNotebook(customContext, userID, noteID, request.NotebookID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// Replaces the tags of a note the current user can edit.
+func (h *NoteHandler) setNoteTags(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Tags []string `json:"tags"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.SetNoteTags(customContext, userID, noteID, request.Tags)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// Deletes a note the current user is an owner of.
+func (h *NoteHandler) deleteNote(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.DeleteNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+	})
+}
+
+// Checks that the current user can edit the note before upgrading to a WebSocket connection.
+func (h *NoteHandler) upgradeCollab(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	_, err = h.noteService.AuthorizeNote(customContext, userID, noteID, RoleEditor)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	c.Locals("noteID", noteID)
+	c.Locals("userID", userID)
+	c.Locals("username", h.getUsername(c))
+	c.Locals("authorize", h.collabAuthorizer(c, userID, noteID))
+	return c.Next()
+}
+
+// collabAuthorizer returns a function checking that the current user can still edit a note, as they
+// may stay connected to its collaborative editing session long after upgrading. Once the token expires,
+// its revocation may not be known anymore, so the client has to connect again with a new one.
+func (h *NoteHandler) collabAuthorizer(c *fiber.Ctx, userID uuid.UUID, noteID uuid.UUID) CollabAuthorizer {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+
+	return func(ctx context.Context) (bool, error) {
+		if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+			return false, nil
+		}
+
+		for _, id := range []string{jti, sid} {
+			revoked, err := h.denylist.IsRevoked(ctx, id)
+			if err != nil {
+				return false, err
+			}
+			if revoked {
+				return false, nil
+			}
+		}
+
+		_, err := h.noteService.AuthorizeNote(ctx, userID, noteID, RoleEditor)
+		if err == gorm.ErrRecordNotFound || (err != nil && err.Error() == consts.ErrNoteAccessDenied) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// getUserID returns the ID of the current user as set by 'auth.GetDataFromJWT'.
+func (h *NoteHandler) getUserID(c *fiber.Ctx) (uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Locals("currentUser").(string))
+	if err != nil {
+		return uuid.Nil, apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeInvalidJWT, "Invalid or expired JWT")
+	}
+	return userID, nil
+}
+
+// getUsername returns the username of the current user, as found in their JWT.
+func (h *NoteHandler) getUsername(c *fiber.Ctx) string {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	username, _ := claims["user"].(string)
+	return username
+}
+
+// mapNoteError maps the errors returned by the note service to API errors.
+func (h *NoteHandler) mapNoteError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeNoteNotFound, h.i18n.T(h.getLangCode(c), "errors.note_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
+
+func (h *NoteHandler) getLangCode(c *fiber.Ctx) string {
+	return h.i18n.ParseLanguage(c.Get("Accept-Language"))
+}
@@ -0,0 +1,171 @@
+package note
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/templates"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	"gorm.io/gorm"
+)
+
+// Creates a new handler for the pages of notes opened with public links. It is served outside of
+// the API, so the links can be opened in a browser without an account.
+func NewPublicNoteHandler(publicRoute fiber.Router, ns NoteService, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		i18n:        i18n,
+	}
+
+	publicRoute.Get("/:slug", handler.viewPublicNote)
+	// The password of a protected link is sent with a form.
+	publicRoute.Post("/:slug", handler.viewPublicNote)
+}
+
+// Gets the public links of a note. Only owners of the note can see them.
+func (h *NoteHandler) getPublicLinks(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	links, err := h.noteService.GetPublicLinks(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	for i := range *links {
+		setPublicLinkURL(&(*links)[i])
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"links":   links,
+	})
+}
+
+// Creates a public link that gives read-only access to a note, optionally protected by a password and
+// expiring at 'expires_at'.
+func (h *NoteHandler) createPublicLink(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Password  string     `json:"password"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	link, err := h.noteService.CreatePublicLink(customContext, userID, noteID, request.Password, request.ExpiresAt)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	setPublicLinkURL(link)
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success": true,
+		"link":    link,
+	})
+}
+
+// Revokes a public link of a note, it stops working right away.
+func (h *NoteHandler) deletePublicLink(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, noteID, err := h.getNoteIDs(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	linkID, err := uuid.Parse(c.Params("linkID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.DeletePublicLink(customContext, userID, noteID, linkID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodePublicLinkNotFound, h.i18n.T(h.getLangCode(c), "errors.public_link_not_found"))
+		}
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.public_link_deleted"),
+	})
+}
+
+// Renders the page of a note opened with a public link, or the form that asks for its password.
+func (h *NoteHandler) viewPublicNote(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	langCode := h.getLangCode(c)
+
+	// Pages are never cached, as the note may change and every view is counted, nor indexed.
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Robots-Tag", "noindex, nofollow")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'; img-src 'self'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'")
+	c.Type("html", "utf-8")
+
+	// The password is only read from the body of the form, never from the query string, so it does not
+	// end up in access logs, the browser history or referrers.
+	password := ""
+	if c.Method() == fiber.MethodPost {
+		password = string(c.Request().PostArgs().Peek("password"))
+	}
+
+	note, err := h.noteService.GetPublicNote(customContext, c.Params("slug"), password)
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			return c.Status(fiber.StatusNotFound).Send(templates.GetPublicNoteNotFoundPage(h.i18n, langCode))
+		case err.Error() == consts.ErrPublicLinkPasswordRequired:
+			return c.Status(fiber.StatusUnauthorized).Send(templates.GetPublicNotePasswordPage(h.i18n, langCode, ""))
+		case err.Error() == consts.ErrInvalidPublicLinkPassword:
+			return c.Status(fiber.StatusUnauthorized).Send(templates.GetPublicNotePasswordPage(h.i18n, langCode, h.i18n.T(langCode, "errors.invalid_public_link_password")))
+		default:
+			return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+		}
+	}
+
+	return c.Status(fiber.StatusOK).Send(templates.GetPublicNotePage(h.i18n, langCode, note.Title, note.Body, note.UpdatedAt))
+}
+
+// setPublicLinkURL sets the address where a public link can be opened.
+func setPublicLinkURL(link *PublicLink) {
+	link.URL = config.GetString("APP_URL") + "/s/" + link.Slug
+}
@@ -0,0 +1,200 @@
+package note
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	mailClient "github.com/jramsgz/articpad/pkg/mail"
+	"gorm.io/gorm"
+)
+
+// Creates a new handler for the notebooks of the current user.
+func NewNotebookHandler(notebookRoute fiber.Router, ns NoteService, us user.UserService, denylist auth.TokenDenylist, mail *mailClient.Mailer, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		userService: us,
+		mailer:      mail,
+		i18n:        i18n,
+	}
+
+	notebookRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	notebookRoute.Get("", handler.getNotebooks)
+	notebookRoute.Post("", handler.createNotebook)
+	notebookRoute.Get("/:notebookID", handler.getNotebook)
+	notebookRoute.Put("/:notebookID", handler.updateNotebook)
+	notebookRoute.Delete("/:notebookID", handler.deleteNotebook)
+	notebookRoute.Get("/:notebookID/shares", handler.getNotebookShares)
+	notebookRoute.Post("/:notebookID/shares", handler.shareNotebook)
+}
+
+// Gets every notebook of the current user. Nested notebooks reference their parent with 'parent_id'.
+func (h *NoteHandler) getNotebooks(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebooks, err := h.noteService.GetNotebooks(customContext, userID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":   true,
+		"notebooks": notebooks,
+	})
+}
+
+// Gets a single notebook the current user can view along with the notebooks nested directly in it.
+func (h *NoteHandler) getNotebook(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebookID, err := uuid.Parse(c.Params("notebookID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	notebook, err := h.noteService.GetNotebook(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	notebooks, err := h.noteService.GetChildNotebooks(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":   true,
+		"notebook":  notebook,
+		"notebooks": notebooks,
+	})
+}
+
+// Creates a new notebook owned by the current user, nested in another one if 'parent_id' is set.
+func (h *NoteHandler) createNotebook(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Name     string     `json:"name"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	notebook := &Notebook{
+		UserID:   userID,
+		Name:     request.Name,
+		ParentID: request.ParentID,
+	}
+
+	err = h.noteService.CreateNotebook(customContext, notebook)
+	if err != nil {
+		return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success":  true,
+		"notebook": notebook,
+	})
+}
+
+// Renames a notebook the current user is an owner of and moves it to the notebook in 'parent_id',
+// or to the top level if it is null.
+func (h *NoteHandler) updateNotebook(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Name     string     `json:"name"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebookID, err := uuid.Parse(c.Params("notebookID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.UpdateNotebook(customContext, userID, notebookID, request.Name, request.ParentID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	notebook, err := h.noteService.GetNotebook(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"notebook": notebook,
+	})
+}
+
+// Deletes a notebook the current user is an owner of along with its nested notebooks and all their notes.
+func (h *NoteHandler) deleteNotebook(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebookID, err := uuid.Parse(c.Params("notebookID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.DeleteNotebook(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+	})
+}
+
+// mapNotebookError maps the errors returned by the notebook methods of the note service to API errors.
+func (h *NoteHandler) mapNotebookError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeNotebookNotFound, h.i18n.T(h.getLangCode(c), "errors.notebook_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
@@ -0,0 +1,700 @@
+package note
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Markers placed around the matched terms of search results by the database, converted to HTML by the service.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// Represents that we will use gorm in order to implement the methods.
+type dbRepository struct {
+	db *gorm.DB
+}
+
+// Create a new repository with gorm as the driver.
+func NewNoteRepository(dbConnection *gorm.DB) NoteRepository {
+	return &dbRepository{
+		db: dbConnection,
+	}
+}
+
+// Gets a page of notes owned by a user, sorted by their last update.
+func (r *dbRepository) GetNotes(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*[]Note, int64, error) {
+	var notes []Note
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&Note{}).Where("user_id = ?", userID)
+	if opts.NotebookID != nil && *opts.NotebookID == uuid.Nil {
+		query = query.Where("notebook_id IS NULL")
+	} else if opts.NotebookID != nil {
+		query = query.Where("notebook_id = ?", *opts.NotebookID)
+	}
+	if len(opts.Tags) > 0 {
+		query = query.Where(`id IN (
+			SELECT note_tags.note_id FROM note_tags JOIN tags ON tags.id = note_tags.tag_id
+			WHERE tags.user_id = ? AND tags.name IN ? GROUP BY note_tags.note_id HAVING COUNT(*) = ?
+		)`, userID, opts.Tags, len(opts.Tags))
+	}
+
+	result := query.Count(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	order := "updated_at DESC"
+	if opts.Order == "asc" {
+		order = "updated_at ASC"
+	}
+
+	result = query.Preload("Tags", orderTags).Order(order).Offset((opts.Page - 1) * opts.PerPage).Limit(opts.PerPage).Find(&notes)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return &notes, total, nil
+}
+
+// Gets every note of a user, oldest first.
+func (r *dbRepository) GetAllNotes(ctx context.Context, userID uuid.UUID) (*[]Note, error) {
+	var notes []Note
+
+	result := r.db.WithContext(ctx).Preload("Tags", orderTags).Where("user_id = ?", userID).Order("created_at ASC").Find(&notes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &notes, nil
+}
+
+// Gets a single note by its ID, whoever owns it.
+func (r *dbRepository) GetNoteByID(ctx context.Context, noteID uuid.UUID) (*Note, error) {
+	note := &Note{}
+
+	result := r.db.WithContext(ctx).Preload("Tags", orderTags).Where("id = ?", noteID).First(note)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return note, nil
+}
+
+// Creates a single note in the database.
+func (r *dbRepository) CreateNote(ctx context.Context, note *Note) error {
+	result := r.db.WithContext(ctx).Create(note)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Updates a single note owned by a user.
+func (r *dbRepository) UpdateNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, note *Note) error {
+	result := r.db.WithContext(ctx).Model(&Note{}).Where("id = ? AND user_id = ?", noteID, userID).
+		Select("title", "body").Updates(note)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Updates the body of a single note owned by a user.
+func (r *dbRepository) UpdateNoteBody(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, body string) error {
+	result := r.db.WithContext(ctx).Model(&Note{}).Where("id = ? AND user_id = ?", noteID, userID).
+		Update("body", body)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Deletes a single note owned by a user.
+func (r *dbRepository) DeleteNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", noteID, userID).Delete(&Note{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets a page of the revisions of a note, sorted by their creation time. Their bodies are not loaded.
+func (r *dbRepository) GetRevisions(ctx context.Context, noteID uuid.UUID, opts *ListOptions) (*[]Revision, int64, error) {
+	var revisions []Revision
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&Revision{}).Where("note_id = ?", noteID)
+
+	result := query.Count(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	order := "created_at DESC"
+	if opts.Order == "asc" {
+		order = "created_at ASC"
+	}
+
+	result = query.Omit("body").Order(order).Offset((opts.Page - 1) * opts.PerPage).Limit(opts.PerPage).Find(&revisions)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return &revisions, total, nil
+}
+
+// Gets every revision of the notes owned by a user, with their body, oldest first.
+func (r *dbRepository) GetAllRevisions(ctx context.Context, userID uuid.UUID) (*[]Revision, error) {
+	var revisions []Revision
+
+	notes := r.db.WithContext(ctx).Model(&Note{}).Select("id").Where("user_id = ?", userID)
+	result := r.db.WithContext(ctx).Where("note_id IN (?)", notes).Order("note_id ASC, created_at ASC").Find(&revisions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &revisions, nil
+}
+
+// Gets a single revision of a note.
+func (r *dbRepository) GetRevision(ctx context.Context, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error) {
+	revision := &Revision{}
+
+	result := r.db.WithContext(ctx).Where("id = ? AND note_id = ?", revisionID, noteID).First(revision)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return revision, nil
+}
+
+// Gets the most recent revision of a note.
+func (r *dbRepository) GetLatestRevision(ctx context.Context, noteID uuid.UUID) (*Revision, error) {
+	revision := &Revision{}
+
+	result := r.db.WithContext(ctx).Where("note_id = ?", noteID).Order("created_at DESC").First(revision)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return revision, nil
+}
+
+// Creates a single revision in the database.
+func (r *dbRepository) CreateRevision(ctx context.Context, revision *Revision) error {
+	result := r.db.WithContext(ctx).Create(revision)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Deletes the revisions of every note beyond the most recent maxPerNote ones or created before the
+// given time, ignoring the limits that are zero. The most recent revision of a note is always kept.
+func (r *dbRepository) PruneRevisions(ctx context.Context, maxPerNote int, createdBefore time.Time) (int64, error) {
+	var conditions []string
+	var args []interface{}
+	if maxPerNote > 0 {
+		conditions = append(conditions, "position > ?")
+		args = append(args, maxPerNote)
+	}
+	if !createdBefore.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, createdBefore)
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.WithContext(ctx).Exec(`DELETE FROM revisions WHERE id IN (
+		SELECT id FROM (
+			SELECT id, created_at, ROW_NUMBER() OVER (PARTITION BY note_id ORDER BY created_at DESC) AS position
+			FROM revisions
+		) ranked WHERE position > 1 AND (`+strings.Join(conditions, " OR ")+`)
+	)`, args...)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Searches the titles and bodies of the notes of a user for the given terms, matching words that
+// start with each of them, sorted by relevance. It uses the full-text search of each database.
+func (r *dbRepository) SearchNotes(ctx context.Context, userID uuid.UUID, terms []string, opts *ListOptions) (*[]SearchResult, int64, error) {
+	var results []SearchResult
+	var total int64
+	var query, countQuery string
+	var match string
+
+	switch r.db.Dialector.Name() {
+	case "postgres":
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		match = strings.Join(prefixes, " & ")
+		countQuery = `SELECT COUNT(*) FROM notes
+			WHERE notes.search_vector @@ to_tsquery('simple', @match) AND notes.user_id = @user AND notes.deleted_at IS NULL`
+		query = `SELECT notes.id, notes.title, notes.created_at, notes.updated_at,
+				ts_headline('simple', notes.title, search_query, @titleOptions) AS title_highlight,
+				ts_headline('simple', notes.body, search_query, @snippetOptions) AS snippet,
+				ts_rank_cd(notes.search_vector, search_query) AS rank
+			FROM notes, to_tsquery('simple', @match) search_query
+			WHERE notes.search_vector @@ search_query AND notes.user_id = @user AND notes.deleted_at IS NULL
+			ORDER BY rank DESC, notes.updated_at DESC LIMIT @limit OFFSET @offset`
+	default:
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+		}
+		match = strings.Join(prefixes, " ")
+		countQuery = `SELECT COUNT(*) FROM notes_fts JOIN notes ON notes.rowid = notes_fts.rowid
+			WHERE notes_fts MATCH @match AND notes.user_id = @user AND notes.deleted_at IS NULL`
+		// Titles weigh ten times more than bodies. BM25 scores are negative, lower is better.
+		query = `SELECT notes.id, notes.title, notes.created_at, notes.updated_at,
+				highlight(notes_fts, 0, @start, @stop) AS title_highlight,
+				snippet(notes_fts, 1, @start, @stop, '…', 24) AS snippet,
+				-bm25(notes_fts, 10.0, 1.0) AS rank
+			FROM notes_fts JOIN notes ON notes.rowid = notes_fts.rowid
+			WHERE notes_fts MATCH @match AND notes.user_id = @user AND notes.deleted_at IS NULL
+			ORDER BY bm25(notes_fts, 10.0, 1.0), notes.updated_at DESC LIMIT @limit OFFSET @offset`
+	}
+
+	args := map[string]interface{}{
+		"match":          match,
+		"user":           userID,
+		"start":          highlightStart,
+		"stop":           highlightStop,
+		"titleOptions":   "HighlightAll=true, StartSel=" + highlightStart + ", StopSel=" + highlightStop,
+		"snippetOptions": "MaxWords=24, MinWords=12, MaxFragments=2, FragmentDelimiter=\" … \", StartSel=" + highlightStart + ", StopSel=" + highlightStop,
+		"limit":          opts.PerPage,
+		"offset":         (opts.Page - 1) * opts.PerPage,
+	}
+
+	result := r.db.WithContext(ctx).Raw(countQuery, args).Scan(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	result = r.db.WithContext(ctx).Raw(query, args).Scan(&results)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return &results, total, nil
+}
+
+// Moves a note owned by a user to a notebook, or out of any notebook if notebookID is nil.
+func (r *dbRepository) SetNoteNotebook(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, notebookID *uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&Note{}).Where("id = ? AND user_id = ?", noteID, userID).
+		Update("notebook_id", notebookID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Replaces the tags of a note owned by a user, creating the tags the user did not have yet.
+func (r *dbRepository) SetNoteTags(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, tags []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		note := &Note{}
+		if err := tx.Where("id = ? AND user_id = ?", noteID, userID).First(note).Error; err != nil {
+			return err
+		}
+
+		noteTags := make([]Tag, len(tags))
+		for i, name := range tags {
+			if err := tx.Where(&Tag{UserID: userID, Name: name}).FirstOrCreate(&noteTags[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		// The tags already exist, only the join table is updated.
+		return tx.Model(note).Omit("Tags.*").Association("Tags").Replace(noteTags)
+	})
+}
+
+// Gets every notebook of a user, sorted by name.
+func (r *dbRepository) GetNotebooks(ctx context.Context, userID uuid.UUID) (*[]Notebook, error) {
+	var notebooks []Notebook
+
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("name ASC").Find(&notebooks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &notebooks, nil
+}
+
+// Gets a single notebook owned by a user.
+func (r *dbRepository) GetNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*Notebook, error) {
+	notebook := &Notebook{}
+
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", notebookID, userID).First(notebook)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return notebook, nil
+}
+
+// Gets a single notebook by its ID, whoever owns it.
+func (r *dbRepository) GetNotebookByID(ctx context.Context, notebookID uuid.UUID) (*Notebook, error) {
+	notebook := &Notebook{}
+
+	result := r.db.WithContext(ctx).Where("id = ?", notebookID).First(notebook)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return notebook, nil
+}
+
+// Gets the notebooks nested directly in a notebook, sorted by name.
+func (r *dbRepository) GetChildNotebooks(ctx context.Context, notebookID uuid.UUID) (*[]Notebook, error) {
+	var notebooks []Notebook
+
+	result := r.db.WithContext(ctx).Where("parent_id = ?", notebookID).Order("name ASC").Find(&notebooks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &notebooks, nil
+}
+
+// Creates a single notebook in the database.
+func (r *dbRepository) CreateNotebook(ctx context.Context, notebook *Notebook) error {
+	result := r.db.WithContext(ctx).Create(notebook)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Renames and moves a notebook owned by a user.
+func (r *dbRepository) UpdateNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, name string, parentID *uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&Notebook{}).Where("id = ? AND user_id = ?", notebookID, userID).
+		Updates(map[string]interface{}{
+			"name":      name,
+			"parent_id": parentID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Soft deletes notebooks owned by a user along with the notes they contain.
+func (r *dbRepository) DeleteNotebooks(ctx context.Context, userID uuid.UUID, notebookIDs []uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id IN ? AND user_id = ?", notebookIDs, userID).Delete(&Notebook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Where("notebook_id IN ? AND user_id = ?", notebookIDs, userID).Delete(&Note{}).Error
+	})
+}
+
+// Gets every tag of a user with the number of notes that have it, sorted by name.
+func (r *dbRepository) GetTags(ctx context.Context, userID uuid.UUID) (*[]TagCount, error) {
+	// Scanning leaves the slice as it is when there are no rows, it is listed as empty rather than null.
+	tags := []TagCount{}
+
+	result := r.db.WithContext(ctx).Raw(`SELECT tags.id, tags.user_id, tags.name, tags.created_at, COUNT(notes.id) AS note_count
+		FROM tags
+		LEFT JOIN note_tags ON note_tags.tag_id = tags.id
+		LEFT JOIN notes ON notes.id = note_tags.note_id AND notes.deleted_at IS NULL
+		WHERE tags.user_id = ?
+		GROUP BY tags.id, tags.user_id, tags.name, tags.created_at
+		ORDER BY tags.name ASC`, userID).Scan(&tags)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &tags, nil
+}
+
+// Deletes a single tag owned by a user, removing it from its notes.
+func (r *dbRepository) DeleteTag(ctx context.Context, userID uuid.UUID, tagID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tag := &Tag{}
+		if err := tx.Where("id = ? AND user_id = ?", tagID, userID).First(tag).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM note_tags WHERE tag_id = ?", tagID).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(tag).Error
+	})
+}
+
+// Gets the shares of a user for a note, if noteID is set, and for any of the given notebooks.
+func (r *dbRepository) GetUserShares(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID, notebookIDs []uuid.UUID) (*[]Share, error) {
+	var shares []Share
+
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	switch {
+	case noteID != nil && len(notebookIDs) > 0:
+		query = query.Where("note_id = ? OR notebook_id IN ?", *noteID, notebookIDs)
+	case noteID != nil:
+		query = query.Where("note_id = ?", *noteID)
+	case len(notebookIDs) > 0:
+		query = query.Where("notebook_id IN ?", notebookIDs)
+	default:
+		return &shares, nil
+	}
+
+	result := query.Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &shares, nil
+}
+
+// Gets the shares of a note with the usernames of their users, oldest first.
+func (r *dbRepository) GetNoteShares(ctx context.Context, noteID uuid.UUID) (*[]Share, error) {
+	return r.getShares(ctx, "shares.note_id = ?", noteID)
+}
+
+// Gets the shares of a notebook with the usernames of their users, oldest first.
+func (r *dbRepository) GetNotebookShares(ctx context.Context, notebookID uuid.UUID) (*[]Share, error) {
+	return r.getShares(ctx, "shares.notebook_id = ?", notebookID)
+}
+
+// getShares gets the shares matching a condition with the usernames of their users, oldest first.
+func (r *dbRepository) getShares(ctx context.Context, condition string, id uuid.UUID) (*[]Share, error) {
+	var shares []Share
+
+	result := r.db.WithContext(ctx).Model(&Share{}).Select("shares.*, users.username AS username").
+		Joins("JOIN users ON users.id = shares.user_id AND users.deleted_at IS NULL").
+		Where(condition, id).Order("shares.created_at ASC").Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &shares, nil
+}
+
+// Gets the shares received by a user with the title of their note or the name of their notebook, newest
+// first. Shares of deleted notes and notebooks are left out.
+func (r *dbRepository) GetReceivedShares(ctx context.Context, userID uuid.UUID) (*[]Share, error) {
+	var shares []Share
+
+	result := r.db.WithContext(ctx).Model(&Share{}).
+		Select("shares.*, users.username AS shared_by, COALESCE(notes.title, notebooks.name) AS name").
+		Joins("LEFT JOIN users ON users.id = shares.created_by").
+		Joins("LEFT JOIN notes ON notes.id = shares.note_id AND notes.deleted_at IS NULL").
+		Joins("LEFT JOIN notebooks ON notebooks.id = shares.notebook_id AND notebooks.deleted_at IS NULL").
+		Where("shares.user_id = ? AND (notes.id IS NOT NULL OR notebooks.id IS NOT NULL)", userID).
+		Order("shares.created_at DESC").Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &shares, nil
+}
+
+// Gets the shares of the notes and notebooks owned by a user, with the usernames of their users, oldest first.
+func (r *dbRepository) GetGivenShares(ctx context.Context, userID uuid.UUID) (*[]Share, error) {
+	var shares []Share
+
+	result := r.db.WithContext(ctx).Model(&Share{}).
+		Select("shares.*, users.username AS username, COALESCE(notes.title, notebooks.name) AS name").
+		Joins("JOIN users ON users.id = shares.user_id AND users.deleted_at IS NULL").
+		Joins("LEFT JOIN notes ON notes.id = shares.note_id AND notes.deleted_at IS NULL").
+		Joins("LEFT JOIN notebooks ON notebooks.id = shares.notebook_id AND notebooks.deleted_at IS NULL").
+		Where("notes.user_id = ? OR notebooks.user_id = ?", userID, userID).
+		Order("shares.created_at ASC").Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &shares, nil
+}
+
+// Gets a single share by its ID.
+func (r *dbRepository) GetShare(ctx context.Context, shareID uuid.UUID) (*Share, error) {
+	share := &Share{}
+
+	result := r.db.WithContext(ctx).Where("id = ?", shareID).First(share)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return share, nil
+}
+
+// Creates a single share in the database.
+func (r *dbRepository) CreateShare(ctx context.Context, share *Share) error {
+	result := r.db.WithContext(ctx).Create(share)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Changes the role of a single share.
+func (r *dbRepository) UpdateShareRole(ctx context.Context, shareID uuid.UUID, role Role) error {
+	result := r.db.WithContext(ctx).Model(&Share{}).Where("id = ?", shareID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Deletes a single share.
+func (r *dbRepository) DeleteShare(ctx context.Context, shareID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", shareID).Delete(&Share{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the public links of a note, newest first.
+func (r *dbRepository) GetPublicLinks(ctx context.Context, noteID uuid.UUID) (*[]PublicLink, error) {
+	var links []PublicLink
+
+	result := r.db.WithContext(ctx).Where("note_id = ?", noteID).Order("created_at DESC").Find(&links)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &links, nil
+}
+
+// Gets the public links of every note owned by a user, including expired ones, oldest first.
+func (r *dbRepository) GetAllPublicLinks(ctx context.Context, userID uuid.UUID) (*[]PublicLink, error) {
+	var links []PublicLink
+
+	notes := r.db.WithContext(ctx).Model(&Note{}).Select("id").Where("user_id = ?", userID)
+	result := r.db.WithContext(ctx).Where("note_id IN (?)", notes).Order("created_at ASC").Find(&links)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &links, nil
+}
+
+// Gets a single public link by its slug.
+func (r *dbRepository) GetPublicLinkBySlug(ctx context.Context, slug string) (*PublicLink, error) {
+	link := &PublicLink{}
+
+	result := r.db.WithContext(ctx).Where("slug = ?", slug).First(link)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return link, nil
+}
+
+// Creates a single public link in the database.
+func (r *dbRepository) CreatePublicLink(ctx context.Context, link *PublicLink) error {
+	result := r.db.WithContext(ctx).Create(link)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Deletes a single public link of a note, which stops working right away.
+func (r *dbRepository) DeletePublicLink(ctx context.Context, noteID uuid.UUID, linkID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND note_id = ?", linkID, noteID).Delete(&PublicLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Adds one to the number of times a public link has been viewed.
+func (r *dbRepository) IncrementPublicLinkViews(ctx context.Context, linkID uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&PublicLink{}).Where("id = ?", linkID).
+		UpdateColumn("views", gorm.Expr("views + 1")).Error
+}
+
+// Permanently deletes the notes, notebooks and tags of a user, along with the shares they gave or received
+// and everything attached to their notes. Run in the transaction that permanently deletes the user.
+func (r *dbRepository) PurgeUser(ctx context.Context, tx *gorm.DB, userID uuid.UUID) error {
+	tx = tx.WithContext(ctx)
+	// Notes and notebooks in the trash are deleted too.
+	notes := tx.Unscoped().Model(&Note{}).Select("id").Where("user_id = ?", userID)
+	notebooks := tx.Unscoped().Model(&Notebook{}).Select("id").Where("user_id = ?", userID)
+
+	if err := tx.Where("user_id = ? OR note_id IN (?) OR notebook_id IN (?)", userID, notes, notebooks).Delete(&Share{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN (?)", notes).Delete(&PublicLink{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN (?)", notes).Delete(&Revision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM note_tags WHERE note_id IN (?)", notes).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&Note{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&Tag{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Where("user_id = ?", userID).Delete(&Notebook{}).Error
+}
+
+// orderTags sorts the tags preloaded with notes by name.
+func orderTags(db *gorm.DB) *gorm.DB {
+	return db.Order("tags.name ASC")
+}
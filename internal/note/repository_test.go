@@ -0,0 +1,406 @@
+package note
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+	"gorm.io/gorm"
+)
+
+// newTestNoteService returns a note service backed by an empty database.
+func newTestNoteService(t *testing.T) (NoteService, *gorm.DB) {
+	db := testdb.New(t, &Note{}, &Revision{}, &Notebook{}, &Tag{}, &Share{}, &PublicLink{})
+	return NewNoteService(NewNoteRepository(db)), db
+}
+
+func createTestNote(t *testing.T, service NoteService, userID uuid.UUID, title string, body string) *Note {
+	note := &Note{UserID: userID, Title: title, Body: body}
+	if err := service.CreateNote(context.Background(), note); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	return note
+}
+
+func TestNoteCRUD(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID, otherID := uuid.New(), uuid.New()
+
+	if err := service.CreateNote(ctx, &Note{UserID: ownerID, Title: strings.Repeat("a", 256)}); err == nil || err.Error() != consts.ErrNoteTitleLengthMoreThan255 {
+		t.Errorf("expected %q, got %v", consts.ErrNoteTitleLengthMoreThan255, err)
+	}
+
+	note := createTestNote(t, service, ownerID, "Title", "Body")
+
+	found, err := service.GetNote(ctx, ownerID, note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found.Title != "Title" || found.Body != "Body" {
+		t.Errorf("expected the created note, got %q, %q", found.Title, found.Body)
+	}
+
+	if err := service.UpdateNote(ctx, ownerID, note.ID, &Note{Title: "New title", Body: "New body"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found, err = service.GetNote(ctx, ownerID, note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found.Title != "New title" || found.Body != "New body" {
+		t.Errorf("expected the updated note, got %q, %q", found.Title, found.Body)
+	}
+
+	// Notes of other users cannot be told apart from notes that do not exist.
+	if _, err := service.GetNote(ctx, otherID, note.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+	if err := service.UpdateNote(ctx, otherID, note.ID, &Note{Title: "Stolen"}); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+	if err := service.DeleteNote(ctx, otherID, note.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+
+	if err := service.DeleteNote(ctx, ownerID, note.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetNote(ctx, ownerID, note.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestGetNotesPagination(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+
+	for _, title := range []string{"First", "Second", "Third"} {
+		createTestNote(t, service, ownerID, title, "")
+	}
+	createTestNote(t, service, uuid.New(), "Other", "")
+
+	notes, total, err := service.GetNotes(ctx, ownerID, &ListOptions{Page: 1, PerPage: 2, Order: "asc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 3 || len(*notes) != 2 || (*notes)[0].Title != "First" {
+		t.Errorf("expected the first 2 of 3 notes, got %d of %d", len(*notes), total)
+	}
+
+	notes, _, err = service.GetNotes(ctx, ownerID, &ListOptions{Page: 2, PerPage: 2, Order: "asc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*notes) != 1 || (*notes)[0].Title != "Third" {
+		t.Errorf("expected the last note, got %v", *notes)
+	}
+}
+
+func getTestRevisions(t *testing.T, service NoteService, userID uuid.UUID, noteID uuid.UUID) []Revision {
+	revisions, _, err := service.GetRevisions(context.Background(), userID, noteID, &ListOptions{Page: 1, PerPage: 10, Order: "asc"})
+	if err != nil {
+		t.Fatalf("failed to get revisions: %v", err)
+	}
+	return *revisions
+}
+
+func TestNoteRevisions(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID, editorID := uuid.New(), uuid.New()
+	note := createTestNote(t, service, ownerID, "Title", "first line\n")
+
+	// Updates that do not change the body do not create a revision.
+	if err := service.UpdateNote(ctx, ownerID, note.ID, &Note{Title: "New title", Body: "first line\n"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.UpdateNoteBody(ctx, ownerID, note.ID, editorID, "first line\nsecond line\n"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revisions := getTestRevisions(t, service, ownerID, note.ID)
+	if len(revisions) != 2 || revisions[0].AuthorID != ownerID || revisions[1].AuthorID != editorID {
+		t.Fatalf("expected a revision by the owner and another by the editor, got %v", revisions)
+	}
+
+	patch, err := service.DiffRevisions(ctx, ownerID, note.ID, revisions[0].ID, revisions[1].ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(patch, "+second line") || strings.Contains(patch, "-first line") {
+		t.Errorf("expected the second line to be added, got %q", patch)
+	}
+
+	// Restoring a revision is recorded as a new one.
+	restored, err := service.RestoreRevision(ctx, ownerID, note.ID, revisions[0].ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.Body != "first line\n" || restored.ID == revisions[0].ID {
+		t.Errorf("expected a new revision with the restored body, got %v", restored)
+	}
+	found, err := service.GetNote(ctx, ownerID, note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found.Body != "first line\n" {
+		t.Errorf("expected the body to be restored, got %q", found.Body)
+	}
+
+	// Revisions of other users' notes cannot be read.
+	if _, err := service.GetRevision(ctx, editorID, note.ID, revisions[0].ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestPruneRevisions(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+	note := createTestNote(t, service, ownerID, "Title", "1")
+	for _, body := range []string{"2", "3"} {
+		if err := service.UpdateNoteBody(ctx, ownerID, note.ID, ownerID, body); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	pruned, err := service.PruneRevisions(ctx, 2, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revisions := getTestRevisions(t, service, ownerID, note.ID)
+	if pruned != 1 || len(revisions) != 2 {
+		t.Fatalf("expected the oldest revision to be pruned, got %d pruned and %d left", pruned, len(revisions))
+	}
+	oldest, err := service.GetRevision(ctx, ownerID, note.ID, revisions[0].ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oldest.Body != "2" {
+		t.Errorf("expected the oldest revision left to be the second one, got %q", oldest.Body)
+	}
+
+	// The latest revision is kept, however old it is.
+	if _, err := service.PruneRevisions(ctx, 0, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revision, err := service.GetRevision(ctx, ownerID, note.ID, getTestRevisions(t, service, ownerID, note.ID)[0].ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revision.Body != "3" {
+		t.Errorf("expected the latest revision to be kept, got %q", revision.Body)
+	}
+}
+
+func createTestNotebook(t *testing.T, service NoteService, userID uuid.UUID, name string, parentID *uuid.UUID) *Notebook {
+	notebook := &Notebook{UserID: userID, Name: name, ParentID: parentID}
+	if err := service.CreateNotebook(context.Background(), notebook); err != nil {
+		t.Fatalf("failed to create notebook: %v", err)
+	}
+	return notebook
+}
+
+func TestNotebooks(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID, otherID := uuid.New(), uuid.New()
+
+	if err := service.CreateNotebook(ctx, &Notebook{UserID: ownerID, Name: " "}); err == nil || err.Error() != consts.ErrInvalidNotebookName {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidNotebookName, err)
+	}
+
+	root := createTestNotebook(t, service, ownerID, "Root", nil)
+	child := createTestNotebook(t, service, ownerID, "Child", &root.ID)
+	grandchild := createTestNotebook(t, service, ownerID, "Grandchild", &child.ID)
+	foreign := createTestNotebook(t, service, otherID, "Foreign", nil)
+
+	// Notebooks and notes cannot be put in the notebooks of other users.
+	if err := service.CreateNotebook(ctx, &Notebook{UserID: ownerID, Name: "Nested", ParentID: &foreign.ID}); err == nil || err.Error() != consts.ErrNotebookNotFound {
+		t.Errorf("expected %q, got %v", consts.ErrNotebookNotFound, err)
+	}
+	if err := service.CreateNote(ctx, &Note{UserID: ownerID, NotebookID: &foreign.ID}); err == nil || err.Error() != consts.ErrNotebookNotFound {
+		t.Errorf("expected %q, got %v", consts.ErrNotebookNotFound, err)
+	}
+
+	// A notebook cannot be moved into itself or one of its descendants.
+	for _, parentID := range []uuid.UUID{root.ID, grandchild.ID} {
+		if err := service.UpdateNotebook(ctx, ownerID, root.ID, "Root", &parentID); err == nil || err.Error() != consts.ErrNotebookCycle {
+			t.Errorf("expected %q, got %v", consts.ErrNotebookCycle, err)
+		}
+	}
+	if err := service.UpdateNotebook(ctx, ownerID, grandchild.ID, "Moved", &root.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	children, err := service.GetChildNotebooks(ctx, ownerID, root.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*children) != 2 {
+		t.Errorf("expected 2 child notebooks, got %d", len(*children))
+	}
+
+	inChild := &Note{UserID: ownerID, Title: "In child", NotebookID: &child.ID}
+	if err := service.CreateNote(ctx, inChild); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	outside := createTestNote(t, service, ownerID, "Outside", "")
+
+	notes, _, err := service.GetNotes(ctx, ownerID, &ListOptions{Page: 1, PerPage: 10, NotebookID: &uuid.Nil})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*notes) != 1 || (*notes)[0].ID != outside.ID {
+		t.Errorf("expected only the note outside of any notebook, got %v", *notes)
+	}
+
+	// Deleting a notebook deletes the notebooks nested in it and their notes.
+	if err := service.DeleteNotebook(ctx, ownerID, root.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notebooks, err := service.GetNotebooks(ctx, ownerID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*notebooks) != 0 {
+		t.Errorf("expected every notebook to be deleted, got %v", *notebooks)
+	}
+	if _, err := service.GetNote(ctx, ownerID, inChild.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+	if _, err := service.GetNote(ctx, ownerID, outside.ID); err != nil {
+		t.Errorf("expected the note outside of the notebook to be kept, got %v", err)
+	}
+}
+
+func TestNoteTags(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+
+	if err := service.CreateNote(ctx, &Note{UserID: ownerID, Tags: []Tag{{Name: " "}}}); err == nil || err.Error() != consts.ErrInvalidTagName {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidTagName, err)
+	}
+
+	work := &Note{UserID: ownerID, Title: "Work", Tags: []Tag{{Name: "Work"}, {Name: " work "}, {Name: "urgent"}}}
+	if err := service.CreateNote(ctx, work); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	home := createTestNote(t, service, ownerID, "Home", "")
+	if err := service.SetNoteTags(ctx, ownerID, home.ID, []string{"urgent"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tags, err := service.GetTags(ctx, ownerID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*tags) != 2 || (*tags)[0].Name != "urgent" || (*tags)[0].NoteCount != 2 || (*tags)[1].Name != "work" || (*tags)[1].NoteCount != 1 {
+		t.Errorf("expected the normalized tags with their note counts, got %v", *tags)
+	}
+
+	// Notes are only listed if they have every given tag.
+	notes, _, err := service.GetNotes(ctx, ownerID, &ListOptions{Page: 1, PerPage: 10, Tags: []string{"URGENT", "work"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*notes) != 1 || (*notes)[0].ID != work.ID {
+		t.Errorf("expected only the work note, got %v", *notes)
+	}
+
+	if err := service.DeleteTag(ctx, ownerID, (*tags)[0].ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found, err := service.GetNote(ctx, ownerID, home.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found.Tags) != 0 {
+		t.Errorf("expected the tag to be removed from the note, got %v", found.Tags)
+	}
+}
+
+func TestPublicLinks(t *testing.T) {
+	service, db := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID, editorID := uuid.New(), uuid.New()
+	note := createTestNote(t, service, ownerID, "Title", "Body")
+
+	past := time.Now().Add(-time.Second)
+	if _, err := service.CreatePublicLink(ctx, ownerID, note.ID, "", &past); err == nil || err.Error() != consts.ErrInvalidPublicLinkExpiration {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidPublicLinkExpiration, err)
+	}
+	// Only owners can publish their notes.
+	if err := db.Create(&Share{UserID: editorID, NoteID: &note.ID, Role: RoleEditor}).Error; err != nil {
+		t.Fatalf("failed to share note: %v", err)
+	}
+	if _, err := service.CreatePublicLink(ctx, editorID, note.ID, "", nil); !isAccessDenied(err) {
+		t.Errorf("expected access to be denied, got %v", err)
+	}
+
+	link, err := service.CreatePublicLink(ctx, ownerID, note.ID, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		public, err := service.GetPublicNote(ctx, link.Slug, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if public.ID != note.ID {
+			t.Errorf("expected note %s, got %s", note.ID, public.ID)
+		}
+	}
+	links, err := service.GetPublicLinks(ctx, ownerID, note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*links) != 1 || (*links)[0].Views != 2 {
+		t.Errorf("expected 2 views of the link, got %v", *links)
+	}
+
+	if err := service.DeletePublicLink(ctx, ownerID, note.ID, link.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetPublicNote(ctx, link.Slug, ""); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestPublicLinkPasswordAndExpiration(t *testing.T) {
+	service, _ := newTestNoteService(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+	note := createTestNote(t, service, ownerID, "Title", "Body")
+
+	expiresAt := time.Now().Add(time.Second)
+	link, err := service.CreatePublicLink(ctx, ownerID, note.ID, "secret", &expiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !link.HasPassword || link.PasswordHash == "secret" {
+		t.Errorf("expected the password to be stored hashed")
+	}
+
+	if _, err := service.GetPublicNote(ctx, link.Slug, ""); err == nil || err.Error() != consts.ErrPublicLinkPasswordRequired {
+		t.Errorf("expected %q, got %v", consts.ErrPublicLinkPasswordRequired, err)
+	}
+	if _, err := service.GetPublicNote(ctx, link.Slug, "wrong"); err == nil || err.Error() != consts.ErrInvalidPublicLinkPassword {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidPublicLinkPassword, err)
+	}
+	if _, err := service.GetPublicNote(ctx, link.Slug, "secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Expired links cannot be told apart from links that do not exist.
+	time.Sleep(time.Until(expiresAt))
+	if _, err := service.GetPublicNote(ctx, link.Slug, "secret"); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package note
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Gets a page of the revisions of a note the current user can view, newest first by default.
+func (h *NoteHandler) getRevisions(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, noteID, err := h.getNoteIDs(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	opts := &ListOptions{
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", 20),
+		Order:   c.Query("order", "desc"),
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+		opts.PerPage = maxPerPage
+	}
+	if opts.Order != "asc" && opts.Order != "desc" {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "order must be either 'asc' or 'desc'")
+	}
+
+	revisions, total, err := h.noteService.GetRevisions(customContext, userID, noteID, opts)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":   true,
+		"revisions": revisions,
+		"page":      opts.Page,
+		"per_page":  opts.PerPage,
+		"total":     total,
+	})
+}
+
+// Gets a single revision of a note the current user can view, including its body.
+func (h *NoteHandler) getRevision(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, noteID, err := h.getNoteIDs(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := uuid.Parse(c.Params("revisionID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	revision, err := h.noteService.GetRevision(customContext, userID, noteID, revisionID)
+	if err != nil {
+		return h.mapRevisionError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"revision": revision,
+	})
+}
+
+// Gets the differences between the 'from' and 'to' revisions of a note in the unified diff format.
+func (h *NoteHandler) diffRevisions(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, noteID, err := h.getNoteIDs(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	fromID, err := uuid.Parse(c.Query("from"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "from must be a valid revision ID")
+	}
+	toID, err := uuid.Parse(c.Query("to"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "to must be a valid revision ID")
+	}
+
+	diff, err := h.noteService.DiffRevisions(customContext, userID, noteID, fromID, toID)
+	if err != nil {
+		return h.mapRevisionError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"from":    fromID,
+		"to":      toID,
+		"diff":    diff,
+	})
+}
+
+// Restores the body of a note the current user can edit to the one of a past revision, which
+// creates a new revision.
+func (h *NoteHandler) restoreRevision(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, noteID, err := h.getNoteIDs(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := uuid.Parse(c.Params("revisionID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	// Editors of the note with the body open get the restored body as an operation.
+	var revision *Revision
+	err = h.collabHub.UpdateBody(noteID, h.getUsername(c), func() (string, error) {
+		revision, err = h.noteService.RestoreRevision(customContext, userID, noteID, revisionID)
+		if err != nil {
+			return "", err
+		}
+		return revision.Body, nil
+	})
+	if err != nil {
+		return h.mapRevisionError(c, err)
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"message":  h.i18n.T(h.getLangCode(c), "messages.revision_restored"),
+		"note":     note,
+		"revision": revision,
+	})
+}
+
+// getNoteIDs returns the IDs of the current user and of the note in the path, checking that the
+// user can view the note so that missing revisions can be told apart from missing notes.
+func (h *NoteHandler) getNoteIDs(ctx context.Context, c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	if _, err := h.noteService.GetNote(ctx, userID, noteID); err != nil {
+		return uuid.Nil, uuid.Nil, h.mapNoteError(c, err)
+	}
+
+	return userID, noteID, nil
+}
+
+// mapRevisionError maps the errors returned by the revision methods of the note service to API errors.
+func (h *NoteHandler) mapRevisionError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeRevisionNotFound, h.i18n.T(h.getLangCode(c), "errors.revision_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
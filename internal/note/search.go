@@ -0,0 +1,67 @@
+package note
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+)
+
+// Creates a new handler to search the notes of the current user.
+func NewSearchHandler(searchRoute fiber.Router, ns NoteService, us user.UserService, denylist auth.TokenDenylist, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		userService: us,
+		i18n:        i18n,
+	}
+
+	searchRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	searchRoute.Get("", handler.searchNotes)
+}
+
+// Searches the titles and bodies of the notes owned by the current user for the 'q' query parameter,
+// returning a page of the matching notes sorted by relevance.
+func (h *NoteHandler) searchNotes(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, "q is required")
+	}
+
+	opts := &ListOptions{
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", 20),
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+		opts.PerPage = maxPerPage
+	}
+
+	results, total, err := h.noteService.SearchNotes(customContext, userID, query, opts)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success":  true,
+		"results":  results,
+		"page":     opts.Page,
+		"per_page": opts.PerPage,
+		"total":    total,
+	})
+}
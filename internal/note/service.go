@@ -0,0 +1,801 @@
+package note
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"github.com/jramsgz/articpad/pkg/diff"
+	"github.com/jramsgz/articpad/pkg/securetoken"
+	"github.com/jramsgz/articpad/pkg/validator"
+	"gorm.io/gorm"
+)
+
+const (
+	// Maximum number of terms of a search, the rest are ignored.
+	maxSearchTerms = 16
+	// Maximum number of tags of a note.
+	maxTagsPerNote = 20
+	// Maximum length of the name of a tag.
+	maxTagNameLength = 50
+	// Number of random bytes of the slugs of public links, 128 bits.
+	publicLinkSlugLength = 16
+	// Maximum length of the passwords of public links, which bounds the time taken to hash them.
+	maxPublicLinkPasswordLength = 128
+)
+
+// Implementation of the repository in this service.
+type noteService struct {
+	noteRepository NoteRepository
+}
+
+// Create a new 'service' or 'use-case' for 'Note' entity.
+func NewNoteService(r NoteRepository) NoteService {
+	return &noteService{
+		noteRepository: r,
+	}
+}
+
+// Implementation of 'GetNotes'. The notes of a notebook shared with the user are listed if it is given.
+func (s *noteService) GetNotes(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*[]Note, int64, error) {
+	if len(opts.Tags) > 0 {
+		tags, err := normalizeTags(opts.Tags)
+		if err != nil {
+			return nil, 0, err
+		}
+		opts.Tags = tags
+	}
+
+	if opts.NotebookID != nil && *opts.NotebookID != uuid.Nil {
+		notebook, err := s.AuthorizeNotebook(ctx, userID, *opts.NotebookID, RoleViewer)
+		if err != nil {
+			return nil, 0, err
+		}
+		userID = notebook.UserID
+	}
+
+	return s.noteRepository.GetNotes(ctx, userID, opts)
+}
+
+// Implementation of 'GetAllNotes'.
+func (s *noteService) GetAllNotes(ctx context.Context, userID uuid.UUID) (*[]Note, error) {
+	return s.noteRepository.GetAllNotes(ctx, userID)
+}
+
+// Implementation of 'GetNote'.
+func (s *noteService) GetNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*Note, error) {
+	return s.AuthorizeNote(ctx, userID, noteID, RoleViewer)
+}
+
+// Implementation of 'CreateNote'. The tags of the note are looked up by name and created if needed.
+func (s *noteService) CreateNote(ctx context.Context, note *Note) error {
+	err := s.validateNote(note)
+	if err != nil {
+		return err
+	}
+
+	tagNames := make([]string, len(note.Tags))
+	for i, tag := range note.Tags {
+		tagNames[i] = tag.Name
+	}
+	tags, err := normalizeTags(tagNames)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkNotebook(ctx, note.UserID, note.NotebookID)
+	if err != nil {
+		return err
+	}
+
+	note.Tags = nil
+	err = s.noteRepository.CreateNote(ctx, note)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		err = s.noteRepository.SetNoteTags(ctx, note.UserID, note.ID, tags)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.saveRevision(ctx, note.ID, note.UserID, note.Body, false)
+	return err
+}
+
+// Implementation of 'UpdateNote'.
+func (s *noteService) UpdateNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, note *Note) error {
+	err := s.validateNote(note)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.AuthorizeNote(ctx, userID, noteID, RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	err = s.noteRepository.UpdateNote(ctx, current.UserID, noteID, note)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.saveRevision(ctx, noteID, userID, note.Body, false)
+	return err
+}
+
+// Implementation of 'UpdateNoteBody'. The user must be the owner of the note, as the access of the
+// author is checked when they join the collaborative editing session.
+func (s *noteService) UpdateNoteBody(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, authorID uuid.UUID, body string) error {
+	err := s.noteRepository.UpdateNoteBody(ctx, userID, noteID, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.saveRevision(ctx, noteID, authorID, body, false)
+	return err
+}
+
+// Implementation of 'DeleteNote'.
+func (s *noteService) DeleteNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) error {
+	note, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	return s.noteRepository.DeleteNote(ctx, note.UserID, noteID)
+}
+
+// Implementation of 'GetRevisions'.
+func (s *noteService) GetRevisions(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, opts *ListOptions) (*[]Revision, int64, error) {
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleViewer); err != nil {
+		return nil, 0, err
+	}
+
+	return s.noteRepository.GetRevisions(ctx, noteID, opts)
+}
+
+// Implementation of 'GetAllRevisions'.
+func (s *noteService) GetAllRevisions(ctx context.Context, userID uuid.UUID) (*[]Revision, error) {
+	return s.noteRepository.GetAllRevisions(ctx, userID)
+}
+
+// Implementation of 'GetRevision'.
+func (s *noteService) GetRevision(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error) {
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleViewer); err != nil {
+		return nil, err
+	}
+
+	return s.noteRepository.GetRevision(ctx, noteID, revisionID)
+}
+
+// Implementation of 'DiffRevisions'.
+func (s *noteService) DiffRevisions(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, fromID uuid.UUID, toID uuid.UUID) (string, error) {
+	from, err := s.GetRevision(ctx, userID, noteID, fromID)
+	if err != nil {
+		return "", err
+	}
+
+	to, err := s.noteRepository.GetRevision(ctx, noteID, toID)
+	if err != nil {
+		return "", err
+	}
+
+	return diff.Unified(revisionName(from), revisionName(to), from.Body, to.Body), nil
+}
+
+// Implementation of 'RestoreRevision'.
+func (s *noteService) RestoreRevision(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, revisionID uuid.UUID) (*Revision, error) {
+	note, err := s.AuthorizeNote(ctx, userID, noteID, RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.noteRepository.GetRevision(ctx, noteID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.noteRepository.UpdateNoteBody(ctx, note.UserID, noteID, revision.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The restore is recorded even if the body did not change, so it shows up in the history.
+	return s.saveRevision(ctx, noteID, userID, revision.Body, true)
+}
+
+// Implementation of 'PruneRevisions'.
+func (s *noteService) PruneRevisions(ctx context.Context, maxPerNote int, createdBefore time.Time) (int64, error) {
+	return s.noteRepository.PruneRevisions(ctx, maxPerNote, createdBefore)
+}
+
+// Implementation of 'SearchNotes'.
+func (s *noteService) SearchNotes(ctx context.Context, userID uuid.UUID, query string, opts *ListOptions) (*[]SearchResult, int64, error) {
+	// Only letters and numbers are searched, which keeps the query syntax of the databases out of reach.
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) == 0 {
+		return &[]SearchResult{}, 0, nil
+	}
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	results, total, err := s.noteRepository.SearchNotes(ctx, userID, terms, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range *results {
+		result := &(*results)[i]
+		result.TitleHighlight = highlightToHTML(result.TitleHighlight)
+		result.Snippet = highlightToHTML(result.Snippet)
+	}
+
+	return results, total, nil
+}
+
+// highlightToHTML escapes text highlighted by the database and replaces its markers with <mark> elements.
+func highlightToHTML(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	return strings.ReplaceAll(text, highlightStop, "</mark>")
+}
+
+// Implementation of 'SetNoteNotebook'. The notebook must belong to the owner of the note.
+func (s *noteService) SetNoteNotebook(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, notebookID *uuid.UUID) error {
+	note, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkNotebook(ctx, note.UserID, notebookID)
+	if err != nil {
+		return err
+	}
+
+	return s.noteRepository.SetNoteNotebook(ctx, note.UserID, noteID, notebookID)
+}
+
+// Implementation of 'SetNoteTags'. Tags belong to the owner of the note, whoever sets them.
+func (s *noteService) SetNoteTags(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, tags []string) error {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	note, err := s.AuthorizeNote(ctx, userID, noteID, RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	return s.noteRepository.SetNoteTags(ctx, note.UserID, noteID, tags)
+}
+
+// Implementation of 'GetNotebooks'.
+func (s *noteService) GetNotebooks(ctx context.Context, userID uuid.UUID) (*[]Notebook, error) {
+	return s.noteRepository.GetNotebooks(ctx, userID)
+}
+
+// Implementation of 'GetNotebook'.
+func (s *noteService) GetNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*Notebook, error) {
+	return s.AuthorizeNotebook(ctx, userID, notebookID, RoleViewer)
+}
+
+// Implementation of 'GetChildNotebooks'.
+func (s *noteService) GetChildNotebooks(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*[]Notebook, error) {
+	notebook, err := s.AuthorizeNotebook(ctx, userID, notebookID, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	notebooks, err := s.noteRepository.GetChildNotebooks(ctx, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	// Access to a notebook extends to the notebooks in it.
+	for i := range *notebooks {
+		(*notebooks)[i].Role = notebook.Role
+	}
+
+	return notebooks, nil
+}
+
+// Implementation of 'CreateNotebook'.
+func (s *noteService) CreateNotebook(ctx context.Context, notebook *Notebook) error {
+	notebook.Name = strings.TrimSpace(notebook.Name)
+	err := validateNotebookName(notebook.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkNotebook(ctx, notebook.UserID, notebook.ParentID)
+	if err != nil {
+		return err
+	}
+
+	return s.noteRepository.CreateNotebook(ctx, notebook)
+}
+
+// Implementation of 'UpdateNotebook'.
+func (s *noteService) UpdateNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, name string, parentID *uuid.UUID) error {
+	name = strings.TrimSpace(name)
+	err := validateNotebookName(name)
+	if err != nil {
+		return err
+	}
+
+	notebook, err := s.AuthorizeNotebook(ctx, userID, notebookID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	userID = notebook.UserID
+
+	if parentID != nil {
+		notebooks, err := s.noteRepository.GetNotebooks(ctx, userID)
+		if err != nil {
+			return err
+		}
+		parents := make(map[uuid.UUID]*uuid.UUID, len(*notebooks))
+		for _, notebook := range *notebooks {
+			parents[notebook.ID] = notebook.ParentID
+		}
+
+		if _, ok := parents[*parentID]; !ok {
+			return errors.New(consts.ErrNotebookNotFound)
+		}
+		// Walk up from the new parent, the notebook must not be found on the way.
+		for id := parentID; id != nil; id = parents[*id] {
+			if *id == notebookID {
+				return errors.New(consts.ErrNotebookCycle)
+			}
+		}
+	}
+
+	return s.noteRepository.UpdateNotebook(ctx, userID, notebookID, name, parentID)
+}
+
+// Implementation of 'DeleteNotebook'. The notebooks nested in it and the notes of all of them are deleted too.
+func (s *noteService) DeleteNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) error {
+	notebook, err := s.AuthorizeNotebook(ctx, userID, notebookID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	userID = notebook.UserID
+
+	notebooks, err := s.noteRepository.GetNotebooks(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	children := map[uuid.UUID][]uuid.UUID{}
+	found := false
+	for _, notebook := range *notebooks {
+		if notebook.ParentID != nil {
+			children[*notebook.ParentID] = append(children[*notebook.ParentID], notebook.ID)
+		}
+		found = found || notebook.ID == notebookID
+	}
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+
+	ids := []uuid.UUID{notebookID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return s.noteRepository.DeleteNotebooks(ctx, userID, ids)
+}
+
+// Implementation of 'GetTags'.
+func (s *noteService) GetTags(ctx context.Context, userID uuid.UUID) (*[]TagCount, error) {
+	return s.noteRepository.GetTags(ctx, userID)
+}
+
+// Implementation of 'DeleteTag'.
+func (s *noteService) DeleteTag(ctx context.Context, userID uuid.UUID, tagID uuid.UUID) error {
+	return s.noteRepository.DeleteTag(ctx, userID, tagID)
+}
+
+// Implementation of 'AuthorizeNote'. The owner of a note has every role on it, other users have the
+// highest role given to them on the note or on any of the notebooks it is in. It returns the note with
+// the role of the user, gorm.ErrRecordNotFound if the user has no access to the note and
+// consts.ErrNoteAccessDenied if their role does not include the required one.
+func (s *noteService) AuthorizeNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, role Role) (*Note, error) {
+	note, err := s.noteRepository.GetNoteByID(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Role, err = s.getRole(ctx, userID, note.UserID, &note.ID, note.NotebookID)
+	if err != nil {
+		return nil, err
+	}
+	if !note.Role.Includes(role) {
+		return nil, errors.New(consts.ErrNoteAccessDenied)
+	}
+
+	return note, nil
+}
+
+// Implementation of 'AuthorizeNotebook'. It works like 'AuthorizeNote' for notebooks.
+func (s *noteService) AuthorizeNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, role Role) (*Notebook, error) {
+	notebook, err := s.noteRepository.GetNotebookByID(ctx, notebookID)
+	if err != nil {
+		return nil, err
+	}
+
+	notebook.Role, err = s.getRole(ctx, userID, notebook.UserID, nil, &notebook.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !notebook.Role.Includes(role) {
+		return nil, errors.New(consts.ErrNoteAccessDenied)
+	}
+
+	return notebook, nil
+}
+
+// getRole returns the role of a user on a note and the notebook it is in, or on a notebook if noteID
+// is nil. It returns gorm.ErrRecordNotFound if the user has no role on them.
+func (s *noteService) getRole(ctx context.Context, userID uuid.UUID, ownerID uuid.UUID, noteID *uuid.UUID, notebookID *uuid.UUID) (Role, error) {
+	if userID == ownerID {
+		return RoleOwner, nil
+	}
+
+	// Shares of a notebook apply to the notebooks nested in it, so all its ancestors are checked.
+	var notebookIDs []uuid.UUID
+	if notebookID != nil {
+		notebooks, err := s.noteRepository.GetNotebooks(ctx, ownerID)
+		if err != nil {
+			return "", err
+		}
+		parents := make(map[uuid.UUID]*uuid.UUID, len(*notebooks))
+		for _, notebook := range *notebooks {
+			parents[notebook.ID] = notebook.ParentID
+		}
+		// The length check stops the walk if the notebooks ever form a cycle.
+		for id := notebookID; id != nil && len(notebookIDs) <= len(parents); id = parents[*id] {
+			notebookIDs = append(notebookIDs, *id)
+		}
+	}
+
+	shares, err := s.noteRepository.GetUserShares(ctx, userID, noteID, notebookIDs)
+	if err != nil {
+		return "", err
+	}
+
+	var role Role
+	for _, share := range *shares {
+		if roleLevels[share.Role] > roleLevels[role] {
+			role = share.Role
+		}
+	}
+	if !role.Valid() {
+		return "", gorm.ErrRecordNotFound
+	}
+
+	return role, nil
+}
+
+// Implementation of 'GetNoteShares'.
+func (s *noteService) GetNoteShares(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*[]Share, error) {
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner); err != nil {
+		return nil, err
+	}
+
+	return s.noteRepository.GetNoteShares(ctx, noteID)
+}
+
+// Implementation of 'GetNotebookShares'.
+func (s *noteService) GetNotebookShares(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID) (*[]Share, error) {
+	if _, err := s.AuthorizeNotebook(ctx, userID, notebookID, RoleOwner); err != nil {
+		return nil, err
+	}
+
+	return s.noteRepository.GetNotebookShares(ctx, notebookID)
+}
+
+// Implementation of 'GetReceivedShares'.
+func (s *noteService) GetReceivedShares(ctx context.Context, userID uuid.UUID) (*[]Share, error) {
+	return s.noteRepository.GetReceivedShares(ctx, userID)
+}
+
+// Implementation of 'GetGivenShares'.
+func (s *noteService) GetGivenShares(ctx context.Context, userID uuid.UUID) (*[]Share, error) {
+	return s.noteRepository.GetGivenShares(ctx, userID)
+}
+
+// Implementation of 'ShareNote'.
+func (s *noteService) ShareNote(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, granteeID uuid.UUID, role Role) (*Share, error) {
+	note, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createShare(ctx, &Share{NoteID: &note.ID, UserID: granteeID, Role: role, CreatedBy: userID}, note.UserID)
+}
+
+// Implementation of 'ShareNotebook'.
+func (s *noteService) ShareNotebook(ctx context.Context, userID uuid.UUID, notebookID uuid.UUID, granteeID uuid.UUID, role Role) (*Share, error) {
+	notebook, err := s.AuthorizeNotebook(ctx, userID, notebookID, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createShare(ctx, &Share{NotebookID: &notebook.ID, UserID: granteeID, Role: role, CreatedBy: userID}, notebook.UserID)
+}
+
+// createShare creates a share after checking that its role is valid, that it is not for the owner of
+// the note or notebook and that the user does not have a share for it yet.
+func (s *noteService) createShare(ctx context.Context, share *Share, ownerID uuid.UUID) (*Share, error) {
+	if !share.Role.Valid() {
+		return nil, errors.New(consts.ErrInvalidShareRole)
+	}
+	if share.UserID == ownerID {
+		return nil, errors.New(consts.ErrCannotShareWithOwner)
+	}
+
+	var notebookIDs []uuid.UUID
+	if share.NotebookID != nil {
+		notebookIDs = []uuid.UUID{*share.NotebookID}
+	}
+	existing, err := s.noteRepository.GetUserShares(ctx, share.UserID, share.NoteID, notebookIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(*existing) > 0 {
+		return nil, errors.New(consts.ErrAlreadyShared)
+	}
+
+	if err := s.noteRepository.CreateShare(ctx, share); err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// Implementation of 'UpdateShare'.
+func (s *noteService) UpdateShare(ctx context.Context, userID uuid.UUID, shareID uuid.UUID, role Role) (*Share, error) {
+	if !role.Valid() {
+		return nil, errors.New(consts.ErrInvalidShareRole)
+	}
+
+	if _, err := s.authorizeShare(ctx, userID, shareID); err != nil {
+		return nil, err
+	}
+
+	if err := s.noteRepository.UpdateShareRole(ctx, shareID, role); err != nil {
+		return nil, err
+	}
+
+	return s.noteRepository.GetShare(ctx, shareID)
+}
+
+// Implementation of 'DeleteShare'. Users can also remove the shares they received.
+func (s *noteService) DeleteShare(ctx context.Context, userID uuid.UUID, shareID uuid.UUID) error {
+	share, err := s.noteRepository.GetShare(ctx, shareID)
+	if err != nil {
+		return err
+	}
+
+	if share.UserID != userID {
+		if _, err := s.authorizeShare(ctx, userID, shareID); err != nil {
+			return err
+		}
+	}
+
+	return s.noteRepository.DeleteShare(ctx, shareID)
+}
+
+// authorizeShare returns a share if the user is an owner of its note or notebook. Shares of notes and
+// notebooks the user has no access to are reported as not found.
+func (s *noteService) authorizeShare(ctx context.Context, userID uuid.UUID, shareID uuid.UUID) (*Share, error) {
+	share, err := s.noteRepository.GetShare(ctx, shareID)
+	if err != nil {
+		return nil, err
+	}
+
+	if share.NoteID != nil {
+		_, err = s.AuthorizeNote(ctx, userID, *share.NoteID, RoleOwner)
+	} else {
+		_, err = s.AuthorizeNotebook(ctx, userID, *share.NotebookID, RoleOwner)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// Implementation of 'GetPublicLinks'.
+func (s *noteService) GetPublicLinks(ctx context.Context, userID uuid.UUID, noteID uuid.UUID) (*[]PublicLink, error) {
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner); err != nil {
+		return nil, err
+	}
+
+	return s.noteRepository.GetPublicLinks(ctx, noteID)
+}
+
+// Implementation of 'GetAllPublicLinks'.
+func (s *noteService) GetAllPublicLinks(ctx context.Context, userID uuid.UUID) (*[]PublicLink, error) {
+	return s.noteRepository.GetAllPublicLinks(ctx, userID)
+}
+
+// Implementation of 'CreatePublicLink'. The link has no password if it is empty and does not expire
+// if expiresAt is nil.
+func (s *noteService) CreatePublicLink(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, password string, expiresAt *time.Time) (*PublicLink, error) {
+	if utf8.RuneCountInString(password) > maxPublicLinkPasswordLength {
+		return nil, errors.New(consts.ErrPublicLinkPasswordTooLong)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, errors.New(consts.ErrInvalidPublicLinkExpiration)
+	}
+
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner); err != nil {
+		return nil, err
+	}
+
+	slug, err := securetoken.Generate(publicLinkSlugLength)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &PublicLink{
+		NoteID:    noteID,
+		Slug:      slug,
+		ExpiresAt: expiresAt,
+		CreatedBy: userID,
+	}
+	if password != "" {
+		link.PasswordHash, err = argon2id.CreateHash(password, argon2id.DefaultParams)
+		if err != nil {
+			return nil, err
+		}
+		link.HasPassword = true
+	}
+
+	if err := s.noteRepository.CreatePublicLink(ctx, link); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// Implementation of 'DeletePublicLink'.
+func (s *noteService) DeletePublicLink(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, linkID uuid.UUID) error {
+	if _, err := s.AuthorizeNote(ctx, userID, noteID, RoleOwner); err != nil {
+		return err
+	}
+
+	return s.noteRepository.DeletePublicLink(ctx, noteID, linkID)
+}
+
+// Implementation of 'GetPublicNote'. It returns gorm.ErrRecordNotFound if the link does not exist or has
+// expired, or if its note has been deleted. Every successful call counts as a view of the link.
+func (s *noteService) GetPublicNote(ctx context.Context, slug string, password string) (*Note, error) {
+	link, err := s.noteRepository.GetPublicLinkBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if link.HasPassword {
+		if password == "" {
+			return nil, errors.New(consts.ErrPublicLinkPasswordRequired)
+		}
+		if utf8.RuneCountInString(password) > maxPublicLinkPasswordLength {
+			return nil, errors.New(consts.ErrInvalidPublicLinkPassword)
+		}
+		match, err := argon2id.ComparePasswordAndHash(password, link.PasswordHash)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			return nil, errors.New(consts.ErrInvalidPublicLinkPassword)
+		}
+	}
+
+	note, err := s.noteRepository.GetNoteByID(ctx, link.NoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.noteRepository.IncrementPublicLinkViews(ctx, link.ID); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// checkNotebook returns an error if the notebook is set and the user does not own it.
+func (s *noteService) checkNotebook(ctx context.Context, userID uuid.UUID, notebookID *uuid.UUID) error {
+	if notebookID == nil {
+		return nil
+	}
+
+	_, err := s.noteRepository.GetNotebook(ctx, userID, *notebookID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New(consts.ErrNotebookNotFound)
+	}
+	return err
+}
+
+// normalizeTags trims and lowercases the names of tags, removing duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagNameLength {
+			return nil, errors.New(consts.ErrInvalidTagName)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTagsPerNote {
+		return nil, errors.New(consts.ErrTooManyTags)
+	}
+	return normalized, nil
+}
+
+// validateNotebookName returns an error if the name of a notebook is empty or too long.
+func validateNotebookName(name string) error {
+	nameValidator := validator.New(
+		validator.MinLength(1, errors.New(consts.ErrInvalidNotebookName)),
+		validator.MaxLength(255, errors.New(consts.ErrInvalidNotebookName)),
+	)
+	return nameValidator.Validate(name)
+}
+
+// saveRevision creates a revision with the given body, unless it is the same as the body of the
+// latest revision of the note and force is false. It returns the latest revision of the note.
+func (s *noteService) saveRevision(ctx context.Context, noteID uuid.UUID, authorID uuid.UUID, body string, force bool) (*Revision, error) {
+	revision := NewRevision(noteID, authorID, body)
+
+	if !force {
+		latest, err := s.noteRepository.GetLatestRevision(ctx, noteID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if latest != nil && latest.ContentHash == revision.ContentHash {
+			return latest, nil
+		}
+	}
+
+	if err := s.noteRepository.CreateRevision(ctx, revision); err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// revisionName returns the name of a revision used in the headers of a diff.
+func revisionName(revision *Revision) string {
+	return fmt.Sprintf("%s\t%s", revision.ID, revision.CreatedAt.UTC().Format(time.RFC3339))
+}
+
+// Validates the note data and returns an error if it is not valid.
+func (s *noteService) validateNote(note *Note) error {
+	titleValidator := validator.New(
+		validator.MaxLength(255, errors.New(consts.ErrNoteTitleLengthMoreThan255)),
+	)
+	return titleValidator.Validate(note.Title)
+}
@@ -0,0 +1,258 @@
+package note
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"gorm.io/gorm"
+)
+
+// fakeNoteRepository keeps notes, notebooks and shares in memory. Methods not needed to authorize
+// users are left to the embedded interface, calling them panics.
+type fakeNoteRepository struct {
+	NoteRepository
+	notes     map[uuid.UUID]Note
+	notebooks map[uuid.UUID]Notebook
+	shares    map[uuid.UUID]Share
+}
+
+func newFakeNoteRepository() *fakeNoteRepository {
+	return &fakeNoteRepository{
+		notes:     map[uuid.UUID]Note{},
+		notebooks: map[uuid.UUID]Notebook{},
+		shares:    map[uuid.UUID]Share{},
+	}
+}
+
+func (r *fakeNoteRepository) addNote(ownerID uuid.UUID, notebookID *uuid.UUID) uuid.UUID {
+	note := Note{ID: uuid.New(), UserID: ownerID, NotebookID: notebookID}
+	r.notes[note.ID] = note
+	return note.ID
+}
+
+func (r *fakeNoteRepository) addNotebook(ownerID uuid.UUID, parentID *uuid.UUID) uuid.UUID {
+	notebook := Notebook{ID: uuid.New(), UserID: ownerID, ParentID: parentID}
+	r.notebooks[notebook.ID] = notebook
+	return notebook.ID
+}
+
+func (r *fakeNoteRepository) addShare(userID uuid.UUID, noteID *uuid.UUID, notebookID *uuid.UUID, role Role) uuid.UUID {
+	share := Share{ID: uuid.New(), UserID: userID, NoteID: noteID, NotebookID: notebookID, Role: role}
+	r.shares[share.ID] = share
+	return share.ID
+}
+
+func (r *fakeNoteRepository) GetNoteByID(ctx context.Context, noteID uuid.UUID) (*Note, error) {
+	note, ok := r.notes[noteID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &note, nil
+}
+
+func (r *fakeNoteRepository) GetNotebookByID(ctx context.Context, notebookID uuid.UUID) (*Notebook, error) {
+	notebook, ok := r.notebooks[notebookID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &notebook, nil
+}
+
+func (r *fakeNoteRepository) GetNotebooks(ctx context.Context, userID uuid.UUID) (*[]Notebook, error) {
+	notebooks := []Notebook{}
+	for _, notebook := range r.notebooks {
+		if notebook.UserID == userID {
+			notebooks = append(notebooks, notebook)
+		}
+	}
+	return &notebooks, nil
+}
+
+func (r *fakeNoteRepository) GetUserShares(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID, notebookIDs []uuid.UUID) (*[]Share, error) {
+	shares := []Share{}
+	for _, share := range r.shares {
+		if share.UserID != userID {
+			continue
+		}
+		if noteID != nil && share.NoteID != nil && *share.NoteID == *noteID {
+			shares = append(shares, share)
+		}
+		for _, id := range notebookIDs {
+			if share.NotebookID != nil && *share.NotebookID == id {
+				shares = append(shares, share)
+			}
+		}
+	}
+	return &shares, nil
+}
+
+func (r *fakeNoteRepository) GetShare(ctx context.Context, shareID uuid.UUID) (*Share, error) {
+	share, ok := r.shares[shareID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &share, nil
+}
+
+func (r *fakeNoteRepository) DeleteShare(ctx context.Context, shareID uuid.UUID) error {
+	if _, ok := r.shares[shareID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.shares, shareID)
+	return nil
+}
+
+func isAccessDenied(err error) bool {
+	return err != nil && err.Error() == consts.ErrNoteAccessDenied
+}
+
+func TestRoleIncludes(t *testing.T) {
+	roles := []Role{RoleViewer, RoleCommenter, RoleEditor, RoleOwner}
+	for i, role := range roles {
+		for j, other := range roles {
+			if includes := role.Includes(other); includes != (i >= j) {
+				t.Errorf("%s.Includes(%s) = %t", role, other, includes)
+			}
+		}
+		if role.Includes("") || role.Includes("admin") {
+			t.Errorf("%s includes an invalid role", role)
+		}
+	}
+}
+
+func TestAuthorizeNoteOwner(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID := uuid.New()
+	noteID := repo.addNote(ownerID, nil)
+
+	note, err := service.AuthorizeNote(context.Background(), ownerID, noteID, RoleOwner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note.Role != RoleOwner {
+		t.Errorf("expected role %s, got %s", RoleOwner, note.Role)
+	}
+}
+
+func TestAuthorizeNoteDirectShare(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID, userID := uuid.New(), uuid.New()
+	noteID := repo.addNote(ownerID, nil)
+	repo.addShare(userID, &noteID, nil, RoleEditor)
+
+	note, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleEditor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note.Role != RoleEditor {
+		t.Errorf("expected role %s, got %s", RoleEditor, note.Role)
+	}
+
+	if _, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleOwner); !isAccessDenied(err) {
+		t.Errorf("expected access to be denied, got %v", err)
+	}
+}
+
+func TestAuthorizeNoteInheritedShare(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID, userID := uuid.New(), uuid.New()
+	rootID := repo.addNotebook(ownerID, nil)
+	childID := repo.addNotebook(ownerID, &rootID)
+	noteID := repo.addNote(ownerID, &childID)
+	repo.addShare(userID, nil, &rootID, RoleCommenter)
+
+	note, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleViewer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note.Role != RoleCommenter {
+		t.Errorf("expected role %s, got %s", RoleCommenter, note.Role)
+	}
+
+	notebook, err := service.AuthorizeNotebook(context.Background(), userID, childID, RoleViewer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if notebook.Role != RoleCommenter {
+		t.Errorf("expected role %s, got %s", RoleCommenter, notebook.Role)
+	}
+
+	// Shares of a nested notebook do not apply to its parent.
+	otherID := uuid.New()
+	repo.addShare(otherID, nil, &childID, RoleEditor)
+	if _, err := service.AuthorizeNotebook(context.Background(), otherID, rootID, RoleViewer); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestAuthorizeNoteHighestRole(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID, userID := uuid.New(), uuid.New()
+	notebookID := repo.addNotebook(ownerID, nil)
+	noteID := repo.addNote(ownerID, &notebookID)
+	repo.addShare(userID, &noteID, nil, RoleViewer)
+	repo.addShare(userID, nil, &notebookID, RoleEditor)
+
+	note, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleEditor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note.Role != RoleEditor {
+		t.Errorf("expected role %s, got %s", RoleEditor, note.Role)
+	}
+}
+
+func TestAuthorizeNoteNotFoundAndDenied(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID, userID := uuid.New(), uuid.New()
+	noteID := repo.addNote(ownerID, nil)
+
+	// Users without access to a note cannot tell it apart from a note that does not exist.
+	if _, err := service.AuthorizeNote(context.Background(), ownerID, uuid.New(), RoleViewer); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound for a missing note, got %v", err)
+	}
+	if _, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleViewer); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound without a share, got %v", err)
+	}
+
+	repo.addShare(userID, &noteID, nil, RoleViewer)
+	if _, err := service.AuthorizeNote(context.Background(), userID, noteID, RoleEditor); !isAccessDenied(err) {
+		t.Errorf("expected access to be denied, got %v", err)
+	}
+}
+
+func TestDeleteShare(t *testing.T) {
+	repo := newFakeNoteRepository()
+	service := NewNoteService(repo)
+	ownerID, granteeID, editorID := uuid.New(), uuid.New(), uuid.New()
+	noteID := repo.addNote(ownerID, nil)
+	shareID := repo.addShare(granteeID, &noteID, nil, RoleViewer)
+	editorShareID := repo.addShare(editorID, &noteID, nil, RoleEditor)
+
+	// Only owners can remove the shares of others.
+	if err := service.DeleteShare(context.Background(), editorID, shareID); !isAccessDenied(err) {
+		t.Errorf("expected access to be denied, got %v", err)
+	}
+	if err := service.DeleteShare(context.Background(), ownerID, editorShareID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Users can remove the shares they received.
+	if err := service.DeleteShare(context.Background(), granteeID, shareID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := repo.shares[shareID]; ok {
+		t.Error("expected the share to be deleted")
+	}
+
+	if err := service.DeleteShare(context.Background(), granteeID, shareID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
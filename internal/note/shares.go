@@ -0,0 +1,290 @@
+package note
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/templates"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	"gorm.io/gorm"
+)
+
+// Creates a new handler for the shares received by the current user and for changing or removing shares.
+// Shares are created and listed from the notes and notebooks they are for.
+func NewShareHandler(shareRoute fiber.Router, ns NoteService, us user.UserService, denylist auth.TokenDenylist, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		userService: us,
+		i18n:        i18n,
+	}
+
+	shareRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	shareRoute.Get("", handler.getReceivedShares)
+	shareRoute.Put("/:shareID", handler.updateShare)
+	shareRoute.Delete("/:shareID", handler.deleteShare)
+}
+
+// Gets the users a note is shared with. Only owners of the note can see them.
+func (h *NoteHandler) getNoteShares(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	shares, err := h.noteService.GetNoteShares(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"shares":  shares,
+	})
+}
+
+// Shares a note with the user with the given username or email address and sends them an invitation.
+func (h *NoteHandler) shareNote(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	noteID, err := uuid.Parse(c.Params("noteID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	grantee, role, err := h.parseShareRequest(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	share, err := h.noteService.ShareNote(customContext, userID, noteID, grantee.ID, role)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+
+	note, err := h.noteService.GetNote(customContext, userID, noteID)
+	if err != nil {
+		return h.mapNoteError(c, err)
+	}
+	h.sendShareInvitation(c, grantee, "note", note.Title, share.Role, config.GetString("APP_URL")+"/notes/"+note.ID.String())
+
+	share.Username = grantee.Username
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success": true,
+		"share":   share,
+	})
+}
+
+// Gets the users a notebook is shared with. Only owners of the notebook can see them.
+func (h *NoteHandler) getNotebookShares(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebookID, err := uuid.Parse(c.Params("notebookID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	shares, err := h.noteService.GetNotebookShares(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"shares":  shares,
+	})
+}
+
+// Shares a notebook, with the notebooks and notes in it, with the user with the given username or email
+// address and sends them an invitation.
+func (h *NoteHandler) shareNotebook(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	notebookID, err := uuid.Parse(c.Params("notebookID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	grantee, role, err := h.parseShareRequest(customContext, c)
+	if err != nil {
+		return err
+	}
+
+	share, err := h.noteService.ShareNotebook(customContext, userID, notebookID, grantee.ID, role)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+
+	notebook, err := h.noteService.GetNotebook(customContext, userID, notebookID)
+	if err != nil {
+		return h.mapNotebookError(c, err)
+	}
+	h.sendShareInvitation(c, grantee, "notebook", notebook.Name, share.Role, config.GetString("APP_URL")+"/notebooks/"+notebook.ID.String())
+
+	share.Username = grantee.Username
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{
+		"success": true,
+		"share":   share,
+	})
+}
+
+// Gets the notes and notebooks shared with the current user, newest first.
+func (h *NoteHandler) getReceivedShares(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	shares, err := h.noteService.GetReceivedShares(customContext, userID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"shares":  shares,
+	})
+}
+
+// Changes the role of a share of a note or notebook the current user is an owner of.
+func (h *NoteHandler) updateShare(c *fiber.Ctx) error {
+	type RequestPayload struct {
+		Role Role `json:"role"`
+	}
+
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	shareID, err := uuid.Parse(c.Params("shareID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	share, err := h.noteService.UpdateShare(customContext, userID, shareID, request.Role)
+	if err != nil {
+		return h.mapShareError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"share":   share,
+	})
+}
+
+// Removes a share of a note or notebook the current user is an owner of, or a share they received.
+func (h *NoteHandler) deleteShare(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	shareID, err := uuid.Parse(c.Params("shareID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.DeleteShare(customContext, userID, shareID)
+	if err != nil {
+		return h.mapShareError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"message": h.i18n.T(h.getLangCode(c), "messages.share_deleted"),
+	})
+}
+
+// parseShareRequest parses the body of a request to share a note or notebook, returning the user to share
+// it with, found by their username or email address, and the role to give them, viewer by default.
+func (h *NoteHandler) parseShareRequest(ctx context.Context, c *fiber.Ctx) (*user.User, Role, error) {
+	type RequestPayload struct {
+		User string `json:"user"`
+		Role Role   `json:"role"`
+	}
+
+	request := new(RequestPayload)
+	if err := c.BodyParser(request); err != nil {
+		return nil, "", apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+	if request.Role == "" {
+		request.Role = RoleViewer
+	}
+
+	grantee, err := h.userService.GetUserByEmailOrUsername(ctx, request.User)
+	if err != nil && (err == gorm.ErrRecordNotFound || err.Error() == consts.ErrDeletedRecord) {
+		return nil, "", apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeUserNotFound, h.i18n.T(h.getLangCode(c), "errors.user_not_found"))
+	} else if err != nil {
+		return nil, "", apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return grantee, request.Role, nil
+}
+
+// sendShareInvitation emails a user that a note or notebook has been shared with them. The share is
+// already created, so an error sending the email is not reported.
+func (h *NoteHandler) sendShareInvitation(c *fiber.Ctx, grantee *user.User, itemType string, name string, role Role, url string) {
+	if config.GetString("ENABLE_MAIL") == "false" {
+		return
+	}
+
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	sharedBy, _ := claims["user"].(string)
+	_ = h.mailer.SendMail(templates.GetShareInvitationEmail(h.i18n, grantee, sharedBy, itemType, name, string(role), url))
+}
+
+// mapShareError maps the errors returned by the share methods of the note service to API errors.
+func (h *NoteHandler) mapShareError(c *fiber.Ctx, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeShareNotFound, h.i18n.T(h.getLangCode(c), "errors.share_not_found"))
+	}
+	return consts.MapApiError(err, h.i18n, h.getLangCode(c))
+}
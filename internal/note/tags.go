@@ -0,0 +1,77 @@
+package note
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/auth"
+	"github.com/jramsgz/articpad/internal/user"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/apierror"
+	"github.com/jramsgz/articpad/pkg/i18n"
+	"gorm.io/gorm"
+)
+
+// Creates a new handler for the tags of the current user. Tags are created when they are given to notes.
+func NewTagHandler(tagRoute fiber.Router, ns NoteService, us user.UserService, denylist auth.TokenDenylist, i18n *i18n.I18n) {
+	handler := &NoteHandler{
+		noteService: ns,
+		userService: us,
+		i18n:        i18n,
+	}
+
+	tagRoute.Use(auth.JWTMiddleware(denylist, us), auth.GetDataFromJWT)
+
+	tagRoute.Get("", handler.getTags)
+	tagRoute.Delete("/:tagID", handler.deleteTag)
+}
+
+// Gets every tag of the current user with the number of notes that have it.
+func (h *NoteHandler) getTags(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	tags, err := h.noteService.GetTags(customContext, userID)
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+		"tags":    tags,
+	})
+}
+
+// Deletes a tag of the current user, removing it from all their notes.
+func (h *NoteHandler) deleteTag(c *fiber.Ctx) error {
+	customContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	tagID, err := uuid.Parse(c.Params("tagID"))
+	if err != nil {
+		return apierror.NewApiError(fiber.StatusBadRequest, consts.ErrCodeBadRequest, err.Error())
+	}
+
+	err = h.noteService.DeleteTag(customContext, userID, tagID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return apierror.NewApiError(fiber.StatusNotFound, consts.ErrCodeTagNotFound, h.i18n.T(h.getLangCode(c), "errors.tag_not_found"))
+		}
+		return apierror.NewApiError(fiber.StatusInternalServerError, consts.ErrCodeUnknown, err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"success": true,
+	})
+}
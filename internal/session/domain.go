@@ -0,0 +1,86 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Represents the 'Session' object, a sign in of a user on a device.
+// All the refresh tokens issued for a session belong to the same token family.
+type Session struct {
+	ID         uuid.UUID    `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID     uuid.UUID    `json:"-" gorm:"type:uuid;index;not null"`
+	UserAgent  string       `json:"user_agent" gorm:"not null"`
+	IPAddress  string       `json:"ip_address" gorm:"not null"`
+	LastUsedAt time.Time    `json:"last_used_at" gorm:"not null"`
+	RevokedAt  sql.NullTime `json:"-" gorm:"index"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"-"`
+	// Current is set when listing sessions to flag the one used by the request.
+	Current bool `json:"current" gorm:"-"`
+}
+
+// BeforeCreate will set default values for the session.
+func (session *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	session.ID = uuid.New()
+	// Set the created and updated times.
+	now := time.Now()
+	session.LastUsedAt = now
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	return
+}
+
+// IsRevoked returns true if the session can no longer be used.
+func (session *Session) IsRevoked() bool {
+	return session.RevokedAt.Valid
+}
+
+// Represents the 'RefreshToken' object. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:uuid"`
+	SessionID uuid.UUID `gorm:"type:uuid;index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+// BeforeCreate will set default values for the refresh token.
+func (token *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+	return
+}
+
+// Our repository will implement these methods.
+type SessionRepository interface {
+	GetSessions(ctx context.Context, userID uuid.UUID, activeSince time.Time) (*[]Session, error)
+	GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)
+	CreateSession(ctx context.Context, session *Session, token *RefreshToken) error
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeSessions(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID) ([]uuid.UUID, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, newToken *RefreshToken, ipAddress string) error
+	UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error
+	PurgeUser(ctx context.Context, tx *gorm.DB, userID uuid.UUID) error
+}
+
+// Our use-case or service will implement these methods.
+type SessionService interface {
+	GetActiveSessions(ctx context.Context, userID uuid.UUID) (*[]Session, error)
+	GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)
+	CreateSession(ctx context.Context, userID uuid.UUID, userAgent string, ipAddress string) (*Session, string, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error
+	RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) ([]uuid.UUID, error)
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	RotateRefreshToken(ctx context.Context, refreshToken string, ipAddress string) (*Session, string, error)
+	UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error
+}
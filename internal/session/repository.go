@@ -0,0 +1,161 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"gorm.io/gorm"
+)
+
+// Represents that we will use gorm in order to implement the methods.
+type dbRepository struct {
+	db *gorm.DB
+}
+
+// Create a new repository with gorm as the driver.
+func NewSessionRepository(dbConnection *gorm.DB) SessionRepository {
+	return &dbRepository{
+		db: dbConnection,
+	}
+}
+
+// Gets the sessions of a user that have not been revoked and were used after the given time.
+func (r *dbRepository) GetSessions(ctx context.Context, userID uuid.UUID, activeSince time.Time) (*[]Session, error) {
+	var sessions []Session
+
+	result := r.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL AND last_used_at > ?", userID, activeSince).
+		Order("last_used_at DESC").Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &sessions, nil
+}
+
+// Gets a single session in the database.
+func (r *dbRepository) GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error) {
+	session := &Session{}
+
+	result := r.db.WithContext(ctx).Where("id = ?", sessionID).First(session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return session, nil
+}
+
+// Creates a session along with its first refresh token.
+func (r *dbRepository) CreateSession(ctx context.Context, session *Session, token *RefreshToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		token.SessionID = session.ID
+		return tx.Create(token).Error
+	})
+}
+
+// Revokes a session, its refresh tokens can no longer be used.
+func (r *dbRepository) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", sql.NullTime{Time: time.Now(), Valid: true})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Revokes all the sessions of a user except the given one and returns the IDs of the revoked sessions.
+func (r *dbRepository) RevokeSessions(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID) ([]uuid.UUID, error) {
+	var sessionIDs []uuid.UUID
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptSessionID)
+
+		if err := query.Pluck("id", &sessionIDs).Error; err != nil {
+			return err
+		}
+		if len(sessionIDs) == 0 {
+			return nil
+		}
+
+		return tx.Model(&Session{}).Where("id IN ?", sessionIDs).
+			Update("revoked_at", sql.NullTime{Time: time.Now(), Valid: true}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionIDs, nil
+}
+
+// Gets a single refresh token by its hash.
+func (r *dbRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	token := &RefreshToken{}
+
+	result := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return token, nil
+}
+
+// Marks a refresh token as used and stores the one replacing it in the same session, which is
+// flagged as used from the given IP address. Returns an error if the old token had already been used.
+func (r *dbRepository) RotateRefreshToken(ctx context.Context, oldTokenID uuid.UUID, newToken *RefreshToken, ipAddress string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL", oldTokenID).
+			Update("used_at", sql.NullTime{Time: now, Valid: true})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New(consts.ErrRefreshTokenReused)
+		}
+
+		result = tx.Model(&Session{}).Where("id = ?", newToken.SessionID).Updates(map[string]any{
+			"last_used_at": now,
+			"ip_address":   ipAddress,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Create(newToken).Error
+	})
+}
+
+// Records the last use of a session and the IP address it was used from, unless it has been revoked.
+func (r *dbRepository) UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error {
+	result := r.db.WithContext(ctx).Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Updates(map[string]any{
+		"last_used_at": time.Now(),
+		"ip_address":   ipAddress,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Permanently deletes the sessions of a user along with their refresh tokens. Run in the transaction
+// that permanently deletes the user.
+func (r *dbRepository) PurgeUser(ctx context.Context, tx *gorm.DB, userID uuid.UUID) error {
+	tx = tx.WithContext(ctx)
+	sessions := tx.Model(&Session{}).Select("id").Where("user_id = ?", userID)
+
+	if err := tx.Where("session_id IN (?)", sessions).Delete(&RefreshToken{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("user_id = ?", userID).Delete(&Session{}).Error
+}
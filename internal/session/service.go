@@ -0,0 +1,173 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/securetoken"
+	"gorm.io/gorm"
+)
+
+// Maximum length of the user agent stored for a session.
+const maxUserAgentLength = 512
+
+// Implementation of the repository in this service.
+type sessionService struct {
+	sessionRepository SessionRepository
+	refreshTokenTTL   time.Duration
+}
+
+// Create a new 'service' or 'use-case' for 'Session' entity.
+// Refresh tokens issued by the service are valid for the given duration.
+func NewSessionService(r SessionRepository, refreshTokenTTL time.Duration) SessionService {
+	return &sessionService{
+		sessionRepository: r,
+		refreshTokenTTL:   refreshTokenTTL,
+	}
+}
+
+// Implementation of 'GetActiveSessions'. Sessions unused for longer than the refresh token
+// lifetime can no longer be refreshed, so they are not listed.
+func (s *sessionService) GetActiveSessions(ctx context.Context, userID uuid.UUID) (*[]Session, error) {
+	return s.sessionRepository.GetSessions(ctx, userID, time.Now().Add(-s.refreshTokenTTL))
+}
+
+// Implementation of 'GetSession'.
+func (s *sessionService) GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error) {
+	return s.sessionRepository.GetSession(ctx, sessionID)
+}
+
+// Implementation of 'CreateSession'. Returns the session and its first refresh token.
+func (s *sessionService) CreateSession(ctx context.Context, userID uuid.UUID, userAgent string, ipAddress string) (*Session, string, error) {
+	refreshToken, token, err := s.newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		// Cut on a rune boundary, a split character would be rejected as invalid text by the database.
+		end := maxUserAgentLength
+		for end > 0 && !utf8.RuneStart(userAgent[end]) {
+			end--
+		}
+		userAgent = userAgent[:end]
+	}
+
+	session := &Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	}
+
+	err = s.sessionRepository.CreateSession(ctx, session, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// Implementation of 'RevokeSession'.
+func (s *sessionService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	return s.sessionRepository.RevokeSession(ctx, sessionID)
+}
+
+// Implementation of 'RevokeUserSession'. Returns gorm.ErrRecordNotFound if the session does not belong to the user.
+func (s *sessionService) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepository.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+
+	return s.sessionRepository.RevokeSession(ctx, sessionID)
+}
+
+// Implementation of 'RevokeOtherSessions'.
+func (s *sessionService) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) ([]uuid.UUID, error) {
+	return s.sessionRepository.RevokeSessions(ctx, userID, currentSessionID)
+}
+
+// Implementation of 'RevokeAllSessions'. Returns the IDs of the revoked sessions.
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return s.sessionRepository.RevokeSessions(ctx, userID, uuid.Nil)
+}
+
+// Implementation of 'RotateRefreshToken'. Exchanges a refresh token for a new one in the same session.
+// If a refresh token is used twice it has probably been stolen, so the whole session is revoked
+// and returned along with the error so the caller can revoke its access tokens too.
+func (s *sessionService) RotateRefreshToken(ctx context.Context, refreshToken string, ipAddress string) (*Session, string, error) {
+	oldToken, err := s.sessionRepository.GetRefreshTokenByHash(ctx, securetoken.Hash(refreshToken))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", errors.New(consts.ErrInvalidRefreshToken)
+		}
+		return nil, "", err
+	}
+
+	session, err := s.sessionRepository.GetSession(ctx, oldToken.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if session.IsRevoked() {
+		return nil, "", errors.New(consts.ErrSessionRevoked)
+	}
+
+	if oldToken.UsedAt.Valid {
+		return session, "", s.revokeReusedSession(ctx, session)
+	}
+
+	if oldToken.ExpiresAt.Before(time.Now()) {
+		return nil, "", errors.New(consts.ErrRefreshTokenExpired)
+	}
+
+	newRefreshToken, newToken, err := s.newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	newToken.SessionID = session.ID
+
+	err = s.sessionRepository.RotateRefreshToken(ctx, oldToken.ID, newToken, ipAddress)
+	if err != nil {
+		if err.Error() == consts.ErrRefreshTokenReused {
+			// The token was used concurrently by another request.
+			return session, "", s.revokeReusedSession(ctx, session)
+		}
+		return nil, "", err
+	}
+
+	return session, newRefreshToken, nil
+}
+
+// Implementation of 'UpdateSessionUsage'.
+func (s *sessionService) UpdateSessionUsage(ctx context.Context, sessionID uuid.UUID, ipAddress string) error {
+	return s.sessionRepository.UpdateSessionUsage(ctx, sessionID, ipAddress)
+}
+
+// revokeReusedSession revokes a session whose refresh token has been reused.
+func (s *sessionService) revokeReusedSession(ctx context.Context, session *Session) error {
+	if err := s.sessionRepository.RevokeSession(ctx, session.ID); err != nil {
+		return err
+	}
+	return errors.New(consts.ErrRefreshTokenReused)
+}
+
+// newRefreshToken generates a refresh token, returning its plain-text value and the record to store.
+func (s *sessionService) newRefreshToken() (string, *RefreshToken, error) {
+	refreshToken, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, &RefreshToken{
+		TokenHash: securetoken.Hash(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	}, nil
+}
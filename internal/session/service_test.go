@@ -0,0 +1,211 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+	"gorm.io/gorm"
+)
+
+func newTestSessionService(t *testing.T, refreshTokenTTL time.Duration) (SessionService, *gorm.DB) {
+	db := testdb.New(t, &Session{}, &RefreshToken{})
+	return NewSessionService(NewSessionRepository(db), refreshTokenTTL), db
+}
+
+func createTestSessions(t *testing.T, service SessionService, userID uuid.UUID, count int) []uuid.UUID {
+	sessionIDs := make([]uuid.UUID, count)
+	for i := range sessionIDs {
+		session, _, err := service.CreateSession(context.Background(), userID, "test", "192.0.2.1")
+		if err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+		sessionIDs[i] = session.ID
+	}
+	return sessionIDs
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	service, _ := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+
+	session, refreshToken, err := service.CreateSession(ctx, uuid.New(), "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rotated, newRefreshToken, err := service.RotateRefreshToken(ctx, refreshToken, "192.0.2.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rotated.ID != session.ID {
+		t.Errorf("expected the token to stay in session %s, got %s", session.ID, rotated.ID)
+	}
+	if newRefreshToken == "" || newRefreshToken == refreshToken {
+		t.Error("expected a new refresh token")
+	}
+
+	if _, _, err := service.RotateRefreshToken(ctx, "unknown", "192.0.2.2"); err == nil || err.Error() != consts.ErrInvalidRefreshToken {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidRefreshToken, err)
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesSession(t *testing.T) {
+	service, _ := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+
+	session, refreshToken, err := service.CreateSession(ctx, uuid.New(), "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, newRefreshToken, err := service.RotateRefreshToken(ctx, refreshToken, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Using a token twice means it has probably been stolen, the session is returned so its access
+	// tokens can be revoked too.
+	reused, _, err := service.RotateRefreshToken(ctx, refreshToken, "198.51.100.1")
+	if err == nil || err.Error() != consts.ErrRefreshTokenReused {
+		t.Fatalf("expected %q, got %v", consts.ErrRefreshTokenReused, err)
+	}
+	if reused == nil || reused.ID != session.ID {
+		t.Errorf("expected session %s to be returned, got %v", session.ID, reused)
+	}
+
+	// The legitimate token stops working too.
+	if _, _, err := service.RotateRefreshToken(ctx, newRefreshToken, "192.0.2.1"); err == nil || err.Error() != consts.ErrSessionRevoked {
+		t.Errorf("expected %q, got %v", consts.ErrSessionRevoked, err)
+	}
+}
+
+func TestRotateRefreshTokenExpired(t *testing.T) {
+	service, _ := newTestSessionService(t, -time.Minute)
+	ctx := context.Background()
+
+	_, refreshToken, err := service.CreateSession(ctx, uuid.New(), "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, err := service.RotateRefreshToken(ctx, refreshToken, "192.0.2.1"); err == nil || err.Error() != consts.ErrRefreshTokenExpired {
+		t.Errorf("expected %q, got %v", consts.ErrRefreshTokenExpired, err)
+	}
+}
+
+func TestGetActiveSessions(t *testing.T) {
+	service, db := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	sessionIDs := createTestSessions(t, service, userID, 3)
+	createTestSessions(t, service, uuid.New(), 1)
+	if err := service.RevokeSession(ctx, sessionIDs[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Sessions unused for longer than the refresh token lifetime cannot be refreshed anymore.
+	db.Model(&Session{}).Where("id = ?", sessionIDs[2]).Update("last_used_at", time.Now().Add(-2*time.Hour))
+
+	sessions, err := service.GetActiveSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*sessions) != 1 || (*sessions)[0].ID != sessionIDs[0] {
+		t.Errorf("expected only session %s, got %v", sessionIDs[0], *sessions)
+	}
+}
+
+func TestRevokeUserSession(t *testing.T) {
+	service, _ := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	sessionID := createTestSessions(t, service, userID, 1)[0]
+
+	// Users cannot tell the sessions of others apart from sessions that do not exist.
+	if err := service.RevokeUserSession(ctx, otherID, sessionID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+	if err := service.RevokeUserSession(ctx, userID, sessionID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session, err := service.GetSession(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !session.IsRevoked() {
+		t.Error("expected the session to be revoked")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	service, _ := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+	userID := uuid.New()
+	sessionIDs := createTestSessions(t, service, userID, 3)
+	otherSessionID := createTestSessions(t, service, uuid.New(), 1)[0]
+
+	revoked, err := service.RevokeOtherSessions(ctx, userID, sessionIDs[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revoked) != 2 {
+		t.Errorf("expected 2 sessions to be revoked, got %d", len(revoked))
+	}
+
+	for _, sessionID := range []uuid.UUID{sessionIDs[0], otherSessionID} {
+		session, err := service.GetSession(ctx, sessionID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if session.IsRevoked() {
+			t.Errorf("expected session %s to be kept", sessionID)
+		}
+	}
+
+	// Sessions already revoked are not returned again, as their access tokens were already revoked.
+	revoked, err = service.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0] != sessionIDs[0] {
+		t.Errorf("expected only session %s to be revoked, got %v", sessionIDs[0], revoked)
+	}
+}
+
+func TestUpdateSessionUsage(t *testing.T) {
+	service, db := newTestSessionService(t, time.Hour)
+	ctx := context.Background()
+	sessionIDs := createTestSessions(t, service, uuid.New(), 2)
+	lastUsedAt := time.Now().Add(-time.Hour)
+	db.Model(&Session{}).Where("id IN ?", sessionIDs).Update("last_used_at", lastUsedAt)
+
+	if err := service.RevokeSession(ctx, sessionIDs[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, sessionID := range sessionIDs {
+		if err := service.UpdateSessionUsage(ctx, sessionID, "198.51.100.1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	session, err := service.GetSession(ctx, sessionIDs[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !session.LastUsedAt.After(lastUsedAt) || session.IPAddress != "198.51.100.1" {
+		t.Errorf("expected the use of the session to be recorded, got %s from %s", session.LastUsedAt, session.IPAddress)
+	}
+
+	// Revoked sessions are left as they were when they were signed out.
+	revoked, err := service.GetSession(ctx, sessionIDs[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revoked.LastUsedAt.After(lastUsedAt.Add(time.Second)) || revoked.IPAddress != "192.0.2.1" {
+		t.Errorf("expected the revoked session to be left unchanged, got %s from %s", revoked.LastUsedAt, revoked.IPAddress)
+	}
+}
@@ -16,11 +16,24 @@ type User struct {
 	Email                  string         `json:"email" gorm:"uniqueIndex;not null"`
 	Password               string         `json:"-" gorm:"not null"`
 	VerifiedAt             sql.NullTime   `json:"-"`
-	VerificationToken      string         `json:"-" gorm:"uniqueIndex;not null"`
+	VerificationToken      sql.NullString `json:"-" gorm:"uniqueIndex"`
+	VerificationExpiresAt  sql.NullTime   `json:"-"`
 	PasswordResetToken     sql.NullString `json:"-" gorm:"uniqueIndex"`
-	PasswordResetExpiresAt time.Time      `json:"-"`
+	PasswordResetExpiresAt sql.NullTime   `json:"-"`
 	IsAdmin                bool           `json:"is_admin" gorm:"not null"`
 	Lang                   string         `json:"lang" gorm:"not null"`
+	TwoFactorEnabled       bool           `json:"two_factor_enabled" gorm:"not null;default:false"`
+	TOTPSecret             string         `json:"-"`
+	TOTPLastUsedStep       int64          `json:"-" gorm:"not null;default:0"`
+	FailedLoginAttempts    int            `json:"-" gorm:"not null;default:0"`
+	LastFailedLoginAt      sql.NullTime   `json:"-"`
+	LockedUntil            sql.NullTime   `json:"-"`
+	PendingEmail           string         `json:"pending_email,omitempty"`
+	EmailChangeToken       sql.NullString `json:"-" gorm:"uniqueIndex"`
+	EmailChangeExpiresAt   sql.NullTime   `json:"-"`
+	MagicLinkToken         sql.NullString `json:"-" gorm:"uniqueIndex"`
+	MagicLinkExpiresAt     sql.NullTime   `json:"-"`
+	DeletionRequestedAt    sql.NullTime   `json:"-"`
 	CreatedAt              time.Time      `json:"created_at"`
 	UpdatedAt              time.Time      `json:"updated_at"`
 	DeletedAt              gorm.DeletedAt `json:"-" gorm:"index"`
@@ -32,7 +45,6 @@ func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
 	user.ID = uuid.New()
 	// Set the created and updated times.
 	now := time.Now()
-	user.PasswordResetExpiresAt = now
 	user.CreatedAt = now
 	user.UpdatedAt = now
 	return
@@ -44,6 +56,170 @@ func (user *User) BeforeUpdate(tx *gorm.DB) (err error) {
 	return
 }
 
+// ListOptions holds the pagination and filtering options used when listing users.
+type ListOptions struct {
+	Page    int
+	PerPage int
+	// Search filters the users whose username or email contain it.
+	Search string
+	// Status filters the users by the state of their account, either "active", "disabled" or "all".
+	Status string
+}
+
+// Defines how failed logins are handled. Each failed attempt doubles the time users must wait
+// before trying again, starting at BaseDelay and up to MaxDelay. After MaxAttempts consecutive
+// failures the account is locked for LockoutDuration. Zero values disable each mechanism.
+type LockoutPolicy struct {
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+// Registration modes, defining who can create an account.
+const (
+	RegistrationOpen   = "open"
+	RegistrationClosed = "closed"
+	RegistrationInvite = "invite"
+)
+
+// Defines who can create an account, except for the first user who always can as they become an
+// administrator. Mode is one of the registration modes, unknown modes close the registration. If
+// AllowedEmailDomains is not empty, only emails of those domains are accepted.
+type RegistrationPolicy struct {
+	Mode                string   `json:"mode"`
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+}
+
+// Represents a one-time code that can be used instead of a TOTP code. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:uuid"`
+	UserID    uuid.UUID `gorm:"type:uuid;index;not null"`
+	CodeHash  string    `gorm:"not null"`
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+// BeforeCreate will set default values for the recovery code.
+func (code *RecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	code.ID = uuid.New()
+	code.CreatedAt = time.Now()
+	return
+}
+
+// Represents an account of an external identity provider linked to a user.
+type Identity struct {
+	ID        uuid.UUID `json:"-" gorm:"primaryKey;type:uuid"`
+	UserID    uuid.UUID `json:"-" gorm:"type:uuid;index;not null"`
+	Issuer    string    `json:"issuer" gorm:"uniqueIndex:idx_identity_issuer_subject;not null"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identity_issuer_subject;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate will set default values for the identity.
+func (identity *Identity) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	identity.ID = uuid.New()
+	identity.CreatedAt = time.Now()
+	return
+}
+
+// Represents a WebAuthn credential, such as a passkey or a security key, a user can sign in with.
+type Credential struct {
+	ID              uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID          uuid.UUID  `json:"-" gorm:"type:uuid;index;not null"`
+	Name            string     `json:"name" gorm:"not null"`
+	CredentialID    []byte     `json:"-" gorm:"uniqueIndex;not null"`
+	PublicKey       []byte     `json:"-" gorm:"not null"`
+	AttestationType string     `json:"-"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-" gorm:"not null;default:0"`
+	Transports      string     `json:"-"`
+	BackupEligible  bool       `json:"-" gorm:"not null;default:false"`
+	BackupState     bool       `json:"-" gorm:"not null;default:false"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// BeforeCreate will set default values for the credential.
+func (credential *Credential) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	credential.ID = uuid.New()
+	credential.CreatedAt = time.Now()
+	return
+}
+
+// Represents an invitation to create an account when registration is invite-only. Only the hash of
+// its code is stored. If Email is set, the invitation can only be used to register with that email.
+type Invite struct {
+	ID        uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Email     string     `json:"email"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
+	UsedBy    *uuid.UUID `json:"used_by" gorm:"type:uuid"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate will set default values for the invite.
+func (invite *Invite) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	invite.ID = uuid.New()
+	invite.CreatedAt = time.Now()
+	return
+}
+
+// Prefix of personal API tokens, so they can be told apart from JWTs.
+const APITokenPrefix = "articpad_pat_"
+
+// Scopes of personal API tokens. Read gives access to the GET endpoints and write to the rest of
+// them, admin gives access to the administration endpoints if the user is an administrator.
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+	APITokenScopeAdmin = "admin"
+)
+
+// Represents a personal API token a user can access the API with from scripts and integrations.
+// Only the hash of the token is stored.
+type APIToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid"`
+	UserID     uuid.UUID  `json:"-" gorm:"type:uuid;index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate will set default values for the API token.
+func (token *APIToken) BeforeCreate(tx *gorm.DB) (err error) {
+	// UUID version 4
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+	return
+}
+
+// HasScope tells whether the token has been granted the given scope.
+func (token *APIToken) HasScope(scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Deletes the data a user owns in another domain. Each domain holding data of users implements it, so the
+// user repository can delete that data in the same transaction as the user, see 'HardDeleteUser'.
+type UserDataPurger interface {
+	PurgeUser(ctx context.Context, tx *gorm.DB, userID uuid.UUID) error
+}
+
 // Our repository will implement these methods.
 type UserRepository interface {
 	GetUsers(ctx context.Context) (*[]User, error)
@@ -54,10 +230,53 @@ type UserRepository interface {
 	UpdateUser(ctx context.Context, userID uuid.UUID, user *User) error
 	DeleteUser(ctx context.Context, userID uuid.UUID) error
 	GetFirstUser(ctx context.Context) (*User, error)
-	GetUserByVerificationToken(ctx context.Context, verificationToken string) (*User, error)
+	SetVerificationToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	GetUserByVerificationToken(ctx context.Context, tokenHash string) (*User, error)
 	SetUserVerified(ctx context.Context, userID uuid.UUID) error
-	SetPasswordResetToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error
-	GetUserByPasswordResetToken(ctx context.Context, token string) (*User, error)
+	SetPasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	GetUserByPasswordResetToken(ctx context.Context, tokenHash string) (*User, error)
+	UsePasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string) error
+	SetTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error
+	SetTwoFactorEnabled(ctx context.Context, userID uuid.UUID, enabled bool) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	GetRecoveryCodes(ctx context.Context, userID uuid.UUID) (*[]RecoveryCode, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []RecoveryCode) error
+	UseRecoveryCode(ctx context.Context, codeID uuid.UUID) error
+	GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error)
+	CreateIdentity(ctx context.Context, identity *Identity) error
+	CreateUserWithIdentity(ctx context.Context, user *User, identity *Identity) error
+	RegisterFailedLogin(ctx context.Context, userID uuid.UUID, maxAttempts int, lockedUntil time.Time) (bool, error)
+	ResetFailedLogins(ctx context.Context, userID uuid.UUID) error
+	GetUsersPage(ctx context.Context, opts *ListOptions) (*[]User, int64, error)
+	GetUserUnscoped(ctx context.Context, userID uuid.UUID) (*User, error)
+	SetAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool) error
+	RestoreUser(ctx context.Context, userID uuid.UUID) error
+	HardDeleteUser(ctx context.Context, userID uuid.UUID) error
+	UpdateProfile(ctx context.Context, userID uuid.UUID, username string, lang string) error
+	SetPassword(ctx context.Context, userID uuid.UUID, password string) error
+	SetEmailChange(ctx context.Context, userID uuid.UUID, email string, tokenHash string, expiresAt time.Time) error
+	GetUserByEmailChangeToken(ctx context.Context, tokenHash string) (*User, error)
+	ChangeEmail(ctx context.Context, userID uuid.UUID, email string) error
+	GetIdentities(ctx context.Context, userID uuid.UUID) (*[]Identity, error)
+	RequestDeletion(ctx context.Context, userID uuid.UUID) error
+	GetUsersDeletionRequestedBefore(ctx context.Context, requestedBefore time.Time) ([]uuid.UUID, error)
+	SetMagicLinkToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	GetUserByMagicLinkToken(ctx context.Context, tokenHash string) (*User, error)
+	UseMagicLinkToken(ctx context.Context, userID uuid.UUID, tokenHash string) error
+	GetCredentials(ctx context.Context, userID uuid.UUID) (*[]Credential, error)
+	CreateCredential(ctx context.Context, credential *Credential) error
+	UpdateCredentialUsage(ctx context.Context, credentialID uuid.UUID, signCount uint32, backupState bool) error
+	DeleteCredential(ctx context.Context, userID uuid.UUID, credentialID uuid.UUID) error
+	GetAPITokens(ctx context.Context, userID uuid.UUID) (*[]APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	CreateAPIToken(ctx context.Context, token *APIToken) error
+	UpdateAPITokenUsage(ctx context.Context, tokenID uuid.UUID, ipAddress string) error
+	DeleteAPIToken(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error
+	GetInvites(ctx context.Context) (*[]Invite, error)
+	GetInviteByCodeHash(ctx context.Context, codeHash string) (*Invite, error)
+	CreateInvite(ctx context.Context, invite *Invite) error
+	DeleteInvite(ctx context.Context, inviteID uuid.UUID) error
+	CreateUserWithInvite(ctx context.Context, user *User, inviteID uuid.UUID) error
 }
 
 // Our use-case or service will implement these methods.
@@ -71,7 +290,45 @@ type UserService interface {
 	DeleteUser(ctx context.Context, userID uuid.UUID) error
 	IsFirstUser(ctx context.Context) (bool, error)
 	GetUserByEmailOrUsername(ctx context.Context, emailOrUsername string) (*User, error)
+	CreateVerificationToken(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error)
 	VerifyUser(ctx context.Context, verificationToken string) error
-	SetPasswordResetToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error
+	CreatePasswordResetToken(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error)
 	ResetPassword(ctx context.Context, token string, password string) error
+	SetupTwoFactor(ctx context.Context, userID uuid.UUID) (string, string, error)
+	EnableTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, bool, error)
+	CheckTwoFactorCode(ctx context.Context, userID uuid.UUID, code string) (bool, error)
+	GetOrCreateExternalUser(ctx context.Context, identity *Identity, email string, username string, lang string, autoRegister bool) (*User, error)
+	CheckPassword(ctx context.Context, user *User, password string) (bool, error)
+	ResetFailedLogins(ctx context.Context, userID uuid.UUID) error
+	GetUsersPage(ctx context.Context, opts *ListOptions) (*[]User, int64, error)
+	GetUserUnscoped(ctx context.Context, userID uuid.UUID) (*User, error)
+	SetAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool) error
+	ForceVerifyUser(ctx context.Context, userID uuid.UUID) error
+	DisableUser(ctx context.Context, userID uuid.UUID) error
+	RestoreUser(ctx context.Context, userID uuid.UUID) error
+	HardDeleteUser(ctx context.Context, userID uuid.UUID) error
+	UpdateProfile(ctx context.Context, userID uuid.UUID, username string, lang string) (*User, error)
+	ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword string, newPassword string) (bool, error)
+	RequestEmailChange(ctx context.Context, userID uuid.UUID, password string, email string) (*User, string, bool, error)
+	ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+	GetIdentities(ctx context.Context, userID uuid.UUID) (*[]Identity, error)
+	DeleteAccount(ctx context.Context, userID uuid.UUID, password string) (bool, error)
+	PurgeDeletedUsers(ctx context.Context, requestedBefore time.Time) (int, error)
+	CreateMagicLink(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error)
+	UseMagicLink(ctx context.Context, token string) (*User, error)
+	GetCredentials(ctx context.Context, userID uuid.UUID) (*[]Credential, error)
+	AddCredential(ctx context.Context, userID uuid.UUID, password string, credential *Credential) (bool, error)
+	UpdateCredentialUsage(ctx context.Context, credentialID uuid.UUID, signCount uint32, backupState bool) error
+	DeleteCredential(ctx context.Context, userID uuid.UUID, password string, credentialID uuid.UUID) (bool, error)
+	GetAPITokens(ctx context.Context, userID uuid.UUID) (*[]APIToken, error)
+	CreateAPIToken(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error)
+	DeleteAPIToken(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error
+	AuthenticateAPIToken(ctx context.Context, token string, ipAddress string) (*User, *APIToken, error)
+	GetRegistrationPolicy() *RegistrationPolicy
+	RegisterUser(ctx context.Context, user *User, inviteCode string) error
+	GetInvites(ctx context.Context) (*[]Invite, error)
+	CreateInvite(ctx context.Context, createdBy uuid.UUID, email string, expiresAt *time.Time) (*Invite, string, error)
+	DeleteInvite(ctx context.Context, inviteID uuid.UUID) error
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,13 +14,16 @@ import (
 
 // Represents that we will use MariaDB in order to implement the methods.
 type dbRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	purgers []UserDataPurger
 }
 
-// Create a new repository with MariaDB as the driver.
-func NewUserRepository(dbConnection *gorm.DB) UserRepository {
+// Create a new repository with MariaDB as the driver. The data of users held by other domains is
+// deleted by the given purgers when users are permanently deleted.
+func NewUserRepository(dbConnection *gorm.DB, purgers ...UserDataPurger) UserRepository {
 	return &dbRepository{
-		db: dbConnection,
+		db:      dbConnection,
+		purgers: purgers,
 	}
 }
 
@@ -123,11 +127,27 @@ func (r *dbRepository) GetFirstUser(ctx context.Context) (*User, error) {
 	return user, nil
 }
 
-// GetUserByVerificationToken returns a user by its verification token.
-func (r *dbRepository) GetUserByVerificationToken(ctx context.Context, verificationToken string) (*User, error) {
+// Sets the hash of the token that verifies the email of a user, replacing any previous one.
+func (r *dbRepository) SetVerificationToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"verification_token":      tokenHash,
+		"verification_expires_at": expiresAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetUserByVerificationToken returns the user whose verification token has the given hash.
+func (r *dbRepository) GetUserByVerificationToken(ctx context.Context, tokenHash string) (*User, error) {
 	user := &User{}
 
-	result := r.db.WithContext(ctx).Where("verification_token = ?", verificationToken).First(user)
+	result := r.db.WithContext(ctx).Where("verification_token = ?", tokenHash).First(user)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -135,21 +155,240 @@ func (r *dbRepository) GetUserByVerificationToken(ctx context.Context, verificat
 	return user, nil
 }
 
-// SetUserVerified verifies a user by its ID.
+// SetUserVerified verifies a user by its ID and clears their verification token.
 func (r *dbRepository) SetUserVerified(ctx context.Context, userID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"verified_at":             time.Now(),
+		"verification_token":      nil,
+		"verification_expires_at": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Sets the hash of the password reset token for a user, replacing any previous one.
+func (r *dbRepository) SetPasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password_reset_token":      tokenHash,
+		"password_reset_expires_at": expiresAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the user whose password reset token has the given hash.
+func (r *dbRepository) GetUserByPasswordResetToken(ctx context.Context, tokenHash string) (*User, error) {
 	user := &User{}
 
-	result := r.db.WithContext(ctx).Where("id = ?", userID).First(user)
+	result := r.db.WithContext(ctx).Where("password_reset_token = ?", tokenHash).First(user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
+// Clears the password reset token of a user if it still has the given hash, so it can only be used once.
+func (r *dbRepository) UsePasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ? AND password_reset_token = ?", userID, tokenHash).Updates(map[string]interface{}{
+		"password_reset_token":      nil,
+		"password_reset_expires_at": nil,
+	})
 	if result.Error != nil {
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Sets a new pending TOTP secret for a user, two-factor authentication stays disabled until confirmed.
+func (r *dbRepository) SetTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]any{
+		"totp_secret":         secret,
+		"totp_last_used_step": 0,
+		"two_factor_enabled":  false,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// Enables or disables two-factor authentication for a user. Disabling it also removes the
+// TOTP secret and the recovery codes.
+func (r *dbRepository) SetTwoFactorEnabled(ctx context.Context, userID uuid.UUID, enabled bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]any{"two_factor_enabled": enabled}
+		if !enabled {
+			updates["totp_secret"] = ""
+			updates["totp_last_used_step"] = 0
+			if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&User{}).Where("id = ?", userID).Updates(updates).Error
+	})
+}
+
+// Stores the time step of the last TOTP code used by a user.
+// Returns an error if a code from the same or a later time step has already been used.
+func (r *dbRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ? AND totp_last_used_step < ?", userID, step).
+		Update("totp_last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New(consts.ErrInvalidTwoFactorCode)
+	}
+
+	return nil
+}
+
+// Gets the unused recovery codes of a user.
+func (r *dbRepository) GetRecoveryCodes(ctx context.Context, userID uuid.UUID) (*[]RecoveryCode, error) {
+	var codes []RecoveryCode
+
+	result := r.db.WithContext(ctx).Where("user_id = ? AND used_at IS NULL", userID).Find(&codes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &codes, nil
+}
+
+// Replaces all the recovery codes of a user.
+func (r *dbRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		for i := range codes {
+			codes[i].UserID = userID
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Marks a recovery code as used. Returns an error if it had already been used.
+func (r *dbRepository) UseRecoveryCode(ctx context.Context, codeID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&RecoveryCode{}).Where("id = ? AND used_at IS NULL", codeID).
+		Update("used_at", sql.NullTime{Time: time.Now(), Valid: true})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New(consts.ErrInvalidTwoFactorCode)
+	}
+
+	return nil
+}
+
+// Gets the user linked to an account of an external identity provider.
+func (r *dbRepository) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error) {
+	identity := &Identity{}
+
+	result := r.db.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).First(identity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	user := &User{}
+	result = r.db.WithContext(ctx).Unscoped().First(user, identity.UserID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if user.DeletedAt.Valid {
+		return nil, errors.New(consts.ErrDeletedRecord)
+	}
 
-	user.VerifiedAt = sql.NullTime{
-		Time:  time.Now(),
-		Valid: true,
+	return user, nil
+}
+
+// Links an account of an external identity provider to an existing user.
+func (r *dbRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	result := r.db.WithContext(ctx).Create(identity)
+	if result.Error != nil {
+		return result.Error
 	}
 
-	result = r.db.WithContext(ctx).Save(user)
+	return nil
+}
+
+// Creates a user and links it to an account of an external identity provider.
+func (r *dbRepository) CreateUserWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+// Counts a failed login of a user. Once the user reaches the maximum number of attempts, their account
+// is locked until the given time and the counter is reset. Returns true if this attempt locked the account.
+func (r *dbRepository) RegisterFailedLogin(ctx context.Context, userID uuid.UUID, maxAttempts int, lockedUntil time.Time) (bool, error) {
+	locked := false
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]any{
+			"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+			"last_failed_login_at":  sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if maxAttempts <= 0 {
+			return nil
+		}
+
+		// Only the attempt reaching the limit locks the account.
+		result = tx.Model(&User{}).Where("id = ? AND failed_login_attempts >= ?", userID, maxAttempts).Updates(map[string]any{
+			"failed_login_attempts": 0,
+			"locked_until":          sql.NullTime{Time: lockedUntil, Valid: true},
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		locked = result.RowsAffected > 0
+
+		return nil
+	})
+
+	return locked, err
+}
+
+// Resets the failed logins of a user after a successful login.
+func (r *dbRepository) ResetFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND (failed_login_attempts > 0 OR locked_until IS NOT NULL)", userID).
+		Updates(map[string]any{
+			"failed_login_attempts": 0,
+			"last_failed_login_at":  sql.NullTime{},
+			"locked_until":          sql.NullTime{},
+		})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -157,37 +396,450 @@ func (r *dbRepository) SetUserVerified(ctx context.Context, userID uuid.UUID) er
 	return nil
 }
 
-// Sets the password reset token for a user.
-func (r *dbRepository) SetPasswordResetToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error {
+// Gets a page of users, including disabled ones depending on the options.
+func (r *dbRepository) GetUsersPage(ctx context.Context, opts *ListOptions) (*[]User, int64, error) {
+	var users []User
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&User{})
+	switch opts.Status {
+	case "disabled":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	case "all":
+		query = query.Unscoped()
+	}
+
+	if opts.Search != "" {
+		search := "%" + strings.ToLower(opts.Search) + "%"
+		query = query.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", search, search)
+	}
+
+	result := query.Count(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	result = query.Order("created_at ASC").Offset((opts.Page - 1) * opts.PerPage).Limit(opts.PerPage).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return &users, total, nil
+}
+
+// Gets a single user in the database, even if it has been disabled.
+func (r *dbRepository) GetUserUnscoped(ctx context.Context, userID uuid.UUID) (*User, error) {
 	user := &User{}
 
-	result := r.db.WithContext(ctx).Where("id = ?", userID).First(user)
+	result := r.db.WithContext(ctx).Unscoped().First(user, userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
+// Grants or revokes the administrator role of a user.
+func (r *dbRepository) SetAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("is_admin", isAdmin)
 	if result.Error != nil {
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
 
-	user.PasswordResetToken = sql.NullString{
-		String: token,
-		Valid:  true,
+	return nil
+}
+
+// Restores a disabled user, cancelling the deletion of their account if they requested it.
+func (r *dbRepository) RestoreUser(ctx context.Context, userID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", userID).
+		Updates(map[string]interface{}{
+			"deleted_at":            nil,
+			"deletion_requested_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
-	user.PasswordResetExpiresAt = expiresAt
 
-	result = r.db.WithContext(ctx).Save(user)
+	return nil
+}
+
+// Permanently deletes a user along with all the data they own.
+func (r *dbRepository) HardDeleteUser(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, purger := range r.purgers {
+			if err := purger.PurgeUser(ctx, tx, userID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&Identity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&Credential{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("created_by = ? AND used_at IS NULL", userID).Delete(&Invite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Invite{}).Where("used_by = ?", userID).Update("used_by", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&User{}, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// Updates the username and language of a user.
+func (r *dbRepository) UpdateProfile(ctx context.Context, userID uuid.UUID, username string, lang string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"username": username,
+		"lang":     lang,
+	})
 	if result.Error != nil {
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
 
 	return nil
 }
 
-// Gets a user by its password reset token and checks if it is still valid.
-func (r *dbRepository) GetUserByPasswordResetToken(ctx context.Context, token string) (*User, error) {
+// Replaces the password hash of a user.
+func (r *dbRepository) SetPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("password", password)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Stores the email a user wants to change to, along with the hash of the token that confirms it.
+func (r *dbRepository) SetEmailChange(ctx context.Context, userID uuid.UUID, email string, tokenHash string, expiresAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"pending_email":           email,
+		"email_change_token":      tokenHash,
+		"email_change_expires_at": expiresAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the user with a pending email change confirmed by the token with the given hash.
+func (r *dbRepository) GetUserByEmailChangeToken(ctx context.Context, tokenHash string) (*User, error) {
 	user := &User{}
 
-	result := r.db.WithContext(ctx).Where("password_reset_token = ?", token).First(user)
+	result := r.db.WithContext(ctx).Where("email_change_token = ?", tokenHash).First(user)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
 	return user, nil
 }
+
+// Changes the email of a user and clears their pending email change. The new email is
+// considered verified, as it can only be changed by proving access to it.
+func (r *dbRepository) ChangeEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":                   email,
+		"pending_email":           "",
+		"email_change_token":      nil,
+		"email_change_expires_at": nil,
+		"verified_at":             time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the external identities linked to a user.
+func (r *dbRepository) GetIdentities(ctx context.Context, userID uuid.UUID) (*[]Identity, error) {
+	var identities []Identity
+
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&identities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &identities, nil
+}
+
+// Disables a user and records that they requested the deletion of their account.
+func (r *dbRepository) RequestDeletion(ctx context.Context, userID uuid.UUID) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"deleted_at":            now,
+		"deletion_requested_at": now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the IDs of the disabled users that requested the deletion of their account before the given time.
+func (r *dbRepository) GetUsersDeletionRequestedBefore(ctx context.Context, requestedBefore time.Time) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+
+	result := r.db.WithContext(ctx).Unscoped().Model(&User{}).
+		Where("deleted_at IS NOT NULL AND deletion_requested_at IS NOT NULL AND deletion_requested_at < ?", requestedBefore).
+		Pluck("id", &userIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return userIDs, nil
+}
+
+// Sets the hash of the token of the magic link a user can sign in with, replacing any previous one.
+func (r *dbRepository) SetMagicLinkToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"magic_link_token":      tokenHash,
+		"magic_link_expires_at": expiresAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the user that can sign in with the magic link token with the given hash.
+func (r *dbRepository) GetUserByMagicLinkToken(ctx context.Context, tokenHash string) (*User, error) {
+	user := &User{}
+
+	result := r.db.WithContext(ctx).Where("magic_link_token = ?", tokenHash).First(user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
+// Clears the magic link token of a user if it still has the given hash, so it can only be used once.
+func (r *dbRepository) UseMagicLinkToken(ctx context.Context, userID uuid.UUID, tokenHash string) error {
+	result := r.db.WithContext(ctx).Model(&User{}).Where("id = ? AND magic_link_token = ?", userID, tokenHash).Updates(map[string]interface{}{
+		"magic_link_token":      nil,
+		"magic_link_expires_at": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the WebAuthn credentials of a user.
+func (r *dbRepository) GetCredentials(ctx context.Context, userID uuid.UUID) (*[]Credential, error) {
+	var credentials []Credential
+
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&credentials)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &credentials, nil
+}
+
+// Creates a single WebAuthn credential in the database.
+func (r *dbRepository) CreateCredential(ctx context.Context, credential *Credential) error {
+	return r.db.WithContext(ctx).Create(credential).Error
+}
+
+// Stores the signature counter and backup state of a WebAuthn credential after it has been used to sign in.
+func (r *dbRepository) UpdateCredentialUsage(ctx context.Context, credentialID uuid.UUID, signCount uint32, backupState bool) error {
+	result := r.db.WithContext(ctx).Model(&Credential{}).Where("id = ?", credentialID).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"backup_state": backupState,
+		"last_used_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Deletes a WebAuthn credential of a user.
+func (r *dbRepository) DeleteCredential(ctx context.Context, userID uuid.UUID, credentialID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", credentialID, userID).Delete(&Credential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets the personal API tokens of a user.
+func (r *dbRepository) GetAPITokens(ctx context.Context, userID uuid.UUID) (*[]APIToken, error) {
+	var tokens []APIToken
+
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &tokens, nil
+}
+
+// Gets the personal API token with the given hash.
+func (r *dbRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error) {
+	token := &APIToken{}
+
+	result := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return token, nil
+}
+
+// Creates a single personal API token in the database.
+func (r *dbRepository) CreateAPIToken(ctx context.Context, token *APIToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// Stores when and from where a personal API token was last used.
+func (r *dbRepository) UpdateAPITokenUsage(ctx context.Context, tokenID uuid.UUID, ipAddress string) error {
+	result := r.db.WithContext(ctx).Model(&APIToken{}).Where("id = ?", tokenID).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"last_used_ip": ipAddress,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Deletes a personal API token of a user.
+func (r *dbRepository) DeleteAPIToken(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", tokenID, userID).Delete(&APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Gets all the invites, the most recent first.
+func (r *dbRepository) GetInvites(ctx context.Context) (*[]Invite, error) {
+	var invites []Invite
+
+	result := r.db.WithContext(ctx).Order("created_at DESC").Find(&invites)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &invites, nil
+}
+
+// Gets the invite whose code has the given hash.
+func (r *dbRepository) GetInviteByCodeHash(ctx context.Context, codeHash string) (*Invite, error) {
+	invite := &Invite{}
+
+	result := r.db.WithContext(ctx).Where("code_hash = ?", codeHash).First(invite)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return invite, nil
+}
+
+// Creates a single invite in the database.
+func (r *dbRepository) CreateInvite(ctx context.Context, invite *Invite) error {
+	return r.db.WithContext(ctx).Create(invite).Error
+}
+
+// Deletes a single invite in the database.
+func (r *dbRepository) DeleteInvite(ctx context.Context, inviteID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&Invite{}, inviteID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Creates a user and marks the invite they registered with as used by them. Returns
+// gorm.ErrRecordNotFound if the invite has already been used.
+func (r *dbRepository) CreateUserWithInvite(ctx context.Context, user *User, inviteID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&Invite{}).Where("id = ? AND used_at IS NULL", inviteID).Updates(map[string]interface{}{
+			"used_by": user.ID,
+			"used_at": time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jramsgz/articpad/internal/utils/testdb"
+	"gorm.io/gorm"
+)
+
+func newTestUserRepository(t *testing.T) (UserRepository, *gorm.DB) {
+	db := testdb.New(t, &User{}, &Identity{}, &RecoveryCode{}, &Credential{}, &APIToken{}, &Invite{})
+	return NewUserRepository(db), db
+}
+
+func createTestUser(t *testing.T, repo UserRepository, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com", Password: "hash", Lang: "en"}
+	if err := repo.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	repo, db := newTestUserRepository(t)
+	service := NewUserService(repo, LockoutPolicy{}, RegistrationPolicy{Mode: RegistrationOpen}, nil)
+	ctx := context.Background()
+
+	deleted := createTestUser(t, repo, "deleted")
+	disabled := createTestUser(t, repo, "disabled")
+	active := createTestUser(t, repo, "active")
+	if err := repo.RequestDeletion(ctx, deleted.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.DisableUser(ctx, disabled.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nothing is purged before the grace period ends.
+	count, err := service.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+	if err != nil || count != 0 {
+		t.Fatalf("expected no users to be purged, got %d (%v)", count, err)
+	}
+
+	count, err = service.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 user to be purged, got %d", count)
+	}
+
+	var remaining int64
+	db.Unscoped().Model(&User{}).Where("id = ?", deleted.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Error("expected the deleted account to be purged")
+	}
+
+	// Accounts disabled by an administrator are kept so they can be restored.
+	if err := service.RestoreUser(ctx, disabled.ID); err != nil {
+		t.Errorf("expected the disabled account to be restorable, got %v", err)
+	}
+	if _, err := repo.GetUser(ctx, active.ID); err != nil {
+		t.Errorf("expected the active account to be kept, got %v", err)
+	}
+}
+
+func TestRestoreUserCancelsDeletion(t *testing.T) {
+	repo, _ := newTestUserRepository(t)
+	service := NewUserService(repo, LockoutPolicy{}, RegistrationPolicy{Mode: RegistrationOpen}, nil)
+	ctx := context.Background()
+
+	user := createTestUser(t, repo, "restored")
+	if err := repo.RequestDeletion(ctx, user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.RestoreUser(ctx, user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored, err := repo.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.DeletionRequestedAt.Valid {
+		t.Error("expected the deletion request to be cleared")
+	}
+
+	// Disabling the user again does not bring the deletion request back.
+	if err := service.DisableUser(ctx, user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	count, err := service.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	if err != nil || count != 0 {
+		t.Errorf("expected no users to be purged, got %d (%v)", count, err)
+	}
+}
@@ -2,26 +2,57 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
 	"errors"
+	"math/big"
 	"net/mail"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/jramsgz/articpad/internal/utils/consts"
-	"github.com/jramsgz/articpad/pkg/argon2id"
+	"github.com/jramsgz/articpad/pkg/hasher"
+	"github.com/jramsgz/articpad/pkg/securetoken"
+	"github.com/jramsgz/articpad/pkg/totp"
 	"github.com/jramsgz/articpad/pkg/validator"
 	"gorm.io/gorm"
 )
 
+const (
+	// Name shown by authenticator apps next to the account.
+	totpIssuer = "ArticPad"
+	// Number of time steps before and after the current one in which a TOTP code is accepted.
+	totpSkew = 1
+	// Number of recovery codes generated when two-factor authentication is enabled.
+	recoveryCodesCount = 10
+	// Number of attempts to find a free username for users created from an external identity.
+	usernameAttempts = 10
+	// Time users have to confirm a new email address.
+	emailChangeTTL = 24 * time.Hour
+	// Name given to WebAuthn credentials added without one.
+	defaultCredentialName = "Passkey"
+	// Minimum time between updates of the last use of a personal API token.
+	apiTokenUsageInterval = time.Minute
+)
+
 // Implementation of the repository in this service.
 type userService struct {
-	userRepository UserRepository
+	userRepository     UserRepository
+	lockoutPolicy      LockoutPolicy
+	registrationPolicy RegistrationPolicy
+	passwordHasher     hasher.Hasher
 }
 
 // Create a new 'service' or 'use-case' for 'User' entity.
-func NewUserService(r UserRepository) UserService {
+func NewUserService(r UserRepository, lockoutPolicy LockoutPolicy, registrationPolicy RegistrationPolicy, passwordHasher hasher.Hasher) UserService {
 	return &userService{
-		userRepository: r,
+		userRepository:     r,
+		lockoutPolicy:      lockoutPolicy,
+		registrationPolicy: registrationPolicy,
+		passwordHasher:     passwordHasher,
 	}
 }
 
@@ -45,42 +76,21 @@ func (s *userService) GetUserByUsername(ctx context.Context, userName string) (*
 	return s.userRepository.GetUserByUsername(ctx, userName)
 }
 
-// Implementation of 'CreateUser'.
+// Implementation of 'CreateUser'. The registration policy is not enforced here, use 'RegisterUser'
+// for users signing up by themselves.
 func (s *userService) CreateUser(ctx context.Context, user *User) error {
-	err := s.validateUser(ctx, user)
+	err := s.checkNewUser(ctx, user)
 	if err != nil {
 		return err
 	}
 
-	foundUser, err := s.GetUserByEmail(ctx, user.Email)
-	if err != nil && err != gorm.ErrRecordNotFound {
-		if err.Error() == consts.ErrDeletedRecord {
-			return errors.New(consts.ErrEmailDeactivated)
-		}
-		return err
-	}
-	if foundUser != nil {
-		return errors.New(consts.ErrEmailAlreadyExists)
-	}
-
-	foundUser, err = s.GetUserByUsername(ctx, user.Username)
-	if err != nil && err != gorm.ErrRecordNotFound {
-		if err.Error() == consts.ErrDeletedRecord {
-			return errors.New(consts.ErrUsernameDeactivated)
-		}
-		return err
-	}
-	if foundUser != nil {
-		return errors.New(consts.ErrUsernameAlreadyExists)
-	}
-
 	isAdmin := false
 	if ok, err := s.IsFirstUser(ctx); ok && err == nil {
 		isAdmin = true
 	}
 	user.IsAdmin = isAdmin
 
-	hashedPassword, err := argon2id.CreateHash(user.Password, argon2id.DefaultParams)
+	hashedPassword, err := s.passwordHasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
@@ -89,18 +99,21 @@ func (s *userService) CreateUser(ctx context.Context, user *User) error {
 	return s.userRepository.CreateUser(ctx, user)
 }
 
-// Implementation of 'UpdateUser'.
+// Implementation of 'UpdateUser'. The password is never updated here, it can only be changed
+// with 'ChangePassword' or 'ResetPassword'.
 func (s *userService) UpdateUser(ctx context.Context, userID uuid.UUID, user *User) error {
-	err := s.validateUser(ctx, user)
-	if err != nil {
-		return err
+	parsedEmail, err := mail.ParseAddress(user.Email)
+	if err != nil || len(parsedEmail.Address) > 100 {
+		return errors.New(consts.ErrInvalidEmail)
 	}
+	user.Email = parsedEmail.Address
 
-	hashedPassword, err := argon2id.CreateHash(user.Password, argon2id.DefaultParams)
-	if err != nil {
+	if err := validator.DefaultUsernameValidator.Validate(user.Username); err != nil {
 		return err
 	}
-	user.Password = hashedPassword
+
+	// Zero values are not updated.
+	user.Password = ""
 
 	return s.userRepository.UpdateUser(ctx, userID, user)
 }
@@ -137,9 +150,25 @@ func (s *userService) GetUserByEmailOrUsername(ctx context.Context, emailOrUsern
 	return user, err
 }
 
+// Implementation of 'CreateVerificationToken'. Returns the token that verifies the email of the
+// user, only its hash is stored and creating a new token invalidates the previous one.
+func (s *userService) CreateVerificationToken(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error) {
+	token, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.userRepository.SetVerificationToken(ctx, userID, securetoken.Hash(token), expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
 // Implementation of 'VerifyUser'.
 func (s *userService) VerifyUser(ctx context.Context, verificationToken string) error {
-	user, err := s.userRepository.GetUserByVerificationToken(ctx, verificationToken)
+	user, err := s.userRepository.GetUserByVerificationToken(ctx, securetoken.Hash(verificationToken))
 	if err != nil {
 		return err
 	}
@@ -148,6 +177,10 @@ func (s *userService) VerifyUser(ctx context.Context, verificationToken string)
 		return errors.New(consts.ErrEmailAlreadyVerified)
 	}
 
+	if !user.VerificationExpiresAt.Valid || user.VerificationExpiresAt.Time.Before(time.Now()) {
+		return errors.New(consts.ErrVerificationTokenExpired)
+	}
+
 	err = s.userRepository.SetUserVerified(ctx, user.ID)
 	if err != nil {
 		return err
@@ -156,37 +189,1076 @@ func (s *userService) VerifyUser(ctx context.Context, verificationToken string)
 	return nil
 }
 
-// Implementation of 'SetPasswordResetToken'.
-func (s *userService) SetPasswordResetToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error {
-	return s.userRepository.SetPasswordResetToken(ctx, userID, token, expiresAt)
+// Implementation of 'CreatePasswordResetToken'. Returns the token that allows resetting the password
+// of the user, only its hash is stored and creating a new token invalidates the previous one.
+func (s *userService) CreatePasswordResetToken(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error) {
+	token, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.userRepository.SetPasswordResetToken(ctx, userID, securetoken.Hash(token), expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
-// Implementation of 'ResetPassword'.
+// Implementation of 'ResetPassword'. The token can only be used once.
 func (s *userService) ResetPassword(ctx context.Context, token string, newPassword string) error {
-	user, err := s.userRepository.GetUserByPasswordResetToken(ctx, token)
+	tokenHash := securetoken.Hash(token)
+	user, err := s.userRepository.GetUserByPasswordResetToken(ctx, tokenHash)
 	if err != nil {
 		return err
 	}
 
-	if user.PasswordResetExpiresAt.Before(time.Now()) {
+	if !user.PasswordResetExpiresAt.Valid || user.PasswordResetExpiresAt.Time.Before(time.Now()) {
 		return errors.New(consts.ErrPasswordResetTokenExpired)
 	}
 
-	user.Password = newPassword
-	user.PasswordResetExpiresAt = time.Now()
+	passwordValidator := validator.DefaultPasswordValidator([]string{user.Username, user.Email})
+	if err := passwordValidator.Validate(newPassword); err != nil {
+		return err
+	}
 
-	err = s.validateUser(ctx, user)
+	err = s.userRepository.UsePasswordResetToken(ctx, user.ID, tokenHash)
 	if err != nil {
 		return err
 	}
 
-	hashedPassword, err := argon2id.CreateHash(user.Password, argon2id.DefaultParams)
+	hashedPassword, err := s.passwordHasher.Hash(newPassword)
 	if err != nil {
 		return err
 	}
-	user.Password = hashedPassword
 
-	return s.userRepository.UpdateUser(ctx, user.ID, user)
+	return s.userRepository.SetPassword(ctx, user.ID, hashedPassword)
+}
+
+// Implementation of 'SetupTwoFactor'. Returns the new secret and its otpauth URI.
+func (s *userService) SetupTwoFactor(ctx context.Context, userID uuid.UUID) (string, string, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TwoFactorEnabled {
+		return "", "", errors.New(consts.ErrTwoFactorAlreadyEnabled)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.userRepository.SetTOTPSecret(ctx, userID, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.KeyURI(totpIssuer, user.Email, secret), nil
+}
+
+// Implementation of 'EnableTwoFactor'. Returns the recovery codes of the user.
+func (s *userService) EnableTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, errors.New(consts.ErrTwoFactorAlreadyEnabled)
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New(consts.ErrTwoFactorNotSetUp)
+	}
+
+	err = s.checkTOTPCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepository.SetTwoFactorEnabled(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Implementation of 'DisableTwoFactor'. Returns true if the account has been locked because of an
+// invalid code.
+func (s *userService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	locked, err := s.CheckTwoFactorCode(ctx, userID, code)
+	if err != nil {
+		return locked, err
+	}
+
+	return false, s.userRepository.SetTwoFactorEnabled(ctx, userID, false)
+}
+
+// Implementation of 'RegenerateRecoveryCodes'. Previous recovery codes stop working. Returns true if
+// the account has been locked because of an invalid code.
+func (s *userService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, bool, error) {
+	locked, err := s.CheckTwoFactorCode(ctx, userID, code)
+	if err != nil {
+		return nil, locked, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	return codes, false, err
+}
+
+// Implementation of 'CheckTwoFactorCode'. Accepts either a TOTP code or an unused recovery code,
+// codes cannot be used more than once. Failed attempts count towards the lockout of the account, as
+// for logins, so codes cannot be guessed.
+// Returns true if the account has been locked because of this attempt.
+func (s *userService) CheckTwoFactorCode(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !user.TwoFactorEnabled {
+		return false, errors.New(consts.ErrTwoFactorNotEnabled)
+	}
+
+	err = s.checkLockout(user)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.checkTwoFactorCode(ctx, user, code)
+	if err != nil {
+		if err.Error() == consts.ErrInvalidTwoFactorCode {
+			if locked, err := s.registerFailedAttempt(ctx, user); err != nil {
+				return locked, err
+			}
+		}
+		return false, err
+	}
+
+	return false, s.userRepository.ResetFailedLogins(ctx, userID)
+}
+
+// Checks a TOTP code or an unused recovery code of a user, the code cannot be used again.
+func (s *userService) checkTwoFactorCode(ctx context.Context, user *User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.checkTOTPCode(ctx, user, code)
+	}
+
+	recoveryCodes, err := s.userRepository.GetRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ToLower(code)
+	for _, recoveryCode := range *recoveryCodes {
+		match, _, err := s.passwordHasher.Verify(code, recoveryCode.CodeHash)
+		if err != nil {
+			return err
+		}
+		if match {
+			return s.userRepository.UseRecoveryCode(ctx, recoveryCode.ID)
+		}
+	}
+
+	return errors.New(consts.ErrInvalidTwoFactorCode)
+}
+
+// Checks a TOTP code against the secret of a user and prevents it from being used again.
+func (s *userService) checkTOTPCode(ctx context.Context, user *User, code string) error {
+	step, ok, err := totp.Validate(strings.TrimSpace(code), user.TOTPSecret, time.Now(), totpSkew)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(consts.ErrInvalidTwoFactorCode)
+	}
+
+	return s.userRepository.UseTOTPStep(ctx, user.ID, step)
+}
+
+// Generates and stores a new set of recovery codes for a user, returning them in plain text.
+func (s *userService) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	recoveryCodes := make([]RecoveryCode, recoveryCodesCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := s.passwordHasher.Hash(code)
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		recoveryCodes[i] = RecoveryCode{CodeHash: hash}
+	}
+
+	err := s.userRepository.ReplaceRecoveryCodes(ctx, userID, recoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Generates a random recovery code in the 'xxxxx-xxxxx' format.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// Implementation of 'GetOrCreateExternalUser'. Gets the user linked to an external identity. If there
+// is none, the identity is linked to the user with the same email, which must have been verified by
+// the identity provider, or a new user is created if allowed. Users who have not verified their email
+// are never linked, as anyone could have created them with a password of their own.
+func (s *userService) GetOrCreateExternalUser(ctx context.Context, identity *Identity, email string, username string, lang string, autoRegister bool) (*User, error) {
+	user, err := s.userRepository.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	} else if err != gorm.ErrRecordNotFound {
+		if err.Error() == consts.ErrDeletedRecord {
+			return nil, errors.New(consts.ErrEmailDeactivated)
+		}
+		return nil, err
+	}
+
+	parsedEmail, err := mail.ParseAddress(email)
+	if err != nil || len(parsedEmail.Address) > 100 {
+		return nil, errors.New(consts.ErrInvalidEmail)
+	}
+	email = parsedEmail.Address
+
+	user, err = s.userRepository.GetUserByEmail(ctx, email)
+	if err == nil {
+		if !user.VerifiedAt.Valid {
+			return nil, errors.New(consts.ErrExternalAccountNotVerified)
+		}
+
+		identity.UserID = user.ID
+		err = s.userRepository.CreateIdentity(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	} else if err != gorm.ErrRecordNotFound {
+		if err.Error() == consts.ErrDeletedRecord {
+			return nil, errors.New(consts.ErrEmailDeactivated)
+		}
+		return nil, err
+	}
+
+	if !autoRegister {
+		return nil, errors.New(consts.ErrExternalAccountNotRegistered)
+	}
+
+	// Invites cannot be redeemed through the identity provider, so only open registration allows
+	// creating accounts from it.
+	isFirstUser, err := s.IsFirstUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isFirstUser {
+		if s.registrationPolicy.Mode != RegistrationOpen {
+			return nil, errors.New(consts.ErrExternalAccountNotRegistered)
+		}
+		err = s.checkEmailDomain(email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	username, err = s.findAvailableUsername(ctx, username, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users created from an external identity have a random password until they reset it.
+	password, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &User{
+		Username:   username,
+		Email:      email,
+		Password:   hashedPassword,
+		VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		Lang:       lang,
+		IsAdmin:    isFirstUser,
+	}
+
+	err = s.userRepository.CreateUserWithIdentity(ctx, user, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Finds a valid username that is not in use, based on the preferred one or the email.
+func (s *userService) findAvailableUsername(ctx context.Context, preferred string, email string) (string, error) {
+	policy := validator.DefaultPolicy
+	base := sanitizeUsername(preferred, policy.UsernameAllowedChars)
+	if len(base) < policy.UsernameMinLength {
+		base = sanitizeUsername(strings.Split(email, "@")[0], policy.UsernameAllowedChars)
+	}
+	if len(base) < policy.UsernameMinLength {
+		base = "user"
+	}
+	// Leave room for a numeric suffix.
+	if maxLength := policy.UsernameMaxLength - 5; maxLength > 0 && len(base) > maxLength {
+		base = base[:maxLength]
+	}
+
+	candidate := base
+	for i := 0; i < usernameAttempts; i++ {
+		// Candidates not allowed by the policy, such as reserved usernames, get a suffix too.
+		if validator.DefaultUsernameValidator.Validate(candidate) == nil {
+			_, err := s.userRepository.GetUserByUsername(ctx, candidate)
+			if err == gorm.ErrRecordNotFound {
+				return candidate, nil
+			} else if err != nil && err.Error() != consts.ErrDeletedRecord {
+				return "", err
+			}
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(100000))
+		if err != nil {
+			return "", err
+		}
+		candidate = base + suffix.String()
+	}
+
+	return "", errors.New(consts.ErrUsernameAlreadyExists)
+}
+
+// Removes the characters not allowed in usernames.
+func sanitizeUsername(username string, allowedChars string) string {
+	var b strings.Builder
+	for _, r := range username {
+		if strings.ContainsRune(allowedChars, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Implementation of 'CheckPassword'. Checks the password of a user, rejecting the attempt without
+// checking it if their account is locked or they have to wait after their last failed attempt.
+// On success, the password is rehashed if its hash uses an outdated algorithm or parameters. The failed
+// attempts of users with two-factor authentication are only reset once their code is checked, otherwise
+// logging in again would allow guessing codes without limit.
+// Returns true if the account has been locked because of this attempt.
+func (s *userService) CheckPassword(ctx context.Context, user *User, password string) (bool, error) {
+	err := s.checkLockout(user)
+	if err != nil {
+		return false, err
+	}
+
+	match, needsRehash, err := s.passwordHasher.Verify(password, user.Password)
+	if err != nil {
+		return false, err
+	}
+
+	if match {
+		if needsRehash {
+			// A failed rehash is retried on the next login, so it does not prevent the user from logging in.
+			if hashedPassword, err := s.passwordHasher.Hash(password); err == nil {
+				_ = s.userRepository.SetPassword(ctx, user.ID, hashedPassword)
+			}
+		}
+		if user.TwoFactorEnabled {
+			return false, nil
+		}
+		return false, s.userRepository.ResetFailedLogins(ctx, user.ID)
+	}
+
+	locked, err := s.registerFailedAttempt(ctx, user)
+	if err != nil {
+		return locked, err
+	}
+
+	return false, errors.New(consts.ErrInvalidCredentials)
+}
+
+// Implementation of 'ResetFailedLogins'. Used when users complete their login with a second factor other
+// than a code, as their failed attempts are not reset when they enter their password.
+func (s *userService) ResetFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	return s.userRepository.ResetFailedLogins(ctx, userID)
+}
+
+// Implementation of 'GetUsersPage'.
+func (s *userService) GetUsersPage(ctx context.Context, opts *ListOptions) (*[]User, int64, error) {
+	return s.userRepository.GetUsersPage(ctx, opts)
+}
+
+// Implementation of 'GetUserUnscoped'.
+func (s *userService) GetUserUnscoped(ctx context.Context, userID uuid.UUID) (*User, error) {
+	return s.userRepository.GetUserUnscoped(ctx, userID)
+}
+
+// Implementation of 'SetAdmin'.
+func (s *userService) SetAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool) error {
+	return s.userRepository.SetAdmin(ctx, userID, isAdmin)
+}
+
+// Implementation of 'ForceVerifyUser'. Verifies the email of a user without their verification token.
+func (s *userService) ForceVerifyUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.VerifiedAt.Valid {
+		return errors.New(consts.ErrEmailAlreadyVerified)
+	}
+
+	return s.userRepository.SetUserVerified(ctx, userID)
+}
+
+// Implementation of 'DisableUser'. Disabled users are soft-deleted, so they can be restored later.
+func (s *userService) DisableUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepository.DeleteUser(ctx, userID)
+}
+
+// Implementation of 'RestoreUser'.
+func (s *userService) RestoreUser(ctx context.Context, userID uuid.UUID) error {
+	err := s.userRepository.RestoreUser(ctx, userID)
+	if err == gorm.ErrRecordNotFound {
+		if _, err := s.userRepository.GetUser(ctx, userID); err == nil {
+			return errors.New(consts.ErrUserNotDisabled)
+		}
+	}
+
+	return err
+}
+
+// Implementation of 'HardDeleteUser'.
+func (s *userService) HardDeleteUser(ctx context.Context, userID uuid.UUID) error {
+	return s.userRepository.HardDeleteUser(ctx, userID)
+}
+
+// Implementation of 'UpdateProfile'.
+func (s *userService) UpdateProfile(ctx context.Context, userID uuid.UUID, username string, lang string) (*User, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if username != user.Username {
+		if err := validator.DefaultUsernameValidator.Validate(username); err != nil {
+			return nil, err
+		}
+
+		err = s.checkUsernameAvailable(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.userRepository.UpdateProfile(ctx, userID, username, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Username = username
+	user.Lang = lang
+	return user, nil
+}
+
+// Implementation of 'ChangePassword'. The current password of the user is required. Returns true if
+// the account has been locked because of an incorrect password.
+func (s *userService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword string, newPassword string) (bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := s.checkCurrentPassword(ctx, user, currentPassword)
+	if err != nil {
+		return locked, err
+	}
+
+	passwordValidator := validator.DefaultPasswordValidator([]string{user.Username, user.Email})
+	if err := passwordValidator.Validate(newPassword); err != nil {
+		return false, err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return false, err
+	}
+
+	return false, s.userRepository.SetPassword(ctx, userID, hashedPassword)
+}
+
+// Implementation of 'RequestEmailChange'. The new email is not used until it is confirmed with the
+// returned token, which is only stored hashed. Returns true if the account has been locked because of an
+// incorrect password.
+func (s *userService) RequestEmailChange(ctx context.Context, userID uuid.UUID, password string, email string) (*User, string, bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	locked, err := s.checkCurrentPassword(ctx, user, password)
+	if err != nil {
+		return nil, "", locked, err
+	}
+
+	parsedEmail, err := mail.ParseAddress(email)
+	if err != nil || len(parsedEmail.Address) > 100 {
+		return nil, "", false, errors.New(consts.ErrInvalidEmail)
+	}
+	email = parsedEmail.Address
+
+	err = s.checkEmailDomain(email)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	err = s.checkEmailAvailable(ctx, email)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	token, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return nil, "", false, err
+	}
+	expiresAt := time.Now().Add(emailChangeTTL)
+
+	err = s.userRepository.SetEmailChange(ctx, userID, email, securetoken.Hash(token), expiresAt)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	user.PendingEmail = email
+	return user, token, false, nil
+}
+
+// Implementation of 'ConfirmEmailChange'.
+func (s *userService) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	user, err := s.userRepository.GetUserByEmailChangeToken(ctx, securetoken.Hash(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.EmailChangeExpiresAt.Valid || user.EmailChangeExpiresAt.Time.Before(time.Now()) {
+		return nil, errors.New(consts.ErrEmailChangeTokenExpired)
+	}
+
+	// The email may have been taken since the change was requested.
+	err = s.checkEmailAvailable(ctx, user.PendingEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepository.ChangeEmail(ctx, user.ID, user.PendingEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	return user, nil
+}
+
+// Implementation of 'GetIdentities'.
+func (s *userService) GetIdentities(ctx context.Context, userID uuid.UUID) (*[]Identity, error) {
+	return s.userRepository.GetIdentities(ctx, userID)
+}
+
+// Implementation of 'DeleteAccount'. The account is disabled right away and permanently deleted
+// along with all its data once the grace period ends, see 'PurgeDeletedUsers'. Returns true if the
+// account has been locked because of an incorrect password.
+func (s *userService) DeleteAccount(ctx context.Context, userID uuid.UUID, password string) (bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := s.checkCurrentPassword(ctx, user, password)
+	if err != nil {
+		return locked, err
+	}
+
+	return false, s.userRepository.RequestDeletion(ctx, userID)
+}
+
+// Implementation of 'PurgeDeletedUsers'. Permanently deletes the users who deleted their account
+// before the given time, freeing their usernames and emails. Users disabled by an administrator are
+// kept so they can be restored. Returns the number of users deleted.
+func (s *userService) PurgeDeletedUsers(ctx context.Context, requestedBefore time.Time) (int, error) {
+	userIDs, err := s.userRepository.GetUsersDeletionRequestedBefore(ctx, requestedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, userID := range userIDs {
+		err := s.userRepository.HardDeleteUser(ctx, userID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return i, err
+		}
+	}
+
+	return len(userIDs), nil
+}
+
+// Implementation of 'CreateMagicLink'. Returns the token of the link, only its hash is stored and
+// creating a new link invalidates the previous one.
+func (s *userService) CreateMagicLink(ctx context.Context, userID uuid.UUID, expiresAt time.Time) (string, error) {
+	token, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.userRepository.SetMagicLinkToken(ctx, userID, securetoken.Hash(token), expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Implementation of 'UseMagicLink'. The link can only be used once, even if it has expired. As it
+// proves access to the email of the user, their email is verified if it was not.
+func (s *userService) UseMagicLink(ctx context.Context, token string) (*User, error) {
+	tokenHash := securetoken.Hash(token)
+	user, err := s.userRepository.GetUserByMagicLinkToken(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepository.UseMagicLinkToken(ctx, user.ID, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MagicLinkExpiresAt.Valid || user.MagicLinkExpiresAt.Time.Before(time.Now()) {
+		return nil, errors.New(consts.ErrMagicLinkExpired)
+	}
+
+	if !user.VerifiedAt.Valid {
+		err = s.userRepository.SetUserVerified(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		user.VerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	return user, nil
+}
+
+// Implementation of 'GetCredentials'.
+func (s *userService) GetCredentials(ctx context.Context, userID uuid.UUID) (*[]Credential, error) {
+	return s.userRepository.GetCredentials(ctx, userID)
+}
+
+// Implementation of 'AddCredential'. As a credential can be used to sign in, the current password
+// of the user is required to add one. Returns true if the account has been locked because of an
+// incorrect password.
+func (s *userService) AddCredential(ctx context.Context, userID uuid.UUID, password string, credential *Credential) (bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := s.checkCurrentPassword(ctx, user, password)
+	if err != nil {
+		return locked, err
+	}
+
+	credential.Name = strings.TrimSpace(credential.Name)
+	if credential.Name == "" {
+		credential.Name = defaultCredentialName
+	} else if utf8.RuneCountInString(credential.Name) > 64 {
+		return false, errors.New(consts.ErrCredentialNameTooLong)
+	}
+	credential.UserID = userID
+
+	return false, s.userRepository.CreateCredential(ctx, credential)
+}
+
+// Implementation of 'UpdateCredentialUsage'.
+func (s *userService) UpdateCredentialUsage(ctx context.Context, credentialID uuid.UUID, signCount uint32, backupState bool) error {
+	return s.userRepository.UpdateCredentialUsage(ctx, credentialID, signCount, backupState)
+}
+
+// Implementation of 'DeleteCredential'. The current password of the user is required, as the
+// credential may be their second factor. Returns true if the account has been locked because of an
+// incorrect password.
+func (s *userService) DeleteCredential(ctx context.Context, userID uuid.UUID, password string, credentialID uuid.UUID) (bool, error) {
+	user, err := s.userRepository.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := s.checkCurrentPassword(ctx, user, password)
+	if err != nil {
+		return locked, err
+	}
+
+	return false, s.userRepository.DeleteCredential(ctx, userID, credentialID)
+}
+
+// Implementation of 'GetAPITokens'.
+func (s *userService) GetAPITokens(ctx context.Context, userID uuid.UUID) (*[]APIToken, error) {
+	return s.userRepository.GetAPITokens(ctx, userID)
+}
+
+// Implementation of 'CreateAPIToken'. Returns the token, which is only stored hashed so it
+// cannot be shown again. Tokens without an expiration time are valid until deleted.
+func (s *userService) CreateAPIToken(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return nil, "", errors.New(consts.ErrAPITokenNameLength)
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.New(consts.ErrInvalidAPITokenScope)
+	}
+	for _, scope := range scopes {
+		if scope != APITokenScopeRead && scope != APITokenScopeWrite && scope != APITokenScopeAdmin {
+			return nil, "", errors.New(consts.ErrInvalidAPITokenScope)
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New(consts.ErrInvalidAPITokenExpiration)
+	}
+
+	token, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return nil, "", err
+	}
+	token = APITokenPrefix + token
+
+	apiToken := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: securetoken.Hash(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	err = s.userRepository.CreateAPIToken(ctx, apiToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiToken, token, nil
+}
+
+// Implementation of 'DeleteAPIToken'.
+func (s *userService) DeleteAPIToken(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error {
+	return s.userRepository.DeleteAPIToken(ctx, userID, tokenID)
+}
+
+// Implementation of 'AuthenticateAPIToken'. Returns the owner of the token if it is valid and
+// their account is active, keeping track of the last use of the token.
+func (s *userService) AuthenticateAPIToken(ctx context.Context, token string, ipAddress string) (*User, *APIToken, error) {
+	apiToken, err := s.userRepository.GetAPITokenByHash(ctx, securetoken.Hash(token))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New(consts.ErrAPITokenExpired)
+	}
+
+	user, err := s.userRepository.GetUser(ctx, apiToken.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The last use is only updated from time to time, so every request does not cause a write.
+	if apiToken.LastUsedAt == nil || time.Since(*apiToken.LastUsedAt) > apiTokenUsageInterval || apiToken.LastUsedIP != ipAddress {
+		err = s.userRepository.UpdateAPITokenUsage(ctx, apiToken.ID, ipAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return user, apiToken, nil
+}
+
+// Implementation of 'GetRegistrationPolicy'.
+func (s *userService) GetRegistrationPolicy() *RegistrationPolicy {
+	return &s.registrationPolicy
+}
+
+// Implementation of 'RegisterUser'. The first user can always register, as they become the
+// administrator. Otherwise, the registration policy is enforced and, if registration is
+// invite-only, the invite is used up when the user is created.
+func (s *userService) RegisterUser(ctx context.Context, user *User, inviteCode string) error {
+	isFirstUser, err := s.IsFirstUser(ctx)
+	if err != nil {
+		return err
+	}
+	if isFirstUser {
+		return s.CreateUser(ctx, user)
+	}
+
+	inviteCode = strings.TrimSpace(inviteCode)
+	switch s.registrationPolicy.Mode {
+	case RegistrationOpen:
+	case RegistrationInvite:
+		if inviteCode == "" {
+			return errors.New(consts.ErrInviteRequired)
+		}
+	default:
+		return errors.New(consts.ErrRegistrationClosed)
+	}
+
+	err = s.checkNewUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkEmailDomain(user.Email)
+	if err != nil {
+		return err
+	}
+
+	var invite *Invite
+	if s.registrationPolicy.Mode == RegistrationInvite {
+		invite, err = s.userRepository.GetInviteByCodeHash(ctx, securetoken.Hash(inviteCode))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.New(consts.ErrInvalidInvite)
+			}
+			return err
+		}
+		if invite.UsedAt != nil {
+			return errors.New(consts.ErrInvalidInvite)
+		}
+		if invite.ExpiresAt != nil && invite.ExpiresAt.Before(time.Now()) {
+			return errors.New(consts.ErrInviteExpired)
+		}
+		if invite.Email != "" && !strings.EqualFold(invite.Email, user.Email) {
+			return errors.New(consts.ErrInviteEmailMismatch)
+		}
+	}
+
+	user.IsAdmin = false
+	hashedPassword, err := s.passwordHasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	if invite == nil {
+		return s.userRepository.CreateUser(ctx, user)
+	}
+
+	// The invite may have been used by someone else in the meantime.
+	err = s.userRepository.CreateUserWithInvite(ctx, user, invite.ID)
+	if err == gorm.ErrRecordNotFound {
+		return errors.New(consts.ErrInvalidInvite)
+	}
+	return err
+}
+
+// Implementation of 'GetInvites'.
+func (s *userService) GetInvites(ctx context.Context) (*[]Invite, error) {
+	return s.userRepository.GetInvites(ctx)
+}
+
+// Implementation of 'CreateInvite'. Returns the invite code, which is only stored hashed so it
+// cannot be shown again. Invites without an email can be used by anyone with the code and
+// invites without an expiration time are valid until used or deleted.
+func (s *userService) CreateInvite(ctx context.Context, createdBy uuid.UUID, email string, expiresAt *time.Time) (*Invite, string, error) {
+	email = strings.TrimSpace(email)
+	if email != "" {
+		parsedEmail, err := mail.ParseAddress(email)
+		if err != nil || len(parsedEmail.Address) > 100 {
+			return nil, "", errors.New(consts.ErrInvalidEmail)
+		}
+		email = parsedEmail.Address
+
+		err = s.checkEmailDomain(email)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New(consts.ErrInvalidInviteExpiration)
+	}
+
+	code, err := securetoken.Generate(securetoken.DefaultLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := &Invite{
+		CodeHash:  securetoken.Hash(code),
+		Email:     email,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+	}
+	err = s.userRepository.CreateInvite(ctx, invite)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return invite, code, nil
+}
+
+// Implementation of 'DeleteInvite'.
+func (s *userService) DeleteInvite(ctx context.Context, inviteID uuid.UUID) error {
+	return s.userRepository.DeleteInvite(ctx, inviteID)
+}
+
+// Checks the password given by a user to confirm a sensitive change to their account. Failed attempts
+// count towards the lockout of the account, as for logins. Returns true if the account has been locked
+// because of this attempt.
+func (s *userService) checkCurrentPassword(ctx context.Context, user *User, password string) (bool, error) {
+	err := s.checkLockout(user)
+	if err != nil {
+		return false, err
+	}
+
+	match, _, err := s.passwordHasher.Verify(password, user.Password)
+	if err != nil {
+		return false, err
+	}
+	if !match {
+		locked, err := s.registerFailedAttempt(ctx, user)
+		if err != nil {
+			return locked, err
+		}
+		return false, errors.New(consts.ErrIncorrectPassword)
+	}
+
+	return false, s.userRepository.ResetFailedLogins(ctx, user.ID)
+}
+
+// Returns an error if the account of a user is locked or they have to wait after their last failed attempt.
+func (s *userService) checkLockout(user *User) error {
+	now := time.Now()
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(now) {
+		return errors.New(consts.ErrAccountLocked)
+	}
+	if user.FailedLoginAttempts > 0 && user.LastFailedLoginAt.Valid &&
+		user.LastFailedLoginAt.Time.Add(s.loginDelay(user.FailedLoginAttempts)).After(now) {
+		return errors.New(consts.ErrLoginThrottled)
+	}
+
+	return nil
+}
+
+// Registers a failed attempt of a user, locking their account after too many of them. Returns true
+// along with an error if the account has been locked because of this attempt.
+func (s *userService) registerFailedAttempt(ctx context.Context, user *User) (bool, error) {
+	locked, err := s.userRepository.RegisterFailedLogin(ctx, user.ID, s.lockoutPolicy.MaxAttempts, time.Now().Add(s.lockoutPolicy.LockoutDuration))
+	if err != nil {
+		return false, err
+	}
+	if locked {
+		return true, errors.New(consts.ErrAccountLocked)
+	}
+
+	return false, nil
+}
+
+// Returns an error if the email is used by another user, even if they have been disabled.
+func (s *userService) checkEmailAvailable(ctx context.Context, email string) error {
+	_, err := s.userRepository.GetUserByEmail(ctx, email)
+	if err == nil {
+		return errors.New(consts.ErrEmailAlreadyExists)
+	} else if err != gorm.ErrRecordNotFound {
+		if err.Error() == consts.ErrDeletedRecord {
+			return errors.New(consts.ErrEmailDeactivated)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Returns an error if the username is used by another user, even if they have been disabled.
+func (s *userService) checkUsernameAvailable(ctx context.Context, username string) error {
+	_, err := s.userRepository.GetUserByUsername(ctx, username)
+	if err == nil {
+		return errors.New(consts.ErrUsernameAlreadyExists)
+	} else if err != gorm.ErrRecordNotFound {
+		if err.Error() == consts.ErrDeletedRecord {
+			return errors.New(consts.ErrUsernameDeactivated)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Returns an error if the registration policy restricts email domains and the email is not from
+// one of them. Domains are matched ignoring case, subdomains must be allowed explicitly.
+func (s *userService) checkEmailDomain(email string) error {
+	if len(s.registrationPolicy.AllowedEmailDomains) == 0 {
+		return nil
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowedDomain := range s.registrationPolicy.AllowedEmailDomains {
+		if strings.EqualFold(domain, allowedDomain) {
+			return nil
+		}
+	}
+
+	return errors.New(consts.ErrEmailDomainNotAllowed)
+}
+
+// Validates the data of a new user and checks their email and username are not in use.
+func (s *userService) checkNewUser(ctx context.Context, user *User) error {
+	err := s.validateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkEmailAvailable(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	return s.checkUsernameAvailable(ctx, user.Username)
+}
+
+// Returns the time users have to wait after a number of consecutive failed logins.
+func (s *userService) loginDelay(failedAttempts int) time.Duration {
+	delay := s.lockoutPolicy.BaseDelay
+	for i := 1; i < failedAttempts && delay < s.lockoutPolicy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if s.lockoutPolicy.MaxDelay > 0 && delay > s.lockoutPolicy.MaxDelay {
+		delay = s.lockoutPolicy.MaxDelay
+	}
+
+	return delay
 }
 
 // Validates the user data and returns an error if it is not valid.
@@ -0,0 +1,625 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jramsgz/articpad/internal/utils/consts"
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"github.com/jramsgz/articpad/pkg/hasher"
+	"github.com/jramsgz/articpad/pkg/totp"
+	"gorm.io/gorm"
+)
+
+// fakeUserRepository keeps users and their identities in memory. Methods not needed by the tests
+// are left to the embedded interface, calling them panics.
+type fakeUserRepository struct {
+	UserRepository
+	users      map[uuid.UUID]User
+	identities map[uuid.UUID]Identity
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{
+		users:      map[uuid.UUID]User{},
+		identities: map[uuid.UUID]Identity{},
+	}
+}
+
+func (r *fakeUserRepository) addUser(username string, email string, verified bool) uuid.UUID {
+	user := User{ID: uuid.New(), Username: username, Email: email}
+	if verified {
+		user.VerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	r.users[user.ID] = user
+	return user.ID
+}
+
+func (r *fakeUserRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			user := r.users[identity.UserID]
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	identity.ID = uuid.New()
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+func newTestUserService(repo UserRepository) UserService {
+	return NewUserService(repo, LockoutPolicy{}, RegistrationPolicy{Mode: RegistrationOpen}, nil)
+}
+
+func TestGetOrCreateExternalUserRefusesUnverifiedAccount(t *testing.T) {
+	repo := newFakeUserRepository()
+	service := newTestUserService(repo)
+	repo.addUser("victim", "victim@example.com", false)
+
+	// Anyone could have registered the account with a password of their own before the owner of the
+	// email address signs in with their identity provider.
+	identity := &Identity{Issuer: "https://idp.example.com", Subject: "victim"}
+	_, err := service.GetOrCreateExternalUser(context.Background(), identity, "victim@example.com", "victim", "en", true)
+	if err == nil || err.Error() != consts.ErrExternalAccountNotVerified {
+		t.Fatalf("expected %q, got %v", consts.ErrExternalAccountNotVerified, err)
+	}
+	if len(repo.identities) != 0 {
+		t.Error("expected the identity not to be linked")
+	}
+}
+
+func TestGetOrCreateExternalUserLinksVerifiedAccount(t *testing.T) {
+	repo := newFakeUserRepository()
+	service := newTestUserService(repo)
+	userID := repo.addUser("owner", "owner@example.com", true)
+
+	identity := &Identity{Issuer: "https://idp.example.com", Subject: "owner"}
+	user, err := service.GetOrCreateExternalUser(context.Background(), identity, "Owner@Example.com", "owner", "en", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != userID || identity.UserID != userID {
+		t.Errorf("expected the identity to be linked to %s, got %s", userID, identity.UserID)
+	}
+
+	// The linked identity signs in without looking up the email address again.
+	user, err = service.GetOrCreateExternalUser(context.Background(), &Identity{Issuer: identity.Issuer, Subject: identity.Subject}, "other@example.com", "owner", "en", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != userID {
+		t.Errorf("expected user %s, got %s", userID, user.ID)
+	}
+}
+
+// newLockoutTestService creates a service backed by a database, locking accounts after three failed
+// attempts, and a user with the given password.
+// newTestPasswordHasher hashes passwords with cheap parameters, to keep the tests fast.
+func newTestPasswordHasher() *hasher.Chain {
+	return hasher.New(&hasher.Argon2id{Params: &argon2id.Params{
+		Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}})
+}
+
+func newLockoutTestService(t *testing.T, password string) (UserService, UserRepository, *User) {
+	repo, _ := newTestUserRepository(t)
+	passwordHasher := newTestPasswordHasher()
+	service := NewUserService(repo, LockoutPolicy{MaxAttempts: 3, LockoutDuration: time.Hour}, RegistrationPolicy{Mode: RegistrationOpen}, passwordHasher)
+
+	user := createTestUser(t, repo, "locked")
+	hashedPassword, err := passwordHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("failed to hash the password: %v", err)
+	}
+	if err := repo.SetPassword(context.Background(), user.ID, hashedPassword); err != nil {
+		t.Fatalf("failed to set the password: %v", err)
+	}
+
+	return service, repo, user
+}
+
+func getTestUser(t *testing.T, repo UserRepository, userID uuid.UUID) *User {
+	user, err := repo.GetUser(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	return user
+}
+
+func TestCheckPasswordLocksAccount(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		locked, err := service.CheckPassword(ctx, getTestUser(t, repo, user.ID), "wrong password")
+		if i < 3 && (locked || err == nil || err.Error() != consts.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected %q without locking, got %t, %v", i, consts.ErrInvalidCredentials, locked, err)
+		}
+		if i == 3 && (!locked || err == nil || err.Error() != consts.ErrAccountLocked) {
+			t.Fatalf("attempt %d: expected the account to be locked, got %t, %v", i, locked, err)
+		}
+	}
+
+	// Only the attempt reaching the limit reports the lock, so a single notification is sent.
+	locked, err := service.CheckPassword(ctx, getTestUser(t, repo, user.ID), "correct password")
+	if locked || err == nil || err.Error() != consts.ErrAccountLocked {
+		t.Errorf("expected the locked account to be rejected, got %t, %v", locked, err)
+	}
+}
+
+func TestCheckCurrentPasswordLocksAccount(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		locked, err := service.ChangePassword(ctx, user.ID, "wrong password", "An0ther$ecretPass")
+		if locked || err == nil || err.Error() != consts.ErrIncorrectPassword {
+			t.Fatalf("attempt %d: expected %q without locking, got %t, %v", i, consts.ErrIncorrectPassword, locked, err)
+		}
+	}
+	locked, err := service.DeleteAccount(ctx, user.ID, "wrong password")
+	if !locked || err == nil || err.Error() != consts.ErrAccountLocked {
+		t.Fatalf("expected the account to be locked, got %t, %v", locked, err)
+	}
+
+	if !getTestUser(t, repo, user.ID).LockedUntil.Valid {
+		t.Error("expected the lockout to be stored")
+	}
+}
+
+func TestCheckTwoFactorCodeLocksAccount(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+	if err := repo.SetTwoFactorEnabled(ctx, user.ID, true); err != nil {
+		t.Fatalf("failed to enable two-factor authentication: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		locked, err := service.CheckTwoFactorCode(ctx, user.ID, "not-a-recovery-code")
+		if locked || err == nil || err.Error() != consts.ErrInvalidTwoFactorCode {
+			t.Fatalf("attempt %d: expected %q without locking, got %t, %v", i, consts.ErrInvalidTwoFactorCode, locked, err)
+		}
+	}
+	_, locked, err := service.RegenerateRecoveryCodes(ctx, user.ID, "not-a-recovery-code")
+	if !locked || err == nil || err.Error() != consts.ErrAccountLocked {
+		t.Fatalf("expected the account to be locked, got %t, %v", locked, err)
+	}
+
+	locked, err = service.DisableTwoFactor(ctx, user.ID, "not-a-recovery-code")
+	if locked || err == nil || err.Error() != consts.ErrAccountLocked {
+		t.Errorf("expected the locked account to be rejected, got %t, %v", locked, err)
+	}
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	service, _, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	secret, _, err := service.SetupTwoFactor(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recoveryCodes, err := service.EnableTwoFactor(ctx, user.ID, code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recoveryCodes) == 0 {
+		t.Fatal("expected recovery codes")
+	}
+
+	if _, _, err := service.SetupTwoFactor(ctx, user.ID); err == nil || err.Error() != consts.ErrTwoFactorAlreadyEnabled {
+		t.Errorf("expected %q, got %v", consts.ErrTwoFactorAlreadyEnabled, err)
+	}
+
+	// Codes cannot be used more than once, so an intercepted code cannot be replayed.
+	if _, err := service.CheckTwoFactorCode(ctx, user.ID, code); err == nil || err.Error() != consts.ErrInvalidTwoFactorCode {
+		t.Errorf("expected the TOTP code to be rejected once used, got %v", err)
+	}
+	if _, err := service.CheckTwoFactorCode(ctx, user.ID, strings.ToUpper(recoveryCodes[0])); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.CheckTwoFactorCode(ctx, user.ID, recoveryCodes[0]); err == nil || err.Error() != consts.ErrInvalidTwoFactorCode {
+		t.Errorf("expected the recovery code to be rejected once used, got %v", err)
+	}
+
+	// Regenerated codes replace the previous ones.
+	newRecoveryCodes, _, err := service.RegenerateRecoveryCodes(ctx, user.ID, recoveryCodes[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.CheckTwoFactorCode(ctx, user.ID, recoveryCodes[2]); err == nil || err.Error() != consts.ErrInvalidTwoFactorCode {
+		t.Errorf("expected the previous recovery codes to be rejected, got %v", err)
+	}
+	if _, err := service.DisableTwoFactor(ctx, user.ID, newRecoveryCodes[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.CheckTwoFactorCode(ctx, user.ID, newRecoveryCodes[1]); err == nil || err.Error() != consts.ErrTwoFactorNotEnabled {
+		t.Errorf("expected %q, got %v", consts.ErrTwoFactorNotEnabled, err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	if _, _, _, err := service.RequestEmailChange(ctx, user.ID, "wrong password", "new@example.com"); err == nil || err.Error() != consts.ErrIncorrectPassword {
+		t.Errorf("expected %q, got %v", consts.ErrIncorrectPassword, err)
+	}
+
+	pending, token, _, err := service.RequestEmailChange(ctx, user.ID, "correct password", "new@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending.PendingEmail != "new@example.com" || getTestUser(t, repo, user.ID).Email != user.Email {
+		t.Errorf("expected the email to stay unchanged until it is confirmed")
+	}
+
+	changed, err := service.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed.Email != "new@example.com" || getTestUser(t, repo, user.ID).Email != "new@example.com" {
+		t.Errorf("expected the email to be changed, got %s", changed.Email)
+	}
+
+	// Tokens can only be used once.
+	if _, err := service.ConfirmEmailChange(ctx, token); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestChangeEmailTakenBeforeConfirmation(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	_, token, _, err := service.RequestEmailChange(ctx, user.ID, "correct password", "taken@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	createTestUser(t, repo, "taken")
+
+	if _, err := service.ConfirmEmailChange(ctx, token); err == nil || err.Error() != consts.ErrEmailAlreadyExists {
+		t.Errorf("expected %q, got %v", consts.ErrEmailAlreadyExists, err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	if _, err := service.ChangePassword(ctx, user.ID, "correct password", "An0ther$ecretPass"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := service.CheckPassword(ctx, getTestUser(t, repo, user.ID), "correct password"); err == nil || err.Error() != consts.ErrInvalidCredentials {
+		t.Errorf("expected the previous password to be rejected, got %v", err)
+	}
+	if _, err := service.CheckPassword(ctx, getTestUser(t, repo, user.ID), "An0ther$ecretPass"); err != nil {
+		t.Errorf("expected the new password to be accepted, got %v", err)
+	}
+}
+
+func TestCreateAPIToken(t *testing.T) {
+	service, _, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	invalid := []struct {
+		name      string
+		scopes    []string
+		expiresAt *time.Time
+		err       string
+	}{
+		{" ", []string{APITokenScopeRead}, nil, consts.ErrAPITokenNameLength},
+		{strings.Repeat("a", 65), []string{APITokenScopeRead}, nil, consts.ErrAPITokenNameLength},
+		{"token", nil, nil, consts.ErrInvalidAPITokenScope},
+		{"token", []string{APITokenScopeRead, "delete"}, nil, consts.ErrInvalidAPITokenScope},
+		{"token", []string{APITokenScopeRead}, &past, consts.ErrInvalidAPITokenExpiration},
+	}
+	for _, tt := range invalid {
+		if _, _, err := service.CreateAPIToken(ctx, user.ID, tt.name, tt.scopes, tt.expiresAt); err == nil || err.Error() != tt.err {
+			t.Errorf("%q with scopes %v: expected %q, got %v", tt.name, tt.scopes, tt.err, err)
+		}
+	}
+
+	apiToken, token, err := service.CreateAPIToken(ctx, user.ID, "token", []string{APITokenScopeRead}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, APITokenPrefix) || apiToken.TokenHash == token {
+		t.Errorf("expected a prefixed token stored hashed, got %s", token)
+	}
+
+	owner, authenticated, err := service.AuthenticateAPIToken(ctx, token, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owner.ID != user.ID || authenticated.ID != apiToken.ID || !authenticated.HasScope(APITokenScopeRead) {
+		t.Errorf("expected the token of %s, got the token %s of %s", user.ID, authenticated.ID, owner.ID)
+	}
+
+	if _, _, err := service.AuthenticateAPIToken(ctx, token+"a", "127.0.0.1"); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestAuthenticateExpiredAPIToken(t *testing.T) {
+	service, _, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Second)
+	_, token, err := service.CreateAPIToken(ctx, user.ID, "token", []string{APITokenScopeRead}, &expiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(time.Until(expiresAt))
+
+	if _, _, err := service.AuthenticateAPIToken(ctx, token, "127.0.0.1"); err == nil || err.Error() != consts.ErrAPITokenExpired {
+		t.Errorf("expected %q, got %v", consts.ErrAPITokenExpired, err)
+	}
+}
+
+// newRegistrationTestService creates an administrator, so that registrations are not the first one.
+func newRegistrationTestService(t *testing.T, policy RegistrationPolicy) (UserService, UserRepository) {
+	repo, _ := newTestUserRepository(t)
+	passwordHasher := newTestPasswordHasher()
+	createTestUser(t, repo, "administrator")
+	return NewUserService(repo, LockoutPolicy{}, policy, passwordHasher), repo
+}
+
+func newRegisteredUser(username string, email string) *User {
+	return &User{Username: username, Email: email, Password: "An0ther$ecretPass", Lang: "en"}
+}
+
+func TestRegisterUserModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		err  string
+	}{
+		{RegistrationOpen, ""},
+		{RegistrationClosed, consts.ErrRegistrationClosed},
+		{"unknown", consts.ErrRegistrationClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			service, _ := newRegistrationTestService(t, RegistrationPolicy{Mode: tt.mode})
+			err := service.RegisterUser(context.Background(), newRegisteredUser("alice", "alice@example.com"), "")
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Errorf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRegisterFirstUserWhenClosed(t *testing.T) {
+	repo, _ := newTestUserRepository(t)
+	passwordHasher := newTestPasswordHasher()
+	service := NewUserService(repo, LockoutPolicy{}, RegistrationPolicy{Mode: RegistrationClosed}, passwordHasher)
+
+	if err := service.RegisterUser(context.Background(), newRegisteredUser("alice", "alice@example.com"), ""); err != nil {
+		t.Errorf("expected the first user to register, got %v", err)
+	}
+}
+
+func TestRegisterUserAllowedEmailDomains(t *testing.T) {
+	service, _ := newRegistrationTestService(t, RegistrationPolicy{Mode: RegistrationOpen, AllowedEmailDomains: []string{"example.com"}})
+	ctx := context.Background()
+
+	if err := service.RegisterUser(ctx, newRegisteredUser("alice", "alice@other.com"), ""); err == nil || err.Error() != consts.ErrEmailDomainNotAllowed {
+		t.Errorf("expected %q, got %v", consts.ErrEmailDomainNotAllowed, err)
+	}
+	if err := service.RegisterUser(ctx, newRegisteredUser("alice", "alice@EXAMPLE.com"), ""); err != nil {
+		t.Errorf("expected the registration to succeed, got %v", err)
+	}
+}
+
+func TestRegisterUserWithInvite(t *testing.T) {
+	service, repo := newRegistrationTestService(t, RegistrationPolicy{Mode: RegistrationInvite})
+	ctx := context.Background()
+	administrator, err := repo.GetUserByUsername(ctx, "administrator")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+
+	if err := service.RegisterUser(ctx, newRegisteredUser("alice", "alice@example.com"), ""); err == nil || err.Error() != consts.ErrInviteRequired {
+		t.Errorf("expected %q, got %v", consts.ErrInviteRequired, err)
+	}
+	if err := service.RegisterUser(ctx, newRegisteredUser("alice", "alice@example.com"), "unknown"); err == nil || err.Error() != consts.ErrInvalidInvite {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidInvite, err)
+	}
+
+	_, code, err := service.CreateInvite(ctx, administrator.ID, "alice@example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.RegisterUser(ctx, newRegisteredUser("bob", "bob@example.com"), code); err == nil || err.Error() != consts.ErrInviteEmailMismatch {
+		t.Errorf("expected %q, got %v", consts.ErrInviteEmailMismatch, err)
+	}
+	if err := service.RegisterUser(ctx, newRegisteredUser("alice", "alice@example.com"), code); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Invites can only be used once.
+	if err := service.RegisterUser(ctx, newRegisteredUser("carol", "carol@example.com"), code); err == nil || err.Error() != consts.ErrInvalidInvite {
+		t.Errorf("expected %q, got %v", consts.ErrInvalidInvite, err)
+	}
+}
+
+func TestMagicLink(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	previous, err := service.CreateMagicLink(ctx, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := service.CreateMagicLink(ctx, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Creating a link invalidates the previous one.
+	if _, err := service.UseMagicLink(ctx, previous); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+
+	signedIn, err := service.UseMagicLink(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signedIn.ID != user.ID || !getTestUser(t, repo, user.ID).VerifiedAt.Valid {
+		t.Errorf("expected %s to be signed in with a verified email", user.ID)
+	}
+
+	// Links can only be used once.
+	if _, err := service.UseMagicLink(ctx, token); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestMagicLinkExpired(t *testing.T) {
+	service, _, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	token, err := service.CreateMagicLink(ctx, user.ID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := service.UseMagicLink(ctx, token); err == nil || err.Error() != consts.ErrMagicLinkExpired {
+		t.Errorf("expected %q, got %v", consts.ErrMagicLinkExpired, err)
+	}
+	// Expired links are used up as well.
+	if _, err := service.UseMagicLink(ctx, token); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestAddCredential(t *testing.T) {
+	service, _, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	if _, err := service.AddCredential(ctx, user.ID, "wrong password", &Credential{CredentialID: []byte{1}, PublicKey: []byte{1}}); err == nil || err.Error() != consts.ErrIncorrectPassword {
+		t.Errorf("expected %q, got %v", consts.ErrIncorrectPassword, err)
+	}
+	if _, err := service.AddCredential(ctx, user.ID, "correct password", &Credential{Name: strings.Repeat("a", 65), CredentialID: []byte{1}, PublicKey: []byte{1}}); err == nil || err.Error() != consts.ErrCredentialNameTooLong {
+		t.Errorf("expected %q, got %v", consts.ErrCredentialNameTooLong, err)
+	}
+
+	credential := &Credential{Name: " ", CredentialID: []byte{1}, PublicKey: []byte{1}}
+	if _, err := service.AddCredential(ctx, user.ID, "correct password", credential); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	credentials, err := service.GetCredentials(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*credentials) != 1 || (*credentials)[0].Name != defaultCredentialName {
+		t.Errorf("expected a credential with the default name, got %v", *credentials)
+	}
+
+	// The credential may be the second factor of the user, so the password is required to delete it.
+	if _, err := service.DeleteCredential(ctx, user.ID, "wrong password", credential.ID); err == nil || err.Error() != consts.ErrIncorrectPassword {
+		t.Errorf("expected %q, got %v", consts.ErrIncorrectPassword, err)
+	}
+	if _, err := service.DeleteCredential(ctx, user.ID, "correct password", credential.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.DeleteCredential(ctx, user.ID, "correct password", credential.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestVerifyUser(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	expired, err := service.CreateVerificationToken(ctx, user.ID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.VerifyUser(ctx, expired); err == nil || err.Error() != consts.ErrVerificationTokenExpired {
+		t.Errorf("expected %q, got %v", consts.ErrVerificationTokenExpired, err)
+	}
+
+	token, err := service.CreateVerificationToken(ctx, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored := getTestUser(t, repo, user.ID).VerificationToken.String; stored == token {
+		t.Error("expected the token to be stored hashed")
+	}
+
+	// Creating a token invalidates the previous one.
+	if err := service.VerifyUser(ctx, expired); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+
+	if err := service.VerifyUser(ctx, token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !getTestUser(t, repo, user.ID).VerifiedAt.Valid {
+		t.Error("expected the email to be verified")
+	}
+	if err := service.VerifyUser(ctx, token); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	service, repo, user := newLockoutTestService(t, "correct password")
+	ctx := context.Background()
+
+	expired, err := service.CreatePasswordResetToken(ctx, user.ID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.ResetPassword(ctx, expired, "An0ther$ecretPass"); err == nil || err.Error() != consts.ErrPasswordResetTokenExpired {
+		t.Errorf("expected %q, got %v", consts.ErrPasswordResetTokenExpired, err)
+	}
+
+	token, err := service.CreatePasswordResetToken(ctx, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored := getTestUser(t, repo, user.ID).PasswordResetToken.String; stored == token {
+		t.Error("expected the token to be stored hashed")
+	}
+
+	if err := service.ResetPassword(ctx, token, "An0ther$ecretPass"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.CheckPassword(ctx, getTestUser(t, repo, user.ID), "An0ther$ecretPass"); err != nil {
+		t.Errorf("expected the new password to be accepted, got %v", err)
+	}
+
+	// Tokens can only be used once.
+	if err := service.ResetPassword(ctx, token, "Y3t$omeOtherPass"); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package consts
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jramsgz/articpad/pkg/apierror"
 	"github.com/jramsgz/articpad/pkg/i18n"
@@ -8,24 +10,82 @@ import (
 
 // These are the defined errors returned using Go's errors package. They are used in the service and repository layers.
 const (
-	ErrUsernameLengthLessThan3           = "username must be at least 3 characters"
-	ErrUsernameLengthMoreThan32          = "username must be at most 32 characters"
-	ErrUsernameContainsInvalidCharacters = "username must only contain letters, numbers, dashes, underscores and dots"
-	ErrPasswordLengthLessThan8           = "password must be at least 8 characters"
-	ErrPasswordLengthMoreThan64          = "password must be at most 64 characters"
+	ErrUsernameTooShort                  = "username is too short"
+	ErrUsernameTooLong                   = "username is too long"
+	ErrUsernameContainsInvalidCharacters = "username contains characters that are not allowed"
+	ErrUsernameReserved                  = "username is reserved"
+	ErrPasswordTooShort                  = "password is too short"
+	ErrPasswordTooLong                   = "password is too long"
 	ErrPasswordSimilarity                = "password must not be too similar to username or email"
 	ErrInvalidEmail                      = "invalid email"
 	ErrEmailAlreadyExists                = "this email is already in use"
 	ErrUsernameAlreadyExists             = "username already exists"
-	ErrPasswordStrength                  = "password must contain at least one uppercase letter, one lowercase letter, one number and one special character"
+	ErrPasswordCompromised               = "password is too common or has appeared in a data breach"
+	ErrPasswordMissingLowercase          = "password must contain at least one lowercase letter"
+	ErrPasswordMissingUppercase          = "password must contain at least one uppercase letter"
+	ErrPasswordMissingNumber             = "password must contain at least one number"
+	ErrPasswordMissingSpecial            = "password must contain at least one special character"
 	ErrEmailAlreadyVerified              = "user is already verified"
 	ErrPasswordResetTokenExpired         = "password reset token has expired"
+	ErrVerificationTokenExpired          = "verification token has expired"
 	ErrDeletedRecord                     = "record has been deleted"
 	ErrUsernameDeactivated               = "username has been deactivated"
 	ErrEmailDeactivated                  = "email has been deactivated"
+	ErrNoteTitleLengthMoreThan255        = "note title must be at most 255 characters"
+	ErrInvalidNotebookName               = "notebook name must be between 1 and 255 characters"
+	ErrNotebookNotFound                  = "notebook not found"
+	ErrNotebookCycle                     = "a notebook cannot be moved into itself or one of its notebooks"
+	ErrInvalidTagName                    = "tag names must be between 1 and 50 characters"
+	ErrTooManyTags                       = "a note can have at most 20 tags"
+	ErrNoteAccessDenied                  = "you do not have permission to do this"
+	ErrInvalidShareRole                  = "role must be one of viewer, commenter, editor or owner"
+	ErrCannotShareWithOwner              = "notes and notebooks cannot be shared with their owner"
+	ErrAlreadyShared                     = "it is already shared with this user"
+	ErrInvalidPublicLinkExpiration       = "public link expiration date must be in the future"
+	ErrPublicLinkPasswordTooLong         = "public link password must be at most 128 characters"
+	ErrPublicLinkPasswordRequired        = "a password is required to open this link"
+	ErrInvalidPublicLinkPassword         = "invalid password"
+	ErrCollabInvalidRevision             = "operation revision is not valid, please reload the note"
+	ErrCollabInvalidOperation            = "operation cannot be applied to the note"
+	ErrCollabUnknownMessageType          = "unknown message type"
+	ErrCollabAccessRevoked               = "you can no longer edit this note, please reload it"
+	ErrInvalidTokenExpiration            = "token does not have a valid expiration time"
+	ErrInvalidRefreshToken               = "invalid refresh token"
+	ErrRefreshTokenExpired               = "refresh token has expired"
+	ErrRefreshTokenReused                = "refresh token has already been used"
+	ErrSessionRevoked                    = "session has been revoked"
+	ErrInvalidTwoFactorCode              = "invalid two-factor authentication code"
+	ErrTwoFactorAlreadyEnabled           = "two-factor authentication is already enabled"
+	ErrTwoFactorNotEnabled               = "two-factor authentication is not enabled"
+	ErrTwoFactorNotSetUp                 = "two-factor authentication has not been set up"
+	ErrInvalidChallengeToken             = "invalid or expired challenge token"
+	ErrExternalAccountNotRegistered      = "no account is linked to this identity"
+	ErrExternalEmailNotVerified          = "the identity provider has not verified the email address"
+	ErrExternalAccountNotVerified        = "the account with this email address has not been verified"
+	ErrInvalidCredentials                = "invalid credentials"
+	ErrAccountLocked                     = "account is temporarily locked"
+	ErrLoginThrottled                    = "too many failed login attempts"
+	ErrCannotModifyOwnAccount            = "administrators cannot perform this action on their own account"
+	ErrUserNotDisabled                   = "user is not disabled"
+	ErrIncorrectPassword                 = "current password is incorrect"
+	ErrEmailChangeTokenExpired           = "email change token has expired"
+	ErrMagicLinkExpired                  = "magic link has expired"
+	ErrCredentialNameTooLong             = "credential name must be at most 64 characters"
+	ErrAPITokenNameLength                = "API token name must be between 1 and 64 characters"
+	ErrInvalidAPITokenScope              = "API token scopes must be one or more of read, write and admin"
+	ErrInvalidAPITokenExpiration         = "API token expiration time must be in the future"
+	ErrAPITokenExpired                   = "API token has expired"
+	ErrRegistrationClosed                = "registration is closed"
+	ErrInviteRequired                    = "an invite code is required to register"
+	ErrInvalidInvite                     = "invalid or already used invite code"
+	ErrInviteExpired                     = "invite code has expired"
+	ErrInviteEmailMismatch               = "invite code is for a different email address"
+	ErrEmailDomainNotAllowed             = "email domain is not allowed"
+	ErrInvalidInviteExpiration           = "invite expiration time must be in the future"
 )
 
-// These are the defined error codes returned by the API, most of them are related to errors defined by this package
+// These are the defined error codes returned by the API, most of them are related to errors defined by this package.
+// The username and password length codes keep their original values for compatibility, although the limits are configurable.
 const (
 	ErrCodeUnknown                               = "unknown_error"
 	ErrCodeBadRequest                            = "bad_request"
@@ -34,6 +94,7 @@ const (
 	ErrCodeUsernameLengthLessThan3Code           = "username_length_less_than_3"
 	ErrCodeUsernameLengthMoreThan32Code          = "username_length_more_than_32"
 	ErrCodeUsernameContainsInvalidCharactersCode = "username_contains_invalid_characters"
+	ErrCodeUsernameReserved                      = "username_reserved"
 	ErrCodePasswordLengthLessThan8Code           = "password_length_less_than_8"
 	ErrCodePasswordLengthMoreThan64Code          = "password_length_more_than_64"
 	ErrCodePasswordSimilarityCode                = "password_similarity"
@@ -41,6 +102,7 @@ const (
 	ErrCodeEmailAlreadyExistsCode                = "email_already_exists"
 	ErrCodeUsernameAlreadyExistsCode             = "username_already_exists"
 	ErrCodePasswordStrengthCode                  = "password_strength"
+	ErrCodePasswordCompromised                   = "password_compromised"
 	ErrCodeEmailNotVerified                      = "email_not_verified"
 	ErrCodeEmailAlreadyVerifiedCode              = "email_already_verified"
 	ErrCodeCannotSendVerificationEmail           = "cannot_send_verification_email"
@@ -50,8 +112,77 @@ const (
 	ErrCodeInvalidJWT                            = "invalid_jwt"
 	ErrCodeInvalidPasswordResetToken             = "invalid_password_reset_token"
 	ErrCodeInvalidVerificationToken              = "invalid_verification_token"
+	ErrCodeVerificationTokenExpired              = "verification_token_expired"
 	ErrCodeUsernameDeactivated                   = "username_deactivated"
 	ErrCodeEmailDeactivated                      = "email_deactivated"
+	ErrCodeRevokedJWT                            = "revoked_jwt"
+	ErrCodeInvalidRefreshToken                   = "invalid_refresh_token"
+	ErrCodeRefreshTokenExpired                   = "refresh_token_expired"
+	ErrCodeRefreshTokenReused                    = "refresh_token_reused"
+	ErrCodeSessionRevoked                        = "session_revoked"
+	ErrCodeSessionNotFound                       = "session_not_found"
+	ErrCodeInvalidTwoFactorCode                  = "invalid_two_factor_code"
+	ErrCodeTwoFactorAlreadyEnabled               = "two_factor_already_enabled"
+	ErrCodeTwoFactorNotEnabled                   = "two_factor_not_enabled"
+	ErrCodeTwoFactorNotSetUp                     = "two_factor_not_set_up"
+	ErrCodeInvalidChallengeToken                 = "invalid_challenge_token"
+	ErrCodeExternalAccountNotRegistered          = "external_account_not_registered"
+	ErrCodeExternalEmailNotVerified              = "external_email_not_verified"
+	ErrCodeExternalAccountNotVerified            = "external_account_not_verified"
+	ErrCodeOIDCNotEnabled                        = "oidc_not_enabled"
+	ErrCodeOIDCLoginFailed                       = "oidc_login_failed"
+	ErrCodeAccountLocked                         = "account_locked"
+	ErrCodeLoginThrottled                        = "login_throttled"
+	ErrCodeForbidden                             = "forbidden"
+	ErrCodeUserNotFound                          = "user_not_found"
+	ErrCodeCannotModifyOwnAccount                = "cannot_modify_own_account"
+	ErrCodeUserNotDisabled                       = "user_not_disabled"
+	ErrCodeIncorrectPassword                     = "incorrect_password"
+	ErrCodeEmailChangeTokenExpired               = "email_change_token_expired"
+	ErrCodeInvalidEmailChangeToken               = "invalid_email_change_token"
+	ErrCodeCannotSendEmailChangeEmail            = "cannot_send_email_change_email"
+	ErrCodeInvalidLanguage                       = "invalid_language"
+	ErrCodeMagicLinkExpired                      = "magic_link_expired"
+	ErrCodeInvalidMagicLink                      = "invalid_magic_link"
+	ErrCodeCannotSendMagicLinkEmail              = "cannot_send_magic_link_email"
+	ErrCodeInvalidWebAuthnSession                = "invalid_webauthn_session"
+	ErrCodeWebAuthnRegistrationFailed            = "webauthn_registration_failed"
+	ErrCodeWebAuthnLoginFailed                   = "webauthn_login_failed"
+	ErrCodeCredentialNotFound                    = "credential_not_found"
+	ErrCodeCredentialNameTooLong                 = "credential_name_too_long"
+	ErrCodeAPITokenNameLength                    = "api_token_name_length"
+	ErrCodeInvalidAPITokenScope                  = "invalid_api_token_scope"
+	ErrCodeInvalidAPITokenExpiration             = "invalid_api_token_expiration"
+	ErrCodeInvalidAPIToken                       = "invalid_api_token"
+	ErrCodeAPITokenNotFound                      = "api_token_not_found"
+	ErrCodeInsufficientScope                     = "insufficient_scope"
+	ErrCodeRegistrationClosed                    = "registration_closed"
+	ErrCodeInviteRequired                        = "invite_required"
+	ErrCodeInvalidInvite                         = "invalid_invite"
+	ErrCodeInviteExpired                         = "invite_expired"
+	ErrCodeInviteEmailMismatch                   = "invite_email_mismatch"
+	ErrCodeEmailDomainNotAllowed                 = "email_domain_not_allowed"
+	ErrCodeInvalidInviteExpiration               = "invalid_invite_expiration"
+	ErrCodeInviteNotFound                        = "invite_not_found"
+	ErrCodeNoteNotFound                          = "note_not_found"
+	ErrCodeRevisionNotFound                      = "revision_not_found"
+	ErrCodeInvalidNotebookName                   = "invalid_notebook_name"
+	ErrCodeNotebookNotFound                      = "notebook_not_found"
+	ErrCodeNotebookCycle                         = "notebook_cycle"
+	ErrCodeInvalidTagName                        = "invalid_tag_name"
+	ErrCodeTooManyTags                           = "too_many_tags"
+	ErrCodeTagNotFound                           = "tag_not_found"
+	ErrCodeNoteAccessDenied                      = "note_access_denied"
+	ErrCodeInvalidShareRole                      = "invalid_share_role"
+	ErrCodeCannotShareWithOwner                  = "cannot_share_with_owner"
+	ErrCodeAlreadyShared                         = "already_shared"
+	ErrCodeShareNotFound                         = "share_not_found"
+	ErrCodeInvalidPublicLinkExpiration           = "invalid_public_link_expiration"
+	ErrCodePublicLinkPasswordTooLong             = "public_link_password_too_long"
+	ErrCodePublicLinkPasswordRequired            = "public_link_password_required"
+	ErrCodeInvalidPublicLinkPassword             = "invalid_public_link_password"
+	ErrCodePublicLinkNotFound                    = "public_link_not_found"
+	ErrCodeNoteTitleLengthMoreThan255            = "note_title_length_more_than_255"
 )
 
 // appError is a struct that contains the data of an error returned by the API.
@@ -62,22 +193,88 @@ type appError struct {
 	ForceShowMessage bool
 }
 
+// ParamError is an error defined by this package whose translated message is completed with the given
+// params, received as pairs of succeeding strings as in i18n.Ts.
+type ParamError struct {
+	Err    string
+	Params []string
+}
+
+// NewParamError returns an error with the given message, one of the defined errors, and the params of its translation.
+func NewParamError(err string, params ...string) error {
+	return &ParamError{Err: err, Params: params}
+}
+
+func (e *ParamError) Error() string {
+	return e.Err
+}
+
 // Map of most of the errors returned by underlying packages/layers.
 var errorsMap = map[string]appError{
-	ErrUsernameLengthLessThan3:           {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameLengthLessThan3Code, Message: "errors.username_too_short"},
-	ErrUsernameLengthMoreThan32:          {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameLengthMoreThan32Code, Message: "errors.username_too_long"},
+	ErrUsernameTooShort:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameLengthLessThan3Code, Message: "errors.username_too_short"},
+	ErrUsernameTooLong:                   {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameLengthMoreThan32Code, Message: "errors.username_too_long"},
 	ErrUsernameContainsInvalidCharacters: {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameContainsInvalidCharactersCode, Message: "errors.username_contains_invalid_characters"},
-	ErrPasswordLengthLessThan8:           {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordLengthLessThan8Code, Message: "errors.password_too_short"},
-	ErrPasswordLengthMoreThan64:          {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordLengthMoreThan64Code, Message: "errors.password_too_long"},
+	ErrUsernameReserved:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameReserved, Message: "errors.username_reserved"},
+	ErrPasswordTooShort:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordLengthLessThan8Code, Message: "errors.password_too_short"},
+	ErrPasswordTooLong:                   {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordLengthMoreThan64Code, Message: "errors.password_too_long"},
 	ErrPasswordSimilarity:                {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordSimilarityCode, Message: "errors.password_too_similar"},
 	ErrInvalidEmail:                      {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidEmail, Message: "errors.invalid_email"},
 	ErrEmailAlreadyExists:                {Status: fiber.StatusConflict, Code: ErrCodeEmailAlreadyExistsCode, Message: "errors.email_already_exists"},
 	ErrUsernameAlreadyExists:             {Status: fiber.StatusConflict, Code: ErrCodeUsernameAlreadyExistsCode, Message: "errors.username_already_exists"},
-	ErrPasswordStrength:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordStrengthCode, Message: "errors.password_not_strong_enough"},
+	ErrPasswordCompromised:               {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordCompromised, Message: "errors.password_compromised"},
+	ErrPasswordMissingLowercase:          {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordStrengthCode, Message: "errors.password_must_contain_lowercase"},
+	ErrPasswordMissingUppercase:          {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordStrengthCode, Message: "errors.password_must_contain_uppercase"},
+	ErrPasswordMissingNumber:             {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordStrengthCode, Message: "errors.password_must_contain_number"},
+	ErrPasswordMissingSpecial:            {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordStrengthCode, Message: "errors.password_must_contain_special"},
 	ErrEmailAlreadyVerified:              {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeEmailAlreadyVerifiedCode, Message: "errors.email_already_verified"},
 	ErrPasswordResetTokenExpired:         {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePasswordResetTokenExpired, Message: "errors.password_reset_token_expired"},
+	ErrVerificationTokenExpired:          {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeVerificationTokenExpired, Message: "errors.verification_token_expired"},
 	ErrUsernameDeactivated:               {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeUsernameDeactivated, Message: "errors.username_deactivated"},
 	ErrEmailDeactivated:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeEmailDeactivated, Message: "errors.email_deactivated"},
+	ErrNoteTitleLengthMoreThan255:        {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeNoteTitleLengthMoreThan255, Message: "errors.note_title_too_long"},
+	ErrInvalidNotebookName:               {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidNotebookName, Message: "errors.invalid_notebook_name"},
+	ErrNotebookNotFound:                  {Status: fiber.StatusNotFound, Code: ErrCodeNotebookNotFound, Message: "errors.notebook_not_found"},
+	ErrNotebookCycle:                     {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeNotebookCycle, Message: "errors.notebook_cycle"},
+	ErrInvalidTagName:                    {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidTagName, Message: "errors.invalid_tag_name"},
+	ErrTooManyTags:                       {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeTooManyTags, Message: "errors.too_many_tags"},
+	ErrNoteAccessDenied:                  {Status: fiber.StatusForbidden, Code: ErrCodeNoteAccessDenied, Message: "errors.note_access_denied"},
+	ErrInvalidShareRole:                  {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidShareRole, Message: "errors.invalid_share_role"},
+	ErrCannotShareWithOwner:              {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeCannotShareWithOwner, Message: "errors.cannot_share_with_owner"},
+	ErrAlreadyShared:                     {Status: fiber.StatusConflict, Code: ErrCodeAlreadyShared, Message: "errors.already_shared"},
+	ErrInvalidPublicLinkExpiration:       {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidPublicLinkExpiration, Message: "errors.invalid_public_link_expiration"},
+	ErrPublicLinkPasswordTooLong:         {Status: fiber.StatusUnprocessableEntity, Code: ErrCodePublicLinkPasswordTooLong, Message: "errors.public_link_password_too_long"},
+	ErrPublicLinkPasswordRequired:        {Status: fiber.StatusUnauthorized, Code: ErrCodePublicLinkPasswordRequired, Message: "errors.public_link_password_required"},
+	ErrInvalidPublicLinkPassword:         {Status: fiber.StatusUnauthorized, Code: ErrCodeInvalidPublicLinkPassword, Message: "errors.invalid_public_link_password"},
+	ErrInvalidRefreshToken:               {Status: fiber.StatusUnauthorized, Code: ErrCodeInvalidRefreshToken, Message: "errors.invalid_refresh_token"},
+	ErrRefreshTokenExpired:               {Status: fiber.StatusUnauthorized, Code: ErrCodeRefreshTokenExpired, Message: "errors.refresh_token_expired"},
+	ErrRefreshTokenReused:                {Status: fiber.StatusUnauthorized, Code: ErrCodeRefreshTokenReused, Message: "errors.refresh_token_reused"},
+	ErrSessionRevoked:                    {Status: fiber.StatusUnauthorized, Code: ErrCodeSessionRevoked, Message: "errors.session_revoked"},
+	ErrInvalidTwoFactorCode:              {Status: fiber.StatusUnauthorized, Code: ErrCodeInvalidTwoFactorCode, Message: "errors.invalid_two_factor_code"},
+	ErrTwoFactorAlreadyEnabled:           {Status: fiber.StatusConflict, Code: ErrCodeTwoFactorAlreadyEnabled, Message: "errors.two_factor_already_enabled"},
+	ErrTwoFactorNotEnabled:               {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeTwoFactorNotEnabled, Message: "errors.two_factor_not_enabled"},
+	ErrTwoFactorNotSetUp:                 {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeTwoFactorNotSetUp, Message: "errors.two_factor_not_set_up"},
+	ErrExternalAccountNotRegistered:      {Status: fiber.StatusForbidden, Code: ErrCodeExternalAccountNotRegistered, Message: "errors.external_account_not_registered"},
+	ErrExternalEmailNotVerified:          {Status: fiber.StatusForbidden, Code: ErrCodeExternalEmailNotVerified, Message: "errors.external_email_not_verified"},
+	ErrExternalAccountNotVerified:        {Status: fiber.StatusForbidden, Code: ErrCodeExternalAccountNotVerified, Message: "errors.external_account_not_verified"},
+	ErrInvalidCredentials:                {Status: fiber.StatusUnauthorized, Code: ErrCodeInvalidCredentials, Message: "errors.invalid_credentials"},
+	ErrAccountLocked:                     {Status: fiber.StatusLocked, Code: ErrCodeAccountLocked, Message: "errors.account_locked"},
+	ErrLoginThrottled:                    {Status: fiber.StatusTooManyRequests, Code: ErrCodeLoginThrottled, Message: "errors.login_throttled"},
+	ErrCannotModifyOwnAccount:            {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeCannotModifyOwnAccount, Message: "errors.cannot_modify_own_account"},
+	ErrUserNotDisabled:                   {Status: fiber.StatusConflict, Code: ErrCodeUserNotDisabled, Message: "errors.user_not_disabled"},
+	ErrIncorrectPassword:                 {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeIncorrectPassword, Message: "errors.incorrect_password"},
+	ErrEmailChangeTokenExpired:           {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeEmailChangeTokenExpired, Message: "errors.email_change_token_expired"},
+	ErrMagicLinkExpired:                  {Status: fiber.StatusUnauthorized, Code: ErrCodeMagicLinkExpired, Message: "errors.magic_link_expired"},
+	ErrCredentialNameTooLong:             {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeCredentialNameTooLong, Message: "errors.credential_name_too_long"},
+	ErrAPITokenNameLength:                {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeAPITokenNameLength, Message: "errors.api_token_name_length"},
+	ErrInvalidAPITokenScope:              {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidAPITokenScope, Message: "errors.invalid_api_token_scope"},
+	ErrInvalidAPITokenExpiration:         {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidAPITokenExpiration, Message: "errors.invalid_api_token_expiration"},
+	ErrRegistrationClosed:                {Status: fiber.StatusForbidden, Code: ErrCodeRegistrationClosed, Message: "errors.registration_closed"},
+	ErrInviteRequired:                    {Status: fiber.StatusForbidden, Code: ErrCodeInviteRequired, Message: "errors.invite_required"},
+	ErrInvalidInvite:                     {Status: fiber.StatusForbidden, Code: ErrCodeInvalidInvite, Message: "errors.invalid_invite"},
+	ErrInviteExpired:                     {Status: fiber.StatusForbidden, Code: ErrCodeInviteExpired, Message: "errors.invite_expired"},
+	ErrInviteEmailMismatch:               {Status: fiber.StatusForbidden, Code: ErrCodeInviteEmailMismatch, Message: "errors.invite_email_mismatch"},
+	ErrEmailDomainNotAllowed:             {Status: fiber.StatusForbidden, Code: ErrCodeEmailDomainNotAllowed, Message: "errors.email_domain_not_allowed"},
+	ErrInvalidInviteExpiration:           {Status: fiber.StatusUnprocessableEntity, Code: ErrCodeInvalidInviteExpiration, Message: "errors.invalid_invite_expiration"},
 }
 
 // MapApiError maps an error to the corresponding API error if possible.
@@ -87,7 +284,12 @@ var errorsMap = map[string]appError{
 func MapApiError(err error, i18n *i18n.I18n, langCode ...string) *apierror.Error {
 	if appError, ok := errorsMap[err.Error()]; ok {
 		if i18n != nil && len(langCode) > 0 {
-			appError.Message = i18n.T(langCode[0], appError.Message)
+			var paramErr *ParamError
+			if errors.As(err, &paramErr) {
+				appError.Message = i18n.Ts(langCode[0], appError.Message, paramErr.Params...)
+			} else {
+				appError.Message = i18n.T(langCode[0], appError.Message)
+			}
 		}
 		return apierror.NewApiError(appError.Status, appError.Code, appError.Message)
 	}
@@ -2,7 +2,11 @@ package templates
 
 import (
 	"bytes"
+	"html"
+	"strconv"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/jramsgz/articpad/config"
 	"github.com/jramsgz/articpad/internal/user"
@@ -11,10 +15,10 @@ import (
 )
 
 // GetEmailVerificationEmail returns the email verification email message.
-func GetEmailVerificationEmail(i18n *i18n.I18n, user *user.User) *mail.MailMessage {
+func GetEmailVerificationEmail(i18n *i18n.I18n, user *user.User, token string) *mail.MailMessage {
 	lang := i18n.ParseLanguage(user.Lang)
 	t := buildTemplate("email_verification.html", map[string]string{
-		"URL":        config.GetString("APP_URL") + "/verify/" + user.VerificationToken,
+		"URL":        config.GetString("APP_URL") + "/verify/" + token,
 		"Subject":    i18n.T(lang, "email.verification.subject"),
 		"Header":     i18n.T(lang, "email.verification.header"),
 		"LogoURL":    config.GetString("APP_URL") + "/assets/logo_vertical.png",
@@ -54,6 +58,109 @@ func GetPasswordResetEmail(i18n *i18n.I18n, user *user.User, token string) *mail
 	}
 }
 
+// GetAccountLockedEmail returns the email sent when an account is locked after too many failed attempts
+// to sign in or to confirm a change with a password or a two-factor code.
+func GetAccountLockedEmail(i18n *i18n.I18n, user *user.User, attempts int, lockoutDuration time.Duration, ip string) *mail.MailMessage {
+	lang := i18n.ParseLanguage(user.Lang)
+	t := buildTemplate("account_locked.html", map[string]string{
+		"URL":     config.GetString("APP_URL") + "/password-reset",
+		"Subject": i18n.T(lang, "email.account_locked.subject"),
+		"Header":  i18n.T(lang, "email.account_locked.header"),
+		"LogoURL": config.GetString("APP_URL") + "/assets/logo_vertical.png",
+		"Title":   i18n.T(lang, "email.account_locked.title"),
+		"Content": i18n.Ts(lang, "email.account_locked.content",
+			"attempts", strconv.Itoa(attempts),
+			"ip", ip,
+			"minutes", strconv.Itoa(int(lockoutDuration.Minutes())),
+		),
+		"Button":     i18n.T(lang, "email.account_locked.button"),
+		"ButtonLink": i18n.T(lang, "email.button_link"),
+		"Footer":     i18n.T(lang, "email.footer"),
+	})
+	return &mail.MailMessage{
+		To:          []string{user.Email},
+		Subject:     i18n.T(lang, "email.account_locked.subject"),
+		ContentType: mail.ContentTypeTextHTML,
+		Body:        t,
+	}
+}
+
+// GetEmailChangeEmail returns the email sent to the new address of a user to confirm an email change.
+func GetEmailChangeEmail(i18n *i18n.I18n, user *user.User, token string) *mail.MailMessage {
+	lang := i18n.ParseLanguage(user.Lang)
+	t := buildTemplate("email_change.html", map[string]string{
+		"URL":        config.GetString("APP_URL") + "/confirm-email/" + token,
+		"Subject":    i18n.T(lang, "email.email_change.subject"),
+		"Header":     i18n.T(lang, "email.email_change.header"),
+		"LogoURL":    config.GetString("APP_URL") + "/assets/logo_vertical.png",
+		"Title":      i18n.T(lang, "email.email_change.title"),
+		"Content":    i18n.Ts(lang, "email.email_change.content", "username", user.Username),
+		"Button":     i18n.T(lang, "email.email_change.button"),
+		"ButtonLink": i18n.T(lang, "email.button_link"),
+		"Footer":     i18n.T(lang, "email.footer"),
+	})
+	return &mail.MailMessage{
+		To:          []string{user.PendingEmail},
+		Subject:     i18n.T(lang, "email.email_change.subject"),
+		ContentType: mail.ContentTypeTextHTML,
+		Body:        t,
+	}
+}
+
+// GetMagicLinkEmail returns the email with a link to sign in without a password, valid for the given time.
+func GetMagicLinkEmail(i18n *i18n.I18n, user *user.User, token string, ttl time.Duration) *mail.MailMessage {
+	lang := i18n.ParseLanguage(user.Lang)
+	minutes := int(ttl.Minutes())
+	t := buildTemplate("magic_link.html", map[string]string{
+		"URL":        config.GetString("APP_URL") + "/magic-link/" + token,
+		"Subject":    i18n.T(lang, "email.magic_link.subject"),
+		"Header":     i18n.T(lang, "email.magic_link.header"),
+		"LogoURL":    config.GetString("APP_URL") + "/assets/logo_vertical.png",
+		"Title":      i18n.T(lang, "email.magic_link.title"),
+		"Content":    i18n.Tsc(lang, "email.magic_link.content", minutes, "username", user.Username, "minutes", strconv.Itoa(minutes)),
+		"Button":     i18n.T(lang, "email.magic_link.button"),
+		"ButtonLink": i18n.T(lang, "email.button_link"),
+		"Footer":     i18n.T(lang, "email.footer"),
+	})
+	return &mail.MailMessage{
+		To:          []string{user.Email},
+		Subject:     i18n.T(lang, "email.magic_link.subject"),
+		ContentType: mail.ContentTypeTextHTML,
+		Body:        t,
+	}
+}
+
+// GetShareInvitationEmail returns the email sent to a user when a note or notebook is shared with them.
+// The itemType is either "note" or "notebook" and url is the address where it can be opened.
+func GetShareInvitationEmail(i18n *i18n.I18n, user *user.User, sharedBy string, itemType string, name string, role string, url string) *mail.MailMessage {
+	lang := i18n.ParseLanguage(user.Lang)
+	// The name is chosen by another user, so it is escaped and kept on a single line.
+	name = strings.Join(strings.Fields(name), " ")
+	params := []string{
+		"sharedBy", html.EscapeString(sharedBy),
+		"name", html.EscapeString(name),
+		"username", user.Username,
+		"role", i18n.T(lang, "email.share_invitation.role."+role),
+	}
+	t := buildTemplate("share_invitation.html", map[string]string{
+		"URL":        url,
+		"Subject":    i18n.Ts(lang, "email.share_invitation.subject", params...),
+		"Header":     i18n.T(lang, "email.share_invitation.header"),
+		"LogoURL":    config.GetString("APP_URL") + "/assets/logo_vertical.png",
+		"Title":      i18n.T(lang, "email.share_invitation.title"),
+		"Content":    i18n.Ts(lang, "email.share_invitation.content."+itemType, params...),
+		"Button":     i18n.T(lang, "email.share_invitation.button"),
+		"ButtonLink": i18n.T(lang, "email.button_link"),
+		"Footer":     i18n.T(lang, "email.footer"),
+	})
+	return &mail.MailMessage{
+		To:          []string{user.Email},
+		Subject:     i18n.Ts(lang, "email.share_invitation.subject", "sharedBy", sharedBy, "name", name),
+		ContentType: mail.ContentTypeTextHTML,
+		Body:        t,
+	}
+}
+
 // buildTemplate builds the template with the given language, template type and data.
 func buildTemplate(templateType string, data map[string]string) string {
 	path := config.GetString("TEMPLATES_DIR")
@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jramsgz/articpad/config"
+	"github.com/jramsgz/articpad/pkg/i18n"
+)
+
+// Addresses turned into links when rendering the body of a note. Only http and https links are
+// matched, so no other scheme can end up in a link.
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// Blank lines that separate the paragraphs of the body of a note.
+var paragraphRegexp = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// publicNotePage holds the data of the page of a note opened with a public link.
+type publicNotePage struct {
+	Lang             string
+	Title            string
+	Body             template.HTML
+	UpdatedAt        string
+	UpdatedAtText    string
+	PasswordRequired bool
+	PasswordLabel    string
+	Button           string
+	Error            string
+	Footer           string
+}
+
+// GetPublicNotePage returns the page that shows a note opened with a public link. The body is plain text,
+// which is escaped and rendered as paragraphs with its addresses as links.
+func GetPublicNotePage(i18n *i18n.I18n, lang string, title string, body string, updatedAt time.Time) []byte {
+	if strings.TrimSpace(title) == "" {
+		title = i18n.T(lang, "public_note.untitled")
+	}
+	return buildPage(&publicNotePage{
+		Lang:          lang,
+		Title:         title,
+		Body:          formatPlainText(body),
+		UpdatedAt:     updatedAt.UTC().Format(time.RFC3339),
+		UpdatedAtText: updatedAt.UTC().Format("2006-01-02 15:04 UTC"),
+		Footer:        i18n.T(lang, "public_note.footer"),
+	})
+}
+
+// GetPublicNotePasswordPage returns the page that asks for the password of a public link, with an error
+// message if a wrong password was sent.
+func GetPublicNotePasswordPage(i18n *i18n.I18n, lang string, errorMessage string) []byte {
+	return buildPage(&publicNotePage{
+		Lang:             lang,
+		Title:            i18n.T(lang, "public_note.password_title"),
+		PasswordRequired: true,
+		PasswordLabel:    i18n.T(lang, "public_note.password"),
+		Button:           i18n.T(lang, "public_note.open"),
+		Error:            errorMessage,
+		Footer:           i18n.T(lang, "public_note.footer"),
+	})
+}
+
+// GetPublicNoteNotFoundPage returns the page shown when a public link does not exist or has expired.
+func GetPublicNoteNotFoundPage(i18n *i18n.I18n, lang string) []byte {
+	return buildPage(&publicNotePage{
+		Lang:   lang,
+		Title:  i18n.T(lang, "public_note.not_found_title"),
+		Error:  i18n.T(lang, "errors.public_link_not_found"),
+		Footer: i18n.T(lang, "public_note.footer"),
+	})
+}
+
+// buildPage builds the page of a public note with the given data, escaping it as HTML.
+func buildPage(data *publicNotePage) []byte {
+	path := config.GetString("TEMPLATES_DIR")
+
+	temp := template.Must(template.ParseFiles(path + "/public/note.html"))
+
+	var body bytes.Buffer
+	if err := temp.Execute(&body, data); err != nil {
+		panic(err)
+	}
+	return body.Bytes()
+}
+
+// formatPlainText converts plain text to HTML. Everything is escaped, blank lines separate paragraphs,
+// line breaks are kept and http and https addresses become links.
+func formatPlainText(text string) template.HTML {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, paragraph := range paragraphRegexp.Split(text, -1) {
+		sb.WriteString("<p>")
+		for i, line := range strings.Split(paragraph, "\n") {
+			if i > 0 {
+				sb.WriteString("<br>")
+			}
+			writeLinkified(&sb, line)
+		}
+		sb.WriteString("</p>")
+	}
+
+	return template.HTML(sb.String())
+}
+
+// writeLinkified writes a line of text escaped as HTML, with its addresses as links.
+func writeLinkified(sb *strings.Builder, line string) {
+	last := 0
+	for _, match := range urlRegexp.FindAllStringIndex(line, -1) {
+		start, end := match[0], match[1]
+		// Punctuation at the end most likely belongs to the sentence, not the address.
+		for end > start && strings.ContainsRune(".,;:!?)]}", rune(line[end-1])) {
+			end--
+		}
+		url := html.EscapeString(line[start:end])
+		sb.WriteString(html.EscapeString(line[last:start]))
+		sb.WriteString(`<a href="` + url + `" rel="nofollow noopener noreferrer" target="_blank">` + url + `</a>`)
+		last = end
+	}
+	sb.WriteString(html.EscapeString(line[last:]))
+}
@@ -0,0 +1,38 @@
+// Package testdb opens in-memory databases for the tests of the repositories.
+package testdb
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// New opens an empty in-memory SQLite database only used by the given test, creating the tables of
+// the given models. The database is closed once the test finishes.
+func New(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	// A single connection keeps the in-memory database alive and avoids locking errors.
+	db, err := gorm.Open(sqlite.Open("file:"+url.PathEscape(t.Name())+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get the database connection: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(models...)
+	if err != nil {
+		t.Fatalf("failed to migrate the database: %v", err)
+	}
+
+	return db
+}
@@ -0,0 +1,292 @@
+// Line based diffs of plain text in the unified format, using the linear space variant of the
+// algorithm described in "An O(ND) Difference Algorithm and Its Variations" by Eugene W. Myers.
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContextLines is the number of unchanged lines shown around each change.
+const ContextLines = 3
+
+// Number of differences after which the search for the shortest edit script gives up and splits
+// the texts at the furthest point reached, which bounds the time taken by very different texts.
+const maxCost = 1024
+
+// Kind is the type of an edit of a script.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Edit is a single line of an edit script. Lines include their line break, if any.
+type Edit struct {
+	Kind Kind
+	Line string
+}
+
+// Lines returns the shortest edit script that transforms the lines of a into the lines of b. If they
+// are very different, the script may be a bit longer than the shortest one.
+func Lines(a, b string) []Edit {
+	aLines, bLines := splitLines(a), splitLines(b)
+
+	// Lines are compared as integers, which is faster than comparing strings.
+	ids := map[string]int{}
+	d := &differ{
+		a:       toIDs(aLines, ids),
+		b:       toIDs(bLines, ids),
+		deleted: make([]bool, len(aLines)),
+		added:   make([]bool, len(bLines)),
+	}
+	d.forward = make([]int, len(aLines)+len(bLines)+3)
+	d.backward = make([]int, len(aLines)+len(bLines)+3)
+	d.compare(0, len(aLines), 0, len(bLines))
+
+	edits := make([]Edit, 0, len(aLines)+len(bLines))
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && d.deleted[i]:
+			edits = append(edits, Edit{Kind: Delete, Line: aLines[i]})
+			i++
+		case j < len(bLines) && d.added[j]:
+			edits = append(edits, Edit{Kind: Insert, Line: bLines[j]})
+			j++
+		default:
+			edits = append(edits, Edit{Kind: Equal, Line: aLines[i]})
+			i++
+			j++
+		}
+	}
+
+	return edits
+}
+
+// Unified returns the differences between a and b in the unified format, with fromName and toName
+// as the names of the files being compared. It returns an empty string if a and b are equal.
+func Unified(fromName, toName, a, b string) string {
+	edits := Lines(a, b)
+
+	var sb strings.Builder
+	// Position of each edit in a and b.
+	aPos, bPos := make([]int, len(edits)+1), make([]int, len(edits)+1)
+	for i, edit := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if edit.Kind != Insert {
+			aPos[i+1]++
+		}
+		if edit.Kind != Delete {
+			bPos[i+1]++
+		}
+	}
+
+	for start := 0; start < len(edits); {
+		// Find the next change and extend the hunk until the gap to the following one is too large.
+		first := start
+		for first < len(edits) && edits[first].Kind == Equal {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for i := first; i < len(edits) && i-last <= 2*ContextLines; i++ {
+			if edits[i].Kind != Equal {
+				last = i
+			}
+		}
+
+		hunkStart := max(first-ContextLines, start)
+		hunkEnd := min(last+ContextLines+1, len(edits))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			formatRange(aPos[hunkStart], aPos[hunkEnd]-aPos[hunkStart]),
+			formatRange(bPos[hunkStart], bPos[hunkEnd]-bPos[hunkStart]),
+		)
+		for _, edit := range edits[hunkStart:hunkEnd] {
+			switch edit.Kind {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+			sb.WriteString(edit.Line)
+			if !strings.HasSuffix(edit.Line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return sb.String()
+}
+
+// formatRange formats the range of lines of a hunk, starting at the given 0-based line.
+func formatRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+// splitLines splits text into lines, keeping their line breaks.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// toIDs maps each line to an integer, equal lines get the same integer.
+func toIDs(lines []string, ids map[string]int) []int {
+	result := make([]int, len(lines))
+	for i, line := range lines {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		result[i] = id
+	}
+	return result
+}
+
+// differ holds the state used to compare two sequences of lines.
+type differ struct {
+	a, b []int
+	// Lines of a deleted and lines of b added by the edit script.
+	deleted, added []bool
+	// Furthest reaching paths on each diagonal, shared by every call to avoid allocations.
+	forward, backward []int
+}
+
+// compare marks the lines that differ between a[aLo:aHi] and b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// middleSnake finds a point on an optimal path from (aLo, bLo) to (aHi, bHi) that splits the
+// problem into two smaller ones, searching forward from the start and backward from the end at
+// the same time until the paths overlap.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+
+	// Diagonals go from -m to n, plus one on each side read as neighbours.
+	offset := m + 1
+	forward := d.forward[:n+m+3]
+	backward := d.backward[:n+m+3]
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = n + 1
+	}
+
+	for D := 0; ; D++ {
+		for k := max(-D, -m+((D+m)%2)); k <= min(D, n); k += 2 {
+			x := -1
+			if D == 0 {
+				x = 0
+			} else {
+				if down := forward[offset+k+1]; down >= 0 && down-k <= m {
+					x = down
+				}
+				if right := forward[offset+k-1]; right >= 0 && right+1 <= n && right+1 > x {
+					x = right + 1
+				}
+				if x < 0 {
+					continue
+				}
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			if odd && k >= delta-(D-1) && k <= delta+(D-1) && x >= backward[offset+k] {
+				return aLo + x, bLo + y
+			}
+		}
+
+		for k := max(delta-D, -m+((delta+D+m)%2)); k <= min(delta+D, n); k += 2 {
+			x := n + 1
+			if D == 0 {
+				x = n
+			} else {
+				if up := backward[offset+k-1]; up <= n && up-k >= 0 {
+					x = up
+				}
+				if left := backward[offset+k+1]; left <= n && left-1 >= 0 && left-1 < x {
+					x = left - 1
+				}
+				if x > n {
+					continue
+				}
+			}
+			y := x - k
+			for x > 0 && y > 0 && a[x-1] == b[y-1] {
+				x--
+				y--
+			}
+			backward[offset+k] = x
+
+			if !odd && k >= -D && k <= D && x <= forward[offset+k] {
+				return aLo + x, bLo + y
+			}
+		}
+
+		if D >= maxCost {
+			bestX, bestY := -1, -1
+			for k := max(-D, -m); k <= min(D, n); k++ {
+				x := forward[offset+k]
+				if x >= 0 && x-k <= m && x+x-k > bestX+bestY && x+x-k < n+m {
+					bestX, bestY = x, x-k
+				}
+			}
+			if bestX >= 0 {
+				return aLo + bestX, bLo + bestY
+			}
+		}
+	}
+}
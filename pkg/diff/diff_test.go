@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\ntwelve\n"
+	b := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\ntwelve\nthirteen"
+
+	expected := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ one
+-two
++2
+ three
+ four
+ five
+@@ -10,3 +10,4 @@
+ ten
+ eleven
+ twelve
++thirteen
+\ No newline at end of file
+`
+	if result := Unified("a", "b", a, b); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestUnifiedMergesCloseChanges(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nH\n"
+
+	expected := `--- old
++++ new
+@@ -1,8 +1,8 @@
+ a
+-b
++B
+ c
+ d
+ e
+ f
+ g
+-h
++H
+`
+	if result := Unified("old", "new", a, b); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestUnifiedEmpty(t *testing.T) {
+	if result := Unified("a", "b", "same\n", "same\n"); result != "" {
+		t.Errorf("expected no differences, got:\n%s", result)
+	}
+
+	expected := "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+new\n+lines\n"
+	if result := Unified("a", "b", "", "new\nlines\n"); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	expected = "--- a\n+++ b\n@@ -1 +0,0 @@\n-old\n"
+	if result := Unified("a", "b", "old\n", ""); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestLinesRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	randomText := func() string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := randomText(), randomText()
+		edits := Lines(a, b)
+
+		var from, to strings.Builder
+		equal := 0
+		for _, edit := range edits {
+			if edit.Kind != Insert {
+				from.WriteString(edit.Line)
+			}
+			if edit.Kind != Delete {
+				to.WriteString(edit.Line)
+			}
+			if edit.Kind == Equal {
+				equal++
+			}
+		}
+		if from.String() != a || to.String() != b {
+			t.Fatalf("edit script does not transform %q into %q", a, b)
+		}
+
+		// The edit script is the shortest one if it keeps the longest common subsequence.
+		if expected := lcsLength(splitLines(a), splitLines(b)); equal != expected {
+			t.Fatalf("expected %d equal lines between %q and %q, got %d", expected, a, b, equal)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Password hashing with support for several algorithms, so stored hashes can be migrated to
+// newer algorithms or parameters when users log in.
+
+package hasher
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnsupportedHash = errors.New("hasher: the hash was not created with a supported algorithm")
+
+// Hasher hashes passwords and verifies them against encoded hashes.
+type Hasher interface {
+	// Hash returns the encoded hash of a password.
+	Hash(password string) (string, error)
+	// Verify checks a password against an encoded hash. If the password matches, needsRehash tells
+	// whether the hash should be replaced because it was created with other algorithm or parameters.
+	Verify(password, hash string) (match bool, needsRehash bool, err error)
+	// Supports tells whether the encoded hash was created with the algorithm of the hasher.
+	Supports(hash string) bool
+}
+
+// Argon2id hashes passwords with Argon2id using the given parameters.
+type Argon2id struct {
+	Params *argon2id.Params
+}
+
+// Hash implements Hasher.
+func (h *Argon2id) Hash(password string) (string, error) {
+	return argon2id.CreateHash(password, h.Params)
+}
+
+// Verify implements Hasher.
+func (h *Argon2id) Verify(password, hash string) (bool, bool, error) {
+	match, params, err := argon2id.CheckHash(password, hash)
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	return true, *params != *h.Params, nil
+}
+
+// Supports implements Hasher.
+func (h *Argon2id) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Bcrypt hashes passwords with bcrypt using the given cost. Only the first 72 bytes of the
+// password are used.
+type Bcrypt struct {
+	Cost int
+}
+
+// Hash implements Hasher.
+func (h *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+// Verify implements Hasher.
+func (h *Bcrypt) Verify(password, hash string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, cost != h.Cost, nil
+}
+
+// Supports implements Hasher.
+func (h *Bcrypt) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Chain hashes passwords with its current hasher and verifies them with whichever hasher supports
+// the hash. Hashes created by the legacy hashers always need to be rehashed.
+type Chain struct {
+	current Hasher
+	legacy  []Hasher
+}
+
+// New returns a hasher that creates hashes with current and can also verify the hashes created by legacy.
+func New(current Hasher, legacy ...Hasher) *Chain {
+	return &Chain{current: current, legacy: legacy}
+}
+
+// Hash implements Hasher.
+func (c *Chain) Hash(password string) (string, error) {
+	return c.current.Hash(password)
+}
+
+// Verify implements Hasher.
+func (c *Chain) Verify(password, hash string) (bool, bool, error) {
+	if c.current.Supports(hash) {
+		return c.current.Verify(password, hash)
+	}
+
+	for _, h := range c.legacy {
+		if h.Supports(hash) {
+			match, _, err := h.Verify(password, hash)
+			return match, match, err
+		}
+	}
+
+	return false, false, ErrUnsupportedHash
+}
+
+// Supports implements Hasher.
+func (c *Chain) Supports(hash string) bool {
+	if c.current.Supports(hash) {
+		return true
+	}
+
+	for _, h := range c.legacy {
+		if h.Supports(hash) {
+			return true
+		}
+	}
+
+	return false
+}
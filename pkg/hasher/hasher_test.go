@@ -0,0 +1,155 @@
+package hasher
+
+import (
+	"testing"
+
+	"github.com/jramsgz/articpad/pkg/argon2id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2id(t *testing.T) {
+	h := &Argon2id{Params: argon2id.DefaultParams}
+
+	hash, err := h.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Supports(hash) {
+		t.Errorf("expected %q to be supported", hash)
+	}
+
+	match, needsRehash, err := h.Verify("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match || needsRehash {
+		t.Errorf("expected match without rehash, got match=%t needsRehash=%t", match, needsRehash)
+	}
+
+	match, _, err = h.Verify("otherPa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("expected passwords not to match")
+	}
+}
+
+func TestArgon2idOutdatedParams(t *testing.T) {
+	hash, err := argon2id.CreateHash("pa$$word", &argon2id.Params{
+		Memory:      16 * 1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Argon2id{Params: argon2id.DefaultParams}
+	match, needsRehash, err := h.Verify("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match || !needsRehash {
+		t.Errorf("expected match with rehash, got match=%t needsRehash=%t", match, needsRehash)
+	}
+
+	// Hashes are only flagged when the password matches.
+	_, needsRehash, _ = h.Verify("otherPa$$word", hash)
+	if needsRehash {
+		t.Error("expected no rehash when the password does not match")
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	h := &Bcrypt{Cost: bcrypt.MinCost}
+
+	hash, err := h.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Supports(hash) {
+		t.Errorf("expected %q to be supported", hash)
+	}
+
+	match, needsRehash, err := h.Verify("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match || needsRehash {
+		t.Errorf("expected match without rehash, got match=%t needsRehash=%t", match, needsRehash)
+	}
+
+	match, _, err = (&Bcrypt{Cost: bcrypt.MinCost + 1}).Verify("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected passwords to match")
+	}
+
+	match, _, err = h.Verify("otherPa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("expected passwords not to match")
+	}
+}
+
+func TestChain(t *testing.T) {
+	current := &Argon2id{Params: argon2id.DefaultParams}
+	legacy := &Bcrypt{Cost: bcrypt.MinCost}
+	h := New(current, legacy)
+
+	hash, err := h.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.Supports(hash) {
+		t.Errorf("expected the current hasher to be used, got %q", hash)
+	}
+
+	legacyHash, err := legacy.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		hash        string
+		match       bool
+		needsRehash bool
+	}{
+		{"current", "pa$$word", hash, true, false},
+		{"current mismatch", "otherPa$$word", hash, false, false},
+		{"legacy", "pa$$word", legacyHash, true, true},
+		{"legacy mismatch", "otherPa$$word", legacyHash, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, needsRehash, err := h.Verify(tt.password, tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match != tt.match || needsRehash != tt.needsRehash {
+				t.Errorf("expected match=%t needsRehash=%t, got match=%t needsRehash=%t", tt.match, tt.needsRehash, match, needsRehash)
+			}
+		})
+	}
+}
+
+func TestChainUnsupportedHash(t *testing.T) {
+	h := New(&Argon2id{Params: argon2id.DefaultParams})
+
+	if h.Supports("$2a$10$abcdefghijklmnopqrstuu") {
+		t.Error("expected bcrypt hashes not to be supported without a legacy hasher")
+	}
+	if _, _, err := h.Verify("pa$$word", "plaintext"); err != ErrUnsupportedHash {
+		t.Errorf("expected %v, got %v", ErrUnsupportedHash, err)
+	}
+}
@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// stubProvider is a minimal identity provider issuing ID tokens for a single authorization code.
+type stubProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                s.server.URL,
+			"authorization_endpoint":                s.server.URL + "/authorize",
+			"token_endpoint":                        s.server.URL + "/token",
+			"jwks_uri":                              s.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   s.server.URL,
+			"aud":   "articpad",
+			"sub":   "user-1",
+			"nonce": s.nonce,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+		}
+		for k, v := range s.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// authorize simulates the user logging in to the identity provider.
+func (s *stubProvider) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 code challenge, got %q", u.Query().Get("code_challenge_method"))
+	}
+	s.challenge = u.Query().Get("code_challenge")
+	s.nonce = u.Query().Get("nonce")
+}
+
+func newTestProvider(s *stubProvider) *Provider {
+	return New(Config{
+		Issuer:      s.server.URL,
+		ClientID:    "articpad",
+		RedirectURL: "http://localhost/callback",
+	})
+}
+
+func TestExchange(t *testing.T) {
+	stub := newStubProvider(t)
+	stub.claims = jwt.MapClaims{"email": "user@example.com", "email_verified": "true", "preferred_username": "user"}
+	provider := newTestProvider(stub)
+
+	verifier := GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.authorize(t, authURL)
+
+	claims, err := provider.Exchange(context.Background(), "valid-code", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != stub.server.URL || claims.Subject != "user-1" {
+		t.Errorf("unexpected identity %s %s", claims.Issuer, claims.Subject)
+	}
+	if claims.Email != "user@example.com" || !claims.EmailVerified || claims.PreferredUsername != "user" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeInvalidVerifier(t *testing.T) {
+	stub := newStubProvider(t)
+	provider := newTestProvider(stub)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", GenerateVerifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.authorize(t, authURL)
+
+	if _, err := provider.Exchange(context.Background(), "valid-code", "nonce", GenerateVerifier()); err == nil {
+		t.Error("expected an error when using a different code verifier")
+	}
+}
+
+func TestExchangeNonceMismatch(t *testing.T) {
+	stub := newStubProvider(t)
+	provider := newTestProvider(stub)
+
+	verifier := GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.authorize(t, authURL)
+
+	if _, err := provider.Exchange(context.Background(), "valid-code", "other-nonce", verifier); err != ErrNonceMismatch {
+		t.Errorf("expected %v, got %v", ErrNonceMismatch, err)
+	}
+}
+
+func TestExchangeWrongAudience(t *testing.T) {
+	stub := newStubProvider(t)
+	stub.claims = jwt.MapClaims{"aud": "another-client"}
+	provider := newTestProvider(stub)
+
+	verifier := GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.authorize(t, authURL)
+
+	if _, err := provider.Exchange(context.Background(), "valid-code", "nonce", verifier); err == nil {
+		t.Error("expected an error for an ID token issued to another client")
+	}
+}
+
+func TestDiscoveryFailure(t *testing.T) {
+	provider := New(Config{Issuer: "http://127.0.0.1:1", ClientID: "articpad"})
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", GenerateVerifier()); err == nil {
+		t.Error("expected an error when the provider is unreachable")
+	}
+}
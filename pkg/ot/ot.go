@@ -0,0 +1,273 @@
+// Operational transformation for plain text, based on the algorithm used by https://github.com/Operational-Transformation/ot.js
+
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrBaseLengthMismatch = errors.New("ot: the operation's base length must be equal to the document's length")
+	ErrInvalidOperation   = errors.New("ot: the encoded operation is not in the correct format")
+	ErrOperationTooShort  = errors.New("ot: cannot transform operations, first operation is too short")
+	ErrOperationTooLong   = errors.New("ot: cannot transform operations, first operation is too long")
+	ErrDocumentTooShort   = errors.New("ot: the operation is longer than the document")
+)
+
+// component is a single step of an operation. Exactly one of its fields is set.
+type component struct {
+	retain int
+	insert string
+	delete int
+}
+
+// Operation is a sequence of retain, insert and delete components that
+// transforms a document of BaseLen characters into one of TargetLen characters.
+// Lengths are counted in Unicode code points.
+type Operation struct {
+	ops       []component
+	baseLen   int
+	targetLen int
+}
+
+// New returns an empty operation.
+func New() *Operation {
+	return &Operation{}
+}
+
+// BaseLen returns the length of the documents this operation can be applied to.
+func (o *Operation) BaseLen() int {
+	return o.baseLen
+}
+
+// TargetLen returns the length of the document after applying this operation.
+func (o *Operation) TargetLen() int {
+	return o.targetLen
+}
+
+// IsNoop returns true if the operation does not change the document.
+func (o *Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+// Retain skips over n characters of the document.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if last := o.last(); last != nil && last.retain > 0 {
+		last.retain += n
+	} else {
+		o.ops = append(o.ops, component{retain: n})
+	}
+	return o
+}
+
+// Insert inserts the given string at the current position.
+func (o *Operation) Insert(s string) *Operation {
+	if s == "" {
+		return o
+	}
+	o.targetLen += utf8.RuneCountInString(s)
+	last := o.last()
+	switch {
+	case last != nil && last.insert != "":
+		last.insert += s
+	case last != nil && last.delete > 0:
+		// Inserts always go before deletes so equivalent operations share the same representation.
+		if n := len(o.ops); n > 1 && o.ops[n-2].insert != "" {
+			o.ops[n-2].insert += s
+		} else {
+			o.ops = append(o.ops, *last)
+			o.ops[n-1] = component{insert: s}
+		}
+	default:
+		o.ops = append(o.ops, component{insert: s})
+	}
+	return o
+}
+
+// Delete removes n characters at the current position.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	if last := o.last(); last != nil && last.delete > 0 {
+		last.delete += n
+	} else {
+		o.ops = append(o.ops, component{delete: n})
+	}
+	return o
+}
+
+// Apply applies the operation to the given document and returns the result.
+func (o *Operation) Apply(doc string) (string, error) {
+	if utf8.RuneCountInString(doc) != o.baseLen {
+		return "", ErrBaseLengthMismatch
+	}
+
+	runes := []rune(doc)
+	var b strings.Builder
+	index := 0
+	for _, op := range o.ops {
+		switch {
+		case op.retain > 0:
+			if index+op.retain > len(runes) {
+				return "", ErrDocumentTooShort
+			}
+			b.WriteString(string(runes[index : index+op.retain]))
+			index += op.retain
+		case op.insert != "":
+			b.WriteString(op.insert)
+		case op.delete > 0:
+			index += op.delete
+		}
+	}
+	return b.String(), nil
+}
+
+// Transform takes two operations a and b that happened concurrently on the same
+// document and returns a' and b' such that b'(a(doc)) == a'(b(doc)).
+// When both operations insert at the same position, the insert of a goes first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, ErrBaseLengthMismatch
+	}
+
+	aPrime, bPrime := New(), New()
+	opsA, opsB := a.copyOps(), b.copyOps()
+	var opA, opB *component
+	next := func(ops *[]component) *component {
+		if len(*ops) == 0 {
+			return nil
+		}
+		c := &(*ops)[0]
+		*ops = (*ops)[1:]
+		return c
+	}
+	opA, opB = next(&opsA), next(&opsB)
+
+	for opA != nil || opB != nil {
+		if opA != nil && opA.insert != "" {
+			aPrime.Insert(opA.insert)
+			bPrime.Retain(utf8.RuneCountInString(opA.insert))
+			opA = next(&opsA)
+			continue
+		}
+		if opB != nil && opB.insert != "" {
+			aPrime.Retain(utf8.RuneCountInString(opB.insert))
+			bPrime.Insert(opB.insert)
+			opB = next(&opsB)
+			continue
+		}
+		if opA == nil {
+			return nil, nil, ErrOperationTooShort
+		}
+		if opB == nil {
+			return nil, nil, ErrOperationTooLong
+		}
+
+		var n int
+		switch {
+		case opA.retain > 0 && opB.retain > 0:
+			n = min(opA.retain, opB.retain)
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+			opA.retain -= n
+			opB.retain -= n
+		case opA.delete > 0 && opB.delete > 0:
+			// Both operations delete the same characters, nothing left to do.
+			n = min(opA.delete, opB.delete)
+			opA.delete -= n
+			opB.delete -= n
+		case opA.delete > 0 && opB.retain > 0:
+			n = min(opA.delete, opB.retain)
+			aPrime.Delete(n)
+			opA.delete -= n
+			opB.retain -= n
+		case opA.retain > 0 && opB.delete > 0:
+			n = min(opA.retain, opB.delete)
+			bPrime.Delete(n)
+			opA.retain -= n
+			opB.delete -= n
+		}
+
+		if opA.retain == 0 && opA.delete == 0 {
+			opA = next(&opsA)
+		}
+		if opB.retain == 0 && opB.delete == 0 {
+			opB = next(&opsB)
+		}
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// MarshalJSON encodes the operation using the ot.js format: positive integers are
+// retains, negative integers are deletes and strings are inserts.
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	out := make([]any, 0, len(o.ops))
+	for _, op := range o.ops {
+		switch {
+		case op.retain > 0:
+			out = append(out, op.retain)
+		case op.insert != "":
+			out = append(out, op.insert)
+		case op.delete > 0:
+			out = append(out, -op.delete)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an operation encoded using the ot.js format.
+func (o *Operation) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return ErrInvalidOperation
+	}
+
+	op := New()
+	for _, r := range raw {
+		var n int
+		if err := json.Unmarshal(r, &n); err == nil {
+			switch {
+			case n > 0:
+				op.Retain(n)
+			case n < 0:
+				op.Delete(-n)
+			default:
+				return ErrInvalidOperation
+			}
+			continue
+		}
+
+		var s string
+		if err := json.Unmarshal(r, &s); err != nil || s == "" {
+			return ErrInvalidOperation
+		}
+		op.Insert(s)
+	}
+
+	*o = *op
+	return nil
+}
+
+func (o *Operation) last() *component {
+	if len(o.ops) == 0 {
+		return nil
+	}
+	return &o.ops[len(o.ops)-1]
+}
+
+func (o *Operation) copyOps() []component {
+	ops := make([]component, len(o.ops))
+	copy(ops, o.ops)
+	return ops
+}
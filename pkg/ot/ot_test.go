@@ -0,0 +1,166 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestApply(t *testing.T) {
+	op := New().Retain(6).Delete(5).Insert("gophers").Retain(1)
+
+	result, err := op.Apply("Hello world!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "Hello gophers!" {
+		t.Errorf("expected %q, got %q", "Hello gophers!", result)
+	}
+
+	if op.BaseLen() != 12 {
+		t.Errorf("expected base length 12, got %d", op.BaseLen())
+	}
+	if op.TargetLen() != 14 {
+		t.Errorf("expected target length 14, got %d", op.TargetLen())
+	}
+
+	_, err = op.Apply("Hello")
+	if err != ErrBaseLengthMismatch {
+		t.Errorf("expected %v, got %v", ErrBaseLengthMismatch, err)
+	}
+}
+
+func TestApplyUnicode(t *testing.T) {
+	op := New().Retain(2).Insert("ñ").Retain(1)
+
+	result, err := op.Apply("añ😀")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "aññ😀" {
+		t.Errorf("expected %q, got %q", "aññ😀", result)
+	}
+}
+
+func TestInsertBeforeDelete(t *testing.T) {
+	a := New().Delete(3).Insert("abc")
+	b := New().Insert("abc").Delete(3)
+
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) != string(jb) {
+		t.Errorf("expected equal representations, got %s and %s", ja, jb)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	op := &Operation{}
+	if err := json.Unmarshal([]byte(`[3,"abc",-2,1]`), op); err != nil {
+		t.Fatal(err)
+	}
+	if op.BaseLen() != 6 || op.TargetLen() != 7 {
+		t.Errorf("unexpected lengths %d and %d", op.BaseLen(), op.TargetLen())
+	}
+
+	b, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[3,"abc",-2,1]` {
+		t.Errorf("unexpected encoding %s", b)
+	}
+
+	for _, invalid := range []string{`[0]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(invalid), &Operation{}); err != ErrInvalidOperation {
+			t.Errorf("expected %v for %s, got %v", ErrInvalidOperation, invalid, err)
+		}
+	}
+}
+
+func TestTransformConcurrentInserts(t *testing.T) {
+	doc := "abc"
+	a := New().Retain(1).Insert("X").Retain(2)
+	b := New().Retain(1).Insert("Y").Retain(2)
+
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	left := mustApply(t, mustApply(t, doc, a), bPrime)
+	right := mustApply(t, mustApply(t, doc, b), aPrime)
+	if left != right {
+		t.Errorf("documents diverged: %q and %q", left, right)
+	}
+	if left != "aXYbc" {
+		t.Errorf("expected %q, got %q", "aXYbc", left)
+	}
+}
+
+func TestTransformBaseLengthMismatch(t *testing.T) {
+	_, _, err := Transform(New().Retain(2), New().Retain(3))
+	if err != ErrBaseLengthMismatch {
+		t.Errorf("expected %v, got %v", ErrBaseLengthMismatch, err)
+	}
+}
+
+func TestTransformRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		doc := randomString(r, r.Intn(20))
+		a := randomOperation(r, doc)
+		b := randomOperation(r, doc)
+
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		left := mustApply(t, mustApply(t, doc, a), bPrime)
+		right := mustApply(t, mustApply(t, doc, b), aPrime)
+		if left != right {
+			t.Fatalf("documents diverged for %q: %q and %q", doc, left, right)
+		}
+	}
+}
+
+func mustApply(t *testing.T, doc string, op *Operation) string {
+	t.Helper()
+	result, err := op.Apply(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func randomString(r *rand.Rand, n int) string {
+	chars := []rune("abcdefghñ😀 ")
+	s := make([]rune, n)
+	for i := range s {
+		s[i] = chars[r.Intn(len(chars))]
+	}
+	return string(s)
+}
+
+func randomOperation(r *rand.Rand, doc string) *Operation {
+	op := New()
+	remaining := utf8.RuneCountInString(doc)
+	for remaining > 0 {
+		n := 1 + r.Intn(remaining)
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+			remaining -= n
+		case 1:
+			op.Delete(n)
+			remaining -= n
+		case 2:
+			op.Insert(randomString(r, 1+r.Intn(4)))
+		}
+	}
+	if r.Intn(2) == 0 {
+		op.Insert(randomString(r, 1+r.Intn(4)))
+	}
+	return op
+}
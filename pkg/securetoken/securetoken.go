@@ -0,0 +1,35 @@
+package securetoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// DefaultLength is the number of random bytes used by tokens, 256 bits.
+const DefaultLength = 32
+
+// Generate returns a random URL-safe token built from the given number of random bytes.
+func Generate(length uint32) (string, error) {
+	b := make([]byte, length)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of a token. Tokens are random and long enough
+// that a fast hash is sufficient to store them without exposing their value.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Compare performs a constant-time comparison between a plain-text token and a hash.
+func Compare(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(token)), []byte(hash)) == 1
+}
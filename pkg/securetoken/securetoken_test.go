@@ -0,0 +1,50 @@
+package securetoken
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	token, err := Generate(DefaultLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != DefaultLength {
+		t.Errorf("expected %d bytes, got %d", DefaultLength, len(b))
+	}
+
+	other, err := Generate(DefaultLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other {
+		t.Error("expected different tokens")
+	}
+}
+
+func TestHash(t *testing.T) {
+	hash := Hash("token")
+	if hash != "3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0" {
+		t.Errorf("unexpected hash %s", hash)
+	}
+	if Hash("token") != hash {
+		t.Error("expected hashes to be deterministic")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	hash := Hash("token")
+
+	if !Compare("token", hash) {
+		t.Error("expected token to match its hash")
+	}
+	if Compare("other", hash) {
+		t.Error("expected token not to match a different hash")
+	}
+}
@@ -0,0 +1,106 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Secret used by the test vectors of RFC 6238, appendix B.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateCode(t *testing.T) {
+	// RFC 6238 uses 8 digits, the last 6 digits are the 6 digits code.
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := GenerateCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("expected code %s at %d, got %s", expected, unix, code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != SecretLength {
+		t.Errorf("expected %d bytes, got %d", SecretLength, len(key))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := GenerateCode(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok, err := Validate(code, rfcSecret, now, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected code to be valid")
+	}
+	if step != Step(now) {
+		t.Errorf("expected step %d, got %d", Step(now), step)
+	}
+
+	// Codes from the previous period are accepted with a skew of 1.
+	_, ok, _ = Validate(code, rfcSecret, now.Add(Period*time.Second), 1)
+	if !ok {
+		t.Error("expected code to be valid with skew")
+	}
+
+	_, ok, _ = Validate(code, rfcSecret, now.Add(2*Period*time.Second), 1)
+	if ok {
+		t.Error("expected code to be expired")
+	}
+
+	_, ok, _ = Validate("12345", rfcSecret, now, 1)
+	if ok {
+		t.Error("expected short code to be invalid")
+	}
+
+	_, _, err = Validate(code, "not base32!", now, 1)
+	if err != ErrInvalidSecret {
+		t.Errorf("expected %v, got %v", ErrInvalidSecret, err)
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	uri := KeyURI("ArticPad", "alice", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	if u.Path != "/ArticPad:alice" {
+		t.Errorf("unexpected label %s", u.Path)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != "ArticPad" {
+		t.Errorf("unexpected parameters %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,110 @@
+package validator
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Most common passwords, in lowercase, one per line.
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var (
+	commonPasswords     map[string]struct{}
+	commonPasswordsOnce sync.Once
+)
+
+// BreachedRanges is the source of breached password hashes checked by DefaultPasswordValidator,
+// it is not checked if nil.
+var BreachedRanges RangeSource
+
+// RangeSource gives the ranges of breached password hashes of the k-anonymity model used by
+// Have I Been Pwned (https://haveibeenpwned.com/API/v3#SearchingPwnedPasswordsByRange).
+type RangeSource interface {
+	// Range returns the breached SHA-1 hashes starting with the given 5 characters prefix, one per
+	// line in the 'SUFFIX:COUNT' format. It returns nil if there are none.
+	Range(prefix string) (io.ReadCloser, error)
+}
+
+// RangeDir is a directory holding a range file named 'PREFIX.txt' for each hash prefix, as created
+// by the Have I Been Pwned downloader.
+type RangeDir string
+
+// Range implements RangeSource.
+func (d RangeDir) Range(prefix string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return f, err
+}
+
+// NotCompromised returns a ValidateFunc that checks the text is not one of the most common passwords
+// and, if ranges is not nil, that it has not been exposed in a data breach.
+func NotCompromised(ranges RangeSource, customError error) ValidateFunc {
+	return ValidateFunc(func(text string) error {
+		compromised := isCommonPassword(text)
+		if !compromised && ranges != nil {
+			var err error
+			compromised, err = isBreachedPassword(ranges, text)
+			if err != nil {
+				return err
+			}
+		}
+
+		if compromised {
+			if customError != nil {
+				return customError
+			}
+			return errors.New("must not be a common or breached password")
+		}
+		return nil
+	})
+}
+
+// isCommonPassword tells whether the text is in the bundled list of common passwords, ignoring case.
+func isCommonPassword(text string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]struct{})
+		for _, password := range strings.Split(commonPasswordsList, "\n") {
+			if password = strings.TrimSpace(password); password != "" {
+				commonPasswords[password] = struct{}{}
+			}
+		}
+	})
+
+	_, ok := commonPasswords[strings.ToLower(text)]
+	return ok
+}
+
+// isBreachedPassword looks for the SHA-1 hash of the text in its range. Entries with a count of 0
+// are padding and are ignored.
+func isBreachedPassword(ranges RangeSource, text string) (bool, error) {
+	sum := sha1.Sum([]byte(text))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	r, err := ranges.Range(hash[:5])
+	if err != nil || r == nil {
+		return false, err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		suffix, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if found && strings.EqualFold(suffix, hash[5:]) {
+			return count != "0", nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,86 @@
+package validator
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/jramsgz/articpad/internal/utils/consts"
+)
+
+// Policy holds the rules usernames and passwords must follow. It is exposed to clients so they can
+// show and check the rules before sending a request.
+type Policy struct {
+	UsernameMinLength    int    `json:"username_min_length"`
+	UsernameMaxLength    int    `json:"username_max_length"`
+	UsernameAllowedChars string `json:"username_allowed_chars"`
+	// Reserved usernames besides the ones in ReservedUsernames.
+	ReservedUsernames        []string `json:"reserved_usernames"`
+	PasswordMinLength        int      `json:"password_min_length"`
+	PasswordMaxLength        int      `json:"password_max_length"`
+	PasswordRequireLowercase bool     `json:"password_require_lowercase"`
+	PasswordRequireUppercase bool     `json:"password_require_uppercase"`
+	PasswordRequireNumber    bool     `json:"password_require_number"`
+	PasswordRequireSpecial   bool     `json:"password_require_special"`
+	// Maximum similarity ratio in [0,1] of a password to the username and email, 1 disables the check.
+	PasswordMaxSimilarity float64 `json:"password_max_similarity"`
+}
+
+// DefaultPolicy is the policy used by DefaultUsernameValidator and DefaultPasswordValidator, use
+// SetDefaultPolicy to change it.
+var DefaultPolicy = &Policy{
+	UsernameMinLength:        3,
+	UsernameMaxLength:        32,
+	UsernameAllowedChars:     "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.-_",
+	ReservedUsernames:        []string{},
+	PasswordMinLength:        8,
+	PasswordMaxLength:        64,
+	PasswordRequireLowercase: true,
+	PasswordRequireUppercase: true,
+	PasswordRequireNumber:    true,
+	PasswordRequireSpecial:   true,
+	PasswordMaxSimilarity:    0.7,
+}
+
+// SetDefaultPolicy replaces the default policy and rebuilds the default validators from it.
+func SetDefaultPolicy(p *Policy) {
+	DefaultPolicy = p
+	DefaultUsernameValidator = p.UsernameValidator()
+	DefaultPasswordValidator = p.PasswordValidator
+}
+
+// UsernameValidator returns a validator for usernames following the policy.
+func (p *Policy) UsernameValidator() *Validator {
+	return New(
+		MinLength(p.UsernameMinLength, consts.NewParamError(consts.ErrUsernameTooShort, "min", strconv.Itoa(p.UsernameMinLength))),
+		MaxLength(p.UsernameMaxLength, consts.NewParamError(consts.ErrUsernameTooLong, "max", strconv.Itoa(p.UsernameMaxLength))),
+		ContainsOnly(p.UsernameAllowedChars, errors.New(consts.ErrUsernameContainsInvalidCharacters)),
+		NotReserved(append(append([]string{}, ReservedUsernames...), p.ReservedUsernames...), errors.New(consts.ErrUsernameReserved)),
+	)
+}
+
+// PasswordValidator returns a validator for passwords following the policy, checking they are not
+// too similar to the given attributes of the user.
+func (p *Policy) PasswordValidator(similarityAttributes []string) *Validator {
+	similarity := p.PasswordMaxSimilarity
+	v := New(
+		MinLength(p.PasswordMinLength, consts.NewParamError(consts.ErrPasswordTooShort, "min", strconv.Itoa(p.PasswordMinLength))),
+		MaxLength(p.PasswordMaxLength, consts.NewParamError(consts.ErrPasswordTooLong, "max", strconv.Itoa(p.PasswordMaxLength))),
+	)
+	if p.PasswordRequireLowercase {
+		*v = append(*v, Regex(`^\P{Ll}*\p{Ll}[\s\S]*$`, errors.New(consts.ErrPasswordMissingLowercase)))
+	}
+	if p.PasswordRequireUppercase {
+		*v = append(*v, Regex(`^\P{Lu}*\p{Lu}[\s\S]*$`, errors.New(consts.ErrPasswordMissingUppercase)))
+	}
+	if p.PasswordRequireNumber {
+		*v = append(*v, Regex(`^\P{N}*\p{N}[\s\S]*$`, errors.New(consts.ErrPasswordMissingNumber)))
+	}
+	if p.PasswordRequireSpecial {
+		*v = append(*v, Regex(`^[\p{L}\p{N}]*[^\p{L}\p{N}][\s\S]*$`, errors.New(consts.ErrPasswordMissingSpecial)))
+	}
+	*v = append(*v,
+		Similarity(similarityAttributes, &similarity, errors.New(consts.ErrPasswordSimilarity)),
+		NotCompromised(BreachedRanges, errors.New(consts.ErrPasswordCompromised)),
+	)
+	return v
+}
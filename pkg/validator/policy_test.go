@@ -0,0 +1,95 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jramsgz/articpad/internal/utils/consts"
+)
+
+func TestPolicyUsernameValidator(t *testing.T) {
+	p := &Policy{
+		UsernameMinLength:    5,
+		UsernameMaxLength:    10,
+		UsernameAllowedChars: "abcdefghijklmnopqrstuvwxyz",
+		ReservedUsernames:    []string{"admin"},
+	}
+	v := p.UsernameValidator()
+
+	tests := []struct {
+		username string
+		err      string
+	}{
+		{"alice", ""},
+		{"bob", consts.ErrUsernameTooShort},
+		{"alexandrina", consts.ErrUsernameTooLong},
+		{"alice.b", consts.ErrUsernameContainsInvalidCharacters},
+		{"admin", consts.ErrUsernameReserved},
+	}
+
+	for _, tt := range tests {
+		err := v.Validate(tt.username)
+		if tt.err == "" && err != nil {
+			t.Errorf("%q: expected no error, got %v", tt.username, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%q: expected error %q, got %v", tt.username, tt.err, err)
+		}
+	}
+
+	// The length errors give the limits for their messages.
+	var paramErr *consts.ParamError
+	if err := v.Validate("bob"); !errors.As(err, &paramErr) || len(paramErr.Params) != 2 || paramErr.Params[1] != "5" {
+		t.Errorf("expected the minimum length in the error params, got %v", err)
+	}
+}
+
+func TestPolicyPasswordValidator(t *testing.T) {
+	p := &Policy{
+		PasswordMinLength:     12,
+		PasswordMaxLength:     20,
+		PasswordRequireNumber: true,
+		PasswordMaxSimilarity: 0.7,
+	}
+	v := p.PasswordValidator([]string{"alice@example.com"})
+
+	tests := []struct {
+		password string
+		err      string
+	}{
+		{"gentle river 42", ""},
+		{"river 42", consts.ErrPasswordTooShort},
+		{"a gentle and long river 42", consts.ErrPasswordTooLong},
+		{"gentle river forty", consts.ErrPasswordMissingNumber},
+		{"alice@example.com1", consts.ErrPasswordSimilarity},
+		{"password1234", consts.ErrPasswordCompromised},
+	}
+
+	for _, tt := range tests {
+		err := v.Validate(tt.password)
+		if tt.err == "" && err != nil {
+			t.Errorf("%q: expected no error, got %v", tt.password, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%q: expected error %q, got %v", tt.password, tt.err, err)
+		}
+	}
+}
+
+func TestSetDefaultPolicy(t *testing.T) {
+	defaultPolicy := DefaultPolicy
+	defer SetDefaultPolicy(defaultPolicy)
+
+	if err := DefaultUsernameValidator.Validate("ab"); err == nil {
+		t.Error("expected the default policy to reject short usernames")
+	}
+
+	p := *defaultPolicy
+	p.UsernameMinLength = 2
+	SetDefaultPolicy(&p)
+
+	if err := DefaultUsernameValidator.Validate("ab"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if DefaultPolicy != &p {
+		t.Error("expected the default policy to be replaced")
+	}
+}
@@ -0,0 +1,90 @@
+package validator
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Default list of reserved usernames, see the file for its format.
+//
+//go:embed reserved_usernames.txt
+var reservedUsernamesList string
+
+// ReservedUsernames are the usernames rejected by DefaultUsernameValidator besides the ones of the policy,
+// by default the bundled list. Call SetDefaultPolicy after changing it to rebuild the validator.
+var ReservedUsernames, _ = ReadWordList(strings.NewReader(reservedUsernamesList))
+
+// Characters that look like a Latin letter or digit, after lowercasing, mapped to it as in the
+// confusables of Unicode Technical Standard #39 (https://www.unicode.org/reports/tr39/#Confusable_Detection).
+var confusables = map[rune]rune{
+	// Digits and symbols
+	'0': 'o', '1': 'l', '|': 'l',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'н': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'м': 'm', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	'ү': 'y',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w',
+}
+
+// Sequences of characters that look like a single letter.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// NotReserved returns a ValidateFunc that checks the text is not one of the reserved words, ignoring case,
+// diacritics and characters that look alike, so "Admin", "ädmin" or "аdmin" (with a Cyrillic a) match "admin".
+func NotReserved(words []string, customError error) ValidateFunc {
+	skeletons := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		skeletons[skeleton(word)] = struct{}{}
+	}
+
+	return ValidateFunc(func(text string) error {
+		if _, ok := skeletons[skeleton(text)]; ok {
+			if customError != nil {
+				return customError
+			}
+			return errors.New("must not be a reserved word")
+		}
+		return nil
+	})
+}
+
+// ReadWordList reads a list of words, one per line. Empty lines and lines starting with '#' are ignored.
+func ReadWordList(r io.Reader) ([]string, error) {
+	words := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+
+	return words, scanner.Err()
+}
+
+// skeleton returns the text lowercased, without diacritics and with the characters that look alike
+// replaced by the same one, so texts that can be confused have the same skeleton.
+func skeleton(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+
+	return confusableSequences.Replace(b.String())
+}
@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jramsgz/articpad/internal/utils/consts"
+)
+
+func TestNotReserved(t *testing.T) {
+	expectedErr := errors.New("username is reserved")
+	v := NotReserved([]string{"admin", "support", "mod"}, expectedErr)
+
+	tests := []struct {
+		text     string
+		reserved bool
+	}{
+		{"admin", true},
+		{"ADMIN", true},
+		{"аdmin", true},          // Cyrillic a
+		{"admіn", true},          // Cyrillic i
+		{"ädmin", true},          // Diacritic
+		{"ａｄｍｉｎ", true},          // Fullwidth
+		{"suppOrt", true},        // Case
+		{"supp0rt", true},        // Zero
+		{"rnod", true},           // "rn" looks like "m"
+		{"administrator", false}, // Only whole words
+		{"alice", false},
+		{"modern", false},
+	}
+
+	for _, tt := range tests {
+		err := v(tt.text)
+		if tt.reserved && err != expectedErr {
+			t.Errorf("%q: expected error %q, got %v", tt.text, expectedErr, err)
+		} else if !tt.reserved && err != nil {
+			t.Errorf("%q: expected no error, got %v", tt.text, err)
+		}
+	}
+}
+
+func TestReadWordList(t *testing.T) {
+	words, err := ReadWordList(strings.NewReader("# Comment\nadmin\n\n  root  \r\n#api\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"admin", "root"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %v, got %v", expected, words)
+	}
+}
+
+func TestDefaultReservedUsernames(t *testing.T) {
+	for _, username := range []string{"admin", "Health", "api", "SUPPORT"} {
+		if err := DefaultUsernameValidator.Validate(username); err == nil || err.Error() != consts.ErrUsernameReserved {
+			t.Errorf("%q: expected it to be reserved, got %v", username, err)
+		}
+	}
+}
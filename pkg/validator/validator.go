@@ -2,8 +2,6 @@ package validator
 
 import (
 	"errors"
-
-	"github.com/jramsgz/articpad/internal/utils/consts"
 )
 
 // ValidateFunc defines a function to validate
@@ -36,26 +34,10 @@ func (v *Validator) Validate(text string) error {
 	return nil
 }
 
-// Default validator functions
+// Default validator functions, built from DefaultPolicy
 var (
 	// Username validator
-	DefaultUsernameValidator = New(
-		MinLength(3, errors.New(consts.ErrUsernameLengthLessThan3)),
-		MaxLength(32, errors.New(consts.ErrUsernameLengthMoreThan32)),
-		ContainsOnly("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.-_", errors.New(consts.ErrUsernameContainsInvalidCharacters)),
-	)
+	DefaultUsernameValidator = DefaultPolicy.UsernameValidator()
 	// Password validator
-	DefaultPasswordValidator = func(similarityAttributes []string) *Validator {
-		similarity := 0.7
-		v := New(
-			MinLength(8, errors.New(consts.ErrPasswordLengthLessThan8)),
-			MaxLength(64, errors.New(consts.ErrPasswordLengthMoreThan64)),
-			Regex(`^\P{Ll}*\p{Ll}[\s\S]*$`, errors.New(consts.ErrPasswordStrength)),
-			Regex(`^\P{Lu}*\p{Lu}[\s\S]*$`, errors.New(consts.ErrPasswordStrength)),
-			Regex(`^\P{N}*\p{N}[\s\S]*$`, errors.New(consts.ErrPasswordStrength)),
-			Regex(`^[\p{L}\p{N}]*[^\p{L}\p{N}][\s\S]*$`, errors.New(consts.ErrPasswordStrength)),
-			Similarity(similarityAttributes, &similarity, errors.New(consts.ErrPasswordSimilarity)),
-		)
-		return v
-	}
+	DefaultPasswordValidator = DefaultPolicy.PasswordValidator
 )
@@ -220,3 +220,18 @@ func Regex(pattern string, customError error) ValidateFunc {
 		return nil
 	})
 }
+
+// NotOneOf returns ValidateFunc that validate whether the text is not one of the words, ignoring case
+func NotOneOf(words []string, customError error) ValidateFunc {
+	return ValidateFunc(func(text string) error {
+		for _, word := range words {
+			if strings.EqualFold(text, word) {
+				if customError != nil {
+					return customError
+				}
+				return fmt.Errorf("must not be %s", word)
+			}
+		}
+		return nil
+	})
+}
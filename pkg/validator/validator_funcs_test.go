@@ -2,6 +2,8 @@ package validator
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -151,3 +153,67 @@ func TestSimilarity(t *testing.T) {
 		t.Errorf("expected no error, got %v", err)
 	}
 }
+
+func TestNotCompromised(t *testing.T) {
+	// Test case 1: Uncommon password
+	err := NotCompromised(nil, nil)("c0rrect-H0rse-battery")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// Test case 2: Common password, ignoring case
+	expectedErr := errors.New("password is compromised")
+	err = NotCompromised(nil, expectedErr)("P@ssw0rd!")
+	if err != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+
+	// Test case 3: Breached password, the SHA-1 of "c0rrect-H0rse-battery" is BF37622DB36BEEED4D83BB6E2C11891A568903D5
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "BF376.txt"), []byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n22db36beeed4d83bb6e2c11891a568903d5:42\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NotCompromised(RangeDir(dir), expectedErr)("c0rrect-H0rse-battery")
+	if err != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+
+	// Test case 4: Padding entries are ignored
+	err = os.WriteFile(filepath.Join(dir, "BF376.txt"), []byte("22DB36BEEED4D83BB6E2C11891A568903D5:0\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NotCompromised(RangeDir(dir), expectedErr)("c0rrect-H0rse-battery")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// Test case 5: Missing range file
+	err = NotCompromised(RangeDir(t.TempDir()), expectedErr)("c0rrect-H0rse-battery")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestNotOneOf(t *testing.T) {
+	// Test case 1: Not in the list
+	err := NotOneOf([]string{"admin", "root"}, nil)("alice")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// Test case 2: In the list, ignoring case
+	expectedErr := errors.New("must not be admin")
+	err = NotOneOf([]string{"admin", "root"}, nil)("Admin")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+
+	// Test case 3: Custom error
+	customErr := errors.New("custom error")
+	err = NotOneOf([]string{"admin", "root"}, customErr)("ROOT")
+	if err != customErr {
+		t.Errorf("expected custom error, got %v", err)
+	}
+}
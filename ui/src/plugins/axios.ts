@@ -17,6 +17,7 @@ axiosInstance.interceptors.request.use(
       "/auth/forgot",
       "/auth/register",
       "/auth/reset",
+      "/auth/refresh",
     ];
 
     if (!urlsExcludedForBearerHeader.includes(config.url as string)) {
@@ -30,14 +31,37 @@ axiosInstance.interceptors.request.use(
   }
 );
 
-axios.interceptors.response.use(
-  (response) => {
-    if (!response.config.url?.includes("/auth/refresh")) {
-      // TODO: check if the token is expired and refresh it
+// Shared between requests so concurrent failures only refresh the session once,
+// using the same refresh token twice would revoke the whole session
+let refreshing: Promise<void> | null = null;
+
+// Refresh the short-lived JWT and retry the request once when it is rejected
+axiosInstance.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const config = error.config;
+    const errorCode = error.response?.data?.error_code;
+    const authStore = useAuthStore();
+
+    if (
+      config &&
+      !config._retried &&
+      !["/auth/login", "/auth/refresh"].includes(config.url) &&
+      (errorCode === "invalid_jwt" || errorCode === "revoked_jwt") &&
+      authStore.refreshToken
+    ) {
+      config._retried = true;
+      try {
+        refreshing = refreshing || authStore.refreshSession();
+        await refreshing;
+      } catch (refreshError) {
+        return Promise.reject(error);
+      } finally {
+        refreshing = null;
+      }
+      return axiosInstance(config);
     }
-    return response;
-  },
-  (error) => {
+
     return Promise.reject(error);
   }
 );
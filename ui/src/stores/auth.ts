@@ -36,6 +36,7 @@ export const useAuthStore = defineStore({
   state: () => ({
     // Initialize state from local storage to avoid reset on page refresh
     token: getFromLocalStorage("token", null),
+    refreshToken: getFromLocalStorage("refreshToken", null),
     user: tryParseJSON(getFromLocalStorage("user", "{}")) as User,
     lastUpdatedAt: getFromLocalStorage("lastUpdatedAt", null),
   }),
@@ -58,12 +59,14 @@ export const useAuthStore = defineStore({
         const updatedDate = new Date().toISOString();
         if (rememberMe) {
           saveToLocalStorage("token", response.data.token);
+          saveToLocalStorage("refreshToken", response.data.refresh_token);
           saveToLocalStorage("lastUpdatedAt", updatedDate);
           saveToLocalStorage("user", JSON.stringify(response.data.user));
         }
 
         // update pinia state
         this.token = response.data.token;
+        this.refreshToken = response.data.refresh_token;
         this.lastUpdatedAt = updatedDate;
         this.user = response.data.user;
       } catch (error) {
@@ -99,15 +102,35 @@ export const useAuthStore = defineStore({
       }
 
       this.token = null;
+      this.refreshToken = null;
       this.lastUpdatedAt = null;
       this.user = {} as User;
       removeFromLocalStorage("token");
+      removeFromLocalStorage("refreshToken");
       removeFromLocalStorage("lastUpdatedAt");
       removeFromLocalStorage("user");
 
       router.push("/login");
     },
-    async refreshToken() {},
+    // Exchanges the refresh token for a new pair of tokens, errors are handled by the caller
+    async refreshSession() {
+      const response = await axios.post("/auth/refresh", {
+        refresh_token: this.refreshToken,
+      });
+
+      if (!response.data.token) {
+        throw "MISSING_TOKEN";
+      }
+
+      // only persist the new tokens if the user chose to be remembered
+      if (getFromLocalStorage("token", null)) {
+        saveToLocalStorage("token", response.data.token);
+        saveToLocalStorage("refreshToken", response.data.refresh_token);
+      }
+
+      this.token = response.data.token;
+      this.refreshToken = response.data.refresh_token;
+    },
     async requestPasswordReset(login: string) {
       try {
         const response = await axios.post("/auth/forgot", {
@@ -52,31 +52,37 @@ const errorMap: ErrorMap = {
   username_length_less_than_3: {
     title: "errors.invalid_username",
     message: "errors.username_too_short",
-    setMessage: false,
+    setMessage: true,
     setFooter: false,
   },
   username_length_more_than_32: {
     title: "errors.invalid_username",
     message: "errors.username_too_long",
-    setMessage: false,
+    setMessage: true,
     setFooter: false,
   },
   username_contains_invalid_characters: {
     title: "errors.invalid_username",
     message: "errors.username_contains_invalid_chars",
-    setMessage: false,
+    setMessage: true,
+    setFooter: false,
+  },
+  username_reserved: {
+    title: "errors.invalid_username",
+    message: "errors.invalid_username",
+    setMessage: true,
     setFooter: false,
   },
   password_length_less_than_8: {
     title: "errors.invalid_password",
     message: "errors.password_too_short",
-    setMessage: false,
+    setMessage: true,
     setFooter: false,
   },
   password_length_more_than_64: {
     title: "errors.invalid_password",
     message: "errors.password_too_long",
-    setMessage: false,
+    setMessage: true,
     setFooter: false,
   },
   password_similarity: {
@@ -85,6 +91,12 @@ const errorMap: ErrorMap = {
     setMessage: false,
     setFooter: false,
   },
+  password_compromised: {
+    title: "errors.invalid_password",
+    message: "errors.invalid_password",
+    setMessage: true,
+    setFooter: false,
+  },
   invalid_email: {
     title: "errors.invalid_email",
     message: "errors.invalid_email_msg",
@@ -106,7 +118,103 @@ const errorMap: ErrorMap = {
   password_strength: {
     title: "errors.invalid_password",
     message: "errors.password_too_weak",
-    setMessage: false,
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_magic_link: {
+    title: "errors.invalid_token",
+    message: "errors.invalid_token",
+    setMessage: true,
+    setFooter: false,
+  },
+  magic_link_expired: {
+    title: "errors.token_expired",
+    message: "errors.invalid_token",
+    setMessage: true,
+    setFooter: false,
+  },
+  cannot_send_magic_link_email: {
+    title: "errors.error_sending_email",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_webauthn_session: {
+    title: "errors.token_expired",
+    message: "errors.invalid_token",
+    setMessage: true,
+    setFooter: false,
+  },
+  webauthn_registration_failed: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  webauthn_login_failed: {
+    title: "errors.invalid_credentials",
+    message: "errors.invalid_credentials_msg",
+    setMessage: true,
+    setFooter: false,
+  },
+  api_token_name_length: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_api_token_scope: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_api_token_expiration: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  registration_closed: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invite_required: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_invite: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invite_expired: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invite_email_mismatch: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  email_domain_not_allowed: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
+    setFooter: false,
+  },
+  invalid_invite_expiration: {
+    title: "errors.error",
+    message: "errors.error",
+    setMessage: true,
     setFooter: false,
   },
   email_not_verified: {
@@ -151,12 +259,36 @@ const errorMap: ErrorMap = {
     setMessage: false,
     setFooter: false,
   },
+  revoked_jwt: {
+    title: "errors.invalid_token",
+    message: "errors.log_in_again",
+    setMessage: false,
+    setFooter: false,
+  },
+  account_locked: {
+    title: "errors.invalid_credentials",
+    message: "errors.invalid_credentials_msg",
+    setMessage: true,
+    setFooter: false,
+  },
+  login_throttled: {
+    title: "errors.invalid_credentials",
+    message: "errors.invalid_credentials_msg",
+    setMessage: true,
+    setFooter: false,
+  },
   invalid_password_reset_token: {
     title: "errors.invalid_token",
     message: "errors.invalid_password_reset_token",
     setMessage: false,
     setFooter: false,
   },
+  verification_token_expired: {
+    title: "errors.token_expired",
+    message: "errors.invalid_token",
+    setMessage: true,
+    setFooter: false,
+  },
   invalid_verification_token: {
     title: "errors.invalid_token",
     message: "errors.invalid_verification_token",